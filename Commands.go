@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/D-Haven/fact-totem/webapi"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCommand runs a maintenance command against the configured event store and returns the exit code.
+// The server must be stopped first, the event store only allows one process at a time.
+func runCommand(name string, args []string) int {
+	var err error
+
+	switch name {
+	case "export":
+		err = exportCommand(args)
+	case "import":
+		err = importCommand(args)
+	case "rekey":
+		err = rekeyCommand(args)
+	default:
+		err = fmt.Errorf("unknown command %q, expected export, import or rekey", name)
+	}
+
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	return 0
+}
+
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	configPath := flags.String("config", "./config.yaml", "configuration file")
+	aggregates := flags.String("aggregate", "", "comma separated aggregates to export, all when empty")
+	from := flags.String("from", "", "earliest fact timestamp to export (RFC 3339)")
+	to := flags.String("to", "", "export facts before this timestamp (RFC 3339)")
+	out := flags.String("out", "-", "file to write, - for standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter := eventstore.ExportFilter{}
+	if len(*aggregates) > 0 {
+		filter.Aggregates = strings.Split(*aggregates, ",")
+	}
+
+	var err error
+	if filter.From, err = parseFlagTime("from", *from); err != nil {
+		return err
+	}
+
+	if filter.To, err = parseFlagTime("to", *to); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer closeFile(file)
+		w = file
+	}
+
+	return withApi(*configPath, func(api *webapi.FactApi) error {
+		count, err := api.ExportFacts(w, filter)
+		log.Printf("Exported %d facts", count)
+		return err
+	})
+}
+
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	configPath := flags.String("config", "./config.yaml", "configuration file")
+	in := flags.String("in", "-", "file to read, - for standard input")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer closeFile(file)
+		r = file
+	}
+
+	return withApi(*configPath, func(api *webapi.FactApi) error {
+		count, err := api.ImportFacts(r)
+		log.Printf("Imported %d facts", count)
+		return err
+	})
+}
+
+func rekeyCommand(args []string) error {
+	flags := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	configPath := flags.String("config", "./config.yaml", "configuration file")
+	newKeyFile := flags.String("new-key", "", "file holding the new encryption key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*newKeyFile) == 0 {
+		return fmt.Errorf("-new-key is required")
+	}
+
+	config, err := GetValidatedConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	if len(config.EventStore.Driver) > 0 && config.EventStore.Driver != eventstore.DefaultDriver {
+		return fmt.Errorf("the '%s' event store driver does not support encryption", config.EventStore.Driver)
+	}
+
+	oldKey, err := config.EncryptionKey()
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(*newKeyFile)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := eventstore.ParseEncryptionKey(content)
+	if err != nil {
+		return err
+	}
+
+	if err := eventstore.RotateEncryptionKey(config.EventStore.Path, oldKey, newKey); err != nil {
+		return err
+	}
+
+	log.Print("Encryption key rotated, configure the new key before starting the server")
+	return nil
+}
+
+func withApi(configPath string, run func(api *webapi.FactApi) error) error {
+	config, err := GetValidatedConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	api, err := openApi(config)
+	if err != nil {
+		return err
+	}
+
+	err = run(api)
+
+	if closeErr := api.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func parseFlagTime(name string, value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+func closeFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.Printf("Error closing %s: %s", file.Name(), err)
+	}
+}
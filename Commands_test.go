@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportThenExportCommands(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	config := "event-store:\n  path: " + filepath.Join(dir, "store") + "\n"
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := `{"aggregate":"a","entity":"1","fact":{"Id":"01E0000000AAAAAAAAAAAAAAAA","Timestamp":"2020-03-01T00:00:00Z","OccurredAt":"2020-03-01T00:00:00Z","Content":{"n":1},"Hash":"vlthusUBRNj7rEr+MUbMixuG07o7WgOdEH5CstRk9OY="}}
+{"aggregate":"a","entity":"1","fact":{"Id":"01F0000000AAAAAAAAAAAAAAAA","Timestamp":"2021-03-01T00:00:00Z","OccurredAt":"2021-03-01T00:00:00Z","Content":{"n":2},"Hash":"lIGa+DD9pawUaDHyYhQ/Tc4QohkCXfO5soSZN9ogRdg="}}
+{"aggregate":"b","entity":"2","fact":{"Id":"01F0000000BBBBBBBBBBBBBBBB","Timestamp":"2021-03-01T00:00:00Z","OccurredAt":"2021-03-01T00:00:00Z","Content":null,"Hash":"OBtcyngIf1qLiaG/IMVMDh4JGoDDjO6xc0WfZe/AEUc="}}
+`
+	in := filepath.Join(dir, "in.ndjson")
+	if err := ioutil.WriteFile(in, []byte(dump), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runCommand("import", []string{"-config", configPath, "-in", in}); code != 0 {
+		t.Fatalf("import exited with %d", code)
+	}
+
+	out := filepath.Join(dir, "out.ndjson")
+	if code := runCommand("export", []string{"-config", configPath, "-out", out}); code != 0 {
+		t.Fatalf("export exited with %d", code)
+	}
+
+	exported, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Check(t, "export", dump, string(exported))
+
+	filtered := filepath.Join(dir, "filtered.ndjson")
+	code := runCommand("export", []string{"-config", configPath, "-out", filtered, "-aggregate", "a", "-from", "2021-01-01T00:00:00Z"})
+	if code != 0 {
+		t.Fatalf("export exited with %d", code)
+	}
+
+	exported, err = ioutil.ReadFile(filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Check(t, "filtered export",
+		`{"aggregate":"a","entity":"1","fact":{"Id":"01F0000000AAAAAAAAAAAAAAAA","Timestamp":"2021-03-01T00:00:00Z","OccurredAt":"2021-03-01T00:00:00Z","Content":{"n":2},"Hash":"lIGa+DD9pawUaDHyYhQ/Tc4QohkCXfO5soSZN9ogRdg="}}`+"\n",
+		string(exported))
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code := runCommand("defrag", nil); code == 0 {
+		t.Error("expected an unknown command to fail")
+	}
+}
@@ -18,26 +18,85 @@ package main
 
 import (
 	"fmt"
+	"github.com/D-Haven/fact-totem/cluster"
+	"github.com/D-Haven/fact-totem/eventstore"
 	"github.com/D-Haven/fact-totem/permissions"
 	"gopkg.in/yaml.v3"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"sort"
 	"time"
 )
 
 type Config struct {
 	// EventStore Badger DB settings
 	EventStore struct {
+		// Driver selects the storage engine: badger (default) or bolt
+		Driver string `yaml:"driver"`
 		// Path to the database files
 		Path string `yaml:"path"`
 		// EncryptionKey file to turn on encryption at rest.
 		// See https://dgraph.io/blog/post/encryption-at-rest-dgraph-badger/
 		EncryptionKey string `yaml:"encryption-key"`
+		// EncryptionKeyEnv names the environment variable holding the encryption key, instead of a file
+		EncryptionKeyEnv string `yaml:"encryption-key-env"`
 		// KeyDuration automatic key rotation schedule, defaults to 10 days
 		KeyDuration time.Duration `yaml:"key-duration"`
+		// NodeId starts the random part of every fact id, so several writers never create the same id
+		NodeId uint16 `yaml:"node-id"`
+		// RawContent keeps the posted JSON content verbatim instead of decoding it
+		RawContent bool `yaml:"raw-content"`
+		// Compression codec for fact content: none, snappy or zstd
+		Compression string `yaml:"compression"`
+		// CompressionThreshold is the minimum fact size in bytes before it is compressed
+		CompressionThreshold int `yaml:"compression-threshold"`
+		// Indexes maps each aggregate to its secondary indexes, by name, and the JSON path each one indexes
+		Indexes map[string]map[string]string `yaml:"indexes"`
+		// Search maps each searchable aggregate to the JSON paths of the text to search
+		Search map[string][]string `yaml:"search"`
+		// EntityIds maps aggregates to the format of the entity ids AppendNew generates: ulid (the default), uuid,
+		// or a pattern such as order-{ulid}
+		EntityIds map[string]string `yaml:"entity-ids"`
+		// Backup schedule, turned on by setting the directory
+		Backup struct {
+			// Dir receives the backup files
+			Dir string `yaml:"dir"`
+			// Interval between backups, defaults to 24 hours
+			Interval time.Duration `yaml:"interval"`
+			// Keep is the number of backups kept, defaults to 7
+			Keep int `yaml:"keep"`
+		} `yaml:"backup"`
+		// Checkpoint signing, turned on by setting the signing key
+		Checkpoint struct {
+			// SigningKey is a PEM encoded PKCS #8 Ed25519 private key file
+			SigningKey string `yaml:"signing-key"`
+			// Interval between checkpoints, defaults to 1 hour
+			Interval time.Duration `yaml:"interval"`
+		} `yaml:"checkpoint"`
+		// Maintenance reclaims disk space, turned on by setting the interval
+		Maintenance struct {
+			// Interval between value log garbage collections
+			Interval time.Duration `yaml:"interval"`
+			// DiscardRatio is the share of stale data before a value log file is rewritten, defaults to 0.5
+			DiscardRatio float64 `yaml:"discard-ratio"`
+		} `yaml:"maintenance"`
 	} `yaml:"event-store"`
+	// Replication settings, a server with a leader is a read only follower
+	Replication struct {
+		// Leader is the base URL of the leader to copy facts from
+		Leader string `yaml:"leader"`
+		// TokenFile holds the bearer token presented to the leader
+		TokenFile string `yaml:"token-file"`
+		// Interval between polls of the leader, defaults to 5 seconds
+		Interval time.Duration `yaml:"interval"`
+		// MaxLag before the follower reports it is not ready, defaults to 1 minute
+		MaxLag time.Duration `yaml:"max-lag"`
+	} `yaml:"replication"`
+	// Cluster settings, replicates every append with Raft across the members
+	Cluster cluster.Config `yaml:"cluster"`
 	// Token configuration for JWT validation
 	Permissions permissions.Config `yaml:"permissions"`
 	// Server settings
@@ -106,6 +165,52 @@ func ValidateConfig(config *Config) error {
 	tlsCertSpecified := len(config.Server.TLS.CertFile) > 0
 	tlsKeySpecified := len(config.Server.TLS.KeyFile) > 0
 
+	if err := ValidateDriver(config.EventStore.Driver); err != nil {
+		return err
+	}
+
+	if err := ValidateOptionalFile(config.Replication.TokenFile); err != nil {
+		return err
+	}
+
+	if err := ValidateOptionalFile(config.EventStore.Checkpoint.SigningKey); err != nil {
+		return err
+	}
+
+	if _, err := eventstore.ParseCompression(config.EventStore.Compression); err != nil {
+		return err
+	}
+
+	if _, err := config.EncryptionKey(); err != nil {
+		return err
+	}
+
+	if _, err := config.Indexes(); err != nil {
+		return err
+	}
+
+	if _, err := config.SearchIndexes(); err != nil {
+		return err
+	}
+
+	if _, err := config.EntityIds(); err != nil {
+		return err
+	}
+
+	if ratio := config.EventStore.Maintenance.DiscardRatio; ratio < 0 || ratio >= 1 {
+		return fmt.Errorf("maintenance discard-ratio must be between 0 and 1")
+	}
+
+	if config.Cluster.Enabled {
+		if len(config.Replication.Leader) > 0 {
+			return fmt.Errorf("a cluster member cannot also follow a replication leader")
+		}
+
+		if err := config.Cluster.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if !tlsCertSpecified && !tlsKeySpecified {
 		return nil
 	}
@@ -129,6 +234,105 @@ func ValidateConfig(config *Config) error {
 	return nil
 }
 
+func ValidateDriver(driver string) error {
+	if len(driver) == 0 {
+		return nil
+	}
+
+	for _, name := range eventstore.Drivers() {
+		if name == driver {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown event store driver '%s', expected one of %v", driver, eventstore.Drivers())
+}
+
+// EncryptionKey loads the event store's encryption key from the environment or the key file.  The key is
+// AES-128, AES-192 or AES-256 in raw, hex or base64 form; nil means the store is not encrypted.
+func (c *Config) EncryptionKey() ([]byte, error) {
+	env, file := c.EventStore.EncryptionKeyEnv, c.EventStore.EncryptionKey
+
+	switch {
+	case len(env) > 0 && len(file) > 0:
+		return nil, fmt.Errorf("set either encryption-key or encryption-key-env, not both")
+	case len(env) > 0:
+		value, ok := os.LookupEnv(env)
+		if !ok || len(value) == 0 {
+			return nil, fmt.Errorf("the encryption key environment variable %s is not set", env)
+		}
+
+		return eventstore.ParseEncryptionKey([]byte(value))
+	case len(file) > 0:
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		return eventstore.ParseEncryptionKey(content)
+	}
+
+	return nil, nil
+}
+
+// Indexes parses the secondary indexes, sorted by aggregate and name
+func (c *Config) Indexes() ([]eventstore.Index, error) {
+	var indexes []eventstore.Index
+	for aggregate, named := range c.EventStore.Indexes {
+		for name, path := range named {
+			index, err := eventstore.NewIndex(aggregate, name, path)
+			if err != nil {
+				return nil, err
+			}
+
+			indexes = append(indexes, index)
+		}
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		if indexes[i].Aggregate != indexes[j].Aggregate {
+			return indexes[i].Aggregate < indexes[j].Aggregate
+		}
+		return indexes[i].Name < indexes[j].Name
+	})
+
+	return indexes, nil
+}
+
+// SearchIndexes parses the full text indexes, sorted by aggregate
+func (c *Config) SearchIndexes() ([]eventstore.SearchIndex, error) {
+	var indexes []eventstore.SearchIndex
+	for aggregate, paths := range c.EventStore.Search {
+		index, err := eventstore.NewSearchIndex(aggregate, paths...)
+		if err != nil {
+			return nil, err
+		}
+
+		indexes = append(indexes, index)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Aggregate < indexes[j].Aggregate
+	})
+
+	return indexes, nil
+}
+
+// EntityIds parses the entity id formats of the aggregates
+func (c *Config) EntityIds() (map[string]eventstore.EntityIdFormat, error) {
+	formats := map[string]eventstore.EntityIdFormat{}
+	for aggregate, format := range c.EventStore.EntityIds {
+		parsed, err := eventstore.ParseEntityIdFormat(format)
+		if err != nil {
+			return nil, err
+		}
+
+		formats[aggregate] = parsed
+	}
+
+	return formats, nil
+}
+
 func ValidateOptionalFile(path string) error {
 	if len(path) > 0 {
 		fileInfo, err := os.Stat(path)
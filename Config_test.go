@@ -17,7 +17,11 @@
 package main
 
 import (
+	"fmt"
+	"github.com/D-Haven/fact-totem/cluster"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -118,6 +122,26 @@ func TestValidateConfigWithBothCertAndKeyValidFiles(t *testing.T) {
 	}
 }
 
+func TestValidateConfigRejectsUnknownCompression(t *testing.T) {
+	config := &Config{}
+	config.EventStore.Compression = "lzma"
+
+	err := ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected error because EventStore:Compression is not a supported codec")
+	}
+}
+
+func TestValidateConfigRejectsUnknownDriver(t *testing.T) {
+	config := &Config{}
+	config.EventStore.Driver = "floppy"
+
+	err := ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected error because EventStore:Driver is not a registered driver")
+	}
+}
+
 func TestValidateOptionalFileIfExists(t *testing.T) {
 	path := "./Logo.go"
 	err := ValidateOptionalFile(path)
@@ -173,3 +197,135 @@ func TestGetValidatedConfigFailure(t *testing.T) {
 	Check(t, "Server:TLS:KeyFile", "", config.Server.TLS.KeyFile)
 	Check(t, "Server:TLS:CertFile", "", config.Server.TLS.CertFile)
 }
+
+func TestValidateConfigRejectsClusteredFollower(t *testing.T) {
+	config := &Config{}
+	config.Replication.Leader = "http://leader:8080"
+	config.Cluster.Enabled = true
+	config.Cluster.NodeId = "node0"
+	config.Cluster.Members = []cluster.Member{{Id: "node0", Raft: "localhost:7000"}}
+
+	err := ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected error because a cluster member cannot follow a replication leader")
+	}
+}
+
+func TestValidateConfigRejectsDiscardRatio(t *testing.T) {
+	config := &Config{}
+	config.EventStore.Maintenance.DiscardRatio = 1.5
+
+	err := ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected error because EventStore:Maintenance:DiscardRatio is above 1")
+	}
+}
+
+func TestValidateConfigRejectsShortEncryptionKey(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "badger.key")
+	if err := ioutil.WriteFile(file, []byte("too short\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{}
+	config.EventStore.EncryptionKey = file
+
+	err := ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected error because EventStore:EncryptionKey is not an AES key")
+	}
+}
+
+func TestConfigEncryptionKeyFromEnvironment(t *testing.T) {
+	previous, set := os.LookupEnv("FACT_TOTEM_TEST_KEY")
+	defer func() {
+		if set {
+			_ = os.Setenv("FACT_TOTEM_TEST_KEY", previous)
+		} else {
+			_ = os.Unsetenv("FACT_TOTEM_TEST_KEY")
+		}
+	}()
+
+	if err := os.Setenv("FACT_TOTEM_TEST_KEY", "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{}
+	config.EventStore.EncryptionKeyEnv = "FACT_TOTEM_TEST_KEY"
+
+	key, err := config.EncryptionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(key) != 32 {
+		t.Errorf("expected the hex key to decode to 32 bytes, received %d", len(key))
+	}
+
+	config.EventStore.EncryptionKey = "badger.key"
+	if _, err := config.EncryptionKey(); err == nil {
+		t.Error("expected an error when both the key file and the environment variable are set")
+	}
+}
+
+func TestConfigIndexes(t *testing.T) {
+	config := &Config{}
+	config.EventStore.Indexes = map[string]map[string]string{
+		"orders":    {"status": "$.Content.status", "customer": "$.Content.customerId"},
+		"customers": {"email": "$.Content.email"},
+	}
+
+	indexes, err := config.Indexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, index := range indexes {
+		names = append(names, index.Aggregate+"."+index.Name)
+	}
+	Check(t, "indexes", "[customers.email orders.customer orders.status]", fmt.Sprint(names))
+
+	config.EventStore.Indexes["orders"]["broken"] = "Content.status"
+	if err := ValidateConfig(config); err == nil {
+		t.Fatal("Expected error because the index path does not start with $")
+	}
+}
+
+func TestConfigSearchIndexes(t *testing.T) {
+	config := &Config{}
+	config.EventStore.Search = map[string][]string{
+		"tickets": {"$.Content.title", "$.Content.notes"},
+	}
+
+	indexes, err := config.SearchIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Check(t, "search", "tickets [$.Content.title $.Content.notes]", fmt.Sprint(indexes[0].Aggregate, " ", indexes[0].Paths))
+
+	config.EventStore.Search["people"] = nil
+	if err := ValidateConfig(config); err == nil {
+		t.Fatal("Expected error because a search index needs a path")
+	}
+}
+
+func TestConfigEntityIds(t *testing.T) {
+	config := &Config{}
+	config.EventStore.EntityIds = map[string]string{
+		"orders":    "order-{ulid}",
+		"customers": "uuid",
+	}
+
+	formats, err := config.EntityIds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Check(t, "orders", "order- ulid", fmt.Sprint(formats["orders"].Prefix, " ", formats["orders"].Kind))
+	Check(t, "customers", "uuid", formats["customers"].Kind)
+
+	config.EventStore.EntityIds["people"] = "{guid}"
+	if err := ValidateConfig(config); err == nil {
+		t.Fatal("Expected error because the entity id format is unknown")
+	}
+}
@@ -17,20 +17,33 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/D-Haven/fact-totem/cluster"
+	"github.com/D-Haven/fact-totem/eventstore"
 	"github.com/D-Haven/fact-totem/version"
 	"github.com/D-Haven/fact-totem/webapi"
 	"github.com/heptiolabs/healthcheck"
 	"golang.org/x/net/context"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 )
 
 const appName = "Fact-Totem"
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	err := ShowLogo(log.Writer())
 	if err != nil {
 		log.Fatalf("Error printing logo: %s", err)
@@ -105,17 +118,126 @@ func configureServer(config *Config) (*http.Server, error) {
 	multiplexHandler.Handle("/ready", health)
 	multiplexHandler.Handle("/live", health)
 
-	projectApi, err := webapi.NewApi(config.EventStore.Path, config.EventStore.EncryptionKey, config.EventStore.KeyDuration)
+	projectApi, err := openApi(config)
 	if err != nil {
 		return nil, err
 	}
 
+	stopBackups := func() {}
+	if len(config.EventStore.Backup.Dir) > 0 {
+		schedule, err := configureBackups(config, projectApi)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopBackups = cancel
+		go schedule.Run(ctx)
+
+		log.Printf("Backing up to %s every %s", schedule.Dir, schedule.Interval)
+	}
+
+	projectApi.DiscardRatio = config.EventStore.Maintenance.DiscardRatio
+	if projectApi.DiscardRatio <= 0 {
+		projectApi.DiscardRatio = eventstore.DefaultDiscardRatio
+	}
+
+	stopMaintenance := func() {}
+	if config.EventStore.Maintenance.Interval > 0 {
+		schedule, err := configureMaintenance(config, projectApi)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopMaintenance = cancel
+		go schedule.Run(ctx)
+
+		log.Printf("Collecting value log garbage every %s", schedule.Interval)
+	}
+
+	stopCheckpoints := func() {}
+	if len(config.EventStore.Checkpoint.SigningKey) > 0 {
+		schedule, err := configureCheckpoints(config, projectApi)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopCheckpoints = cancel
+		go schedule.Run(ctx)
+
+		log.Printf("Signing checkpoints every %s", schedule.Interval)
+	}
+
+	if config.Cluster.Enabled {
+		node, err := cluster.NewNode(config.Cluster, projectApi.EventStore, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		projectApi.EventStore = node
+		health.AddReadinessCheck("cluster-leader", node.ReadinessCheck)
+		log.Printf("Joined cluster as %s", config.Cluster.NodeId)
+	}
+
 	authHandler := webapi.AuthHandler{
 		Handler:    projectApi.Handle,
 		UserConfig: config.Permissions,
 	}
 
+	replicationHandler := webapi.AuthHandler{
+		Handler:    projectApi.HandleReplication,
+		UserConfig: config.Permissions,
+	}
+
+	backupHandler := webapi.AuthHandler{
+		Handler:    projectApi.HandleBackup,
+		UserConfig: config.Permissions,
+	}
+
+	restoreHandler := webapi.AuthHandler{
+		Handler:    projectApi.HandleRestore,
+		UserConfig: config.Permissions,
+	}
+
+	exportHandler := webapi.AuthHandler{
+		Handler:    projectApi.HandleExport,
+		UserConfig: config.Permissions,
+	}
+
+	importHandler := webapi.AuthHandler{
+		Handler:    projectApi.HandleImport,
+		UserConfig: config.Permissions,
+	}
+
+	compactHandler := webapi.AuthHandler{
+		Handler:    projectApi.HandleCompact,
+		UserConfig: config.Permissions,
+	}
+
 	multiplexHandler.Handle("/", &authHandler)
+	multiplexHandler.Handle(webapi.ReplicationPath, &replicationHandler)
+	multiplexHandler.Handle(webapi.BackupPath, &backupHandler)
+	multiplexHandler.Handle(webapi.RestorePath, &restoreHandler)
+	multiplexHandler.Handle(webapi.ExportPath, &exportHandler)
+	multiplexHandler.Handle(webapi.ImportPath, &importHandler)
+	multiplexHandler.Handle(webapi.CompactPath, &compactHandler)
+
+	stopReplication := func() {}
+	if len(config.Replication.Leader) > 0 {
+		follower, err := configureFollower(config, projectApi)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopReplication = cancel
+		go follower.Run(ctx)
+
+		health.AddReadinessCheck("replication-lag", follower.ReadinessCheck(config.Replication.MaxLag))
+		log.Printf("Following leader %s", config.Replication.Leader)
+	}
 
 	server := &http.Server{
 		Addr:    config.Server.Host + ":" + config.Server.Port,
@@ -123,6 +245,11 @@ func configureServer(config *Config) (*http.Server, error) {
 	}
 
 	server.RegisterOnShutdown(func() {
+		stopReplication()
+		stopBackups()
+		stopCheckpoints()
+		stopMaintenance()
+
 		err := projectApi.Close()
 		if err != nil {
 			log.Fatal(err)
@@ -131,3 +258,178 @@ func configureServer(config *Config) (*http.Server, error) {
 
 	return server, nil
 }
+
+// openApi opens the configured event store
+func openApi(config *Config) (*webapi.FactApi, error) {
+	compression, err := eventstore.ParseCompression(config.EventStore.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := config.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []eventstore.Option{eventstore.WithCompression(compression, config.EventStore.CompressionThreshold)}
+	if config.EventStore.NodeId != 0 {
+		opts = append(opts, eventstore.WithIdGenerator(eventstore.NewNodeIdGenerator(config.EventStore.NodeId)))
+	}
+
+	indexes, err := config.Indexes()
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) > 0 {
+		opts = append(opts, eventstore.WithIndexes(indexes...))
+	}
+
+	searchIndexes, err := config.SearchIndexes()
+	if err != nil {
+		return nil, err
+	}
+	if len(searchIndexes) > 0 {
+		opts = append(opts, eventstore.WithSearch(searchIndexes...))
+	}
+
+	entityIds, err := config.EntityIds()
+	if err != nil {
+		return nil, err
+	}
+	for aggregate, format := range entityIds {
+		opts = append(opts, eventstore.WithEntityIds(aggregate, format))
+	}
+
+	projectApi, err := webapi.NewApi(config.EventStore.Driver, config.EventStore.Path, key, config.EventStore.KeyDuration, opts...)
+	if err != nil {
+		return nil, err
+	}
+	projectApi.RawContent = config.EventStore.RawContent
+
+	return projectApi, nil
+}
+
+func configureBackups(config *Config, projectApi *webapi.FactApi) (*eventstore.BackupSchedule, error) {
+	backuper, ok := projectApi.EventStore.(eventstore.Backuper)
+	if !ok {
+		return nil, fmt.Errorf("the '%s' event store driver does not support backups", config.EventStore.Driver)
+	}
+
+	schedule := &eventstore.BackupSchedule{
+		Store:    backuper,
+		Dir:      config.EventStore.Backup.Dir,
+		Interval: config.EventStore.Backup.Interval,
+		Keep:     config.EventStore.Backup.Keep,
+	}
+
+	if schedule.Interval <= 0 {
+		schedule.Interval = 24 * time.Hour
+	}
+
+	if schedule.Keep <= 0 {
+		schedule.Keep = 7
+	}
+
+	return schedule, nil
+}
+
+func configureMaintenance(config *Config, projectApi *webapi.FactApi) (*eventstore.MaintenanceSchedule, error) {
+	maintainer, ok := projectApi.EventStore.(eventstore.Maintainer)
+	if !ok {
+		return nil, fmt.Errorf("the '%s' event store driver does not support maintenance", config.EventStore.Driver)
+	}
+
+	schedule := &eventstore.MaintenanceSchedule{
+		Store:        maintainer,
+		Interval:     config.EventStore.Maintenance.Interval,
+		DiscardRatio: projectApi.DiscardRatio,
+	}
+
+	return schedule, nil
+}
+
+func configureCheckpoints(config *Config, projectApi *webapi.FactApi) (*eventstore.CheckpointSchedule, error) {
+	checkpointer, ok := projectApi.EventStore.(eventstore.Checkpointer)
+	if !ok {
+		return nil, fmt.Errorf("the '%s' event store driver does not support checkpoints", config.EventStore.Driver)
+	}
+
+	key, err := readSigningKey(config.EventStore.Checkpoint.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	projectApi.CheckpointKey = key.Public().(ed25519.PublicKey)
+
+	schedule := &eventstore.CheckpointSchedule{
+		Store:    checkpointer,
+		Key:      key,
+		Interval: config.EventStore.Checkpoint.Interval,
+	}
+
+	if schedule.Interval <= 0 {
+		schedule.Interval = time.Hour
+	}
+
+	return schedule, nil
+}
+
+// readSigningKey reads a PEM encoded PKCS #8 Ed25519 private key, as written by
+// "openssl genpkey -algorithm ed25519"
+func readSigningKey(file string) (ed25519.PrivateKey, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", file)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 private key", file)
+	}
+
+	return signingKey, nil
+}
+
+func configureFollower(config *Config, projectApi *webapi.FactApi) (*webapi.Follower, error) {
+	replicator, ok := projectApi.EventStore.(eventstore.Replicator)
+	if !ok {
+		return nil, fmt.Errorf("the '%s' event store driver does not support replication", config.EventStore.Driver)
+	}
+
+	projectApi.Leader = config.Replication.Leader
+
+	follower := &webapi.Follower{
+		Leader:   config.Replication.Leader,
+		Interval: config.Replication.Interval,
+		Store:    replicator,
+	}
+
+	if len(config.Replication.TokenFile) > 0 {
+		token, err := ioutil.ReadFile(config.Replication.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+
+		follower.Token = strings.TrimSpace(string(token))
+	}
+
+	if follower.Interval <= 0 {
+		follower.Interval = 5 * time.Second
+	}
+
+	if config.Replication.MaxLag <= 0 {
+		config.Replication.MaxLag = time.Minute
+	}
+
+	return follower, nil
+}
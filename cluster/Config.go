@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cluster replicates an event store across a group of servers with Raft.  Every append is
+// committed by a majority of the members before it is acknowledged, so any member can take over as
+// leader without losing facts.
+package cluster
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Linearizable reads confirm leadership with the cluster before reading, they always see the
+	// latest committed fact but only the leader can serve them.
+	Linearizable = "linearizable"
+	// Stale reads are served from the local copy of any member and may lag behind the leader.
+	Stale = "stale"
+)
+
+type Config struct {
+	// Enabled turns on clustered mode
+	Enabled bool `yaml:"enabled"`
+	// NodeId identifies this server, it must match one of the members
+	NodeId string `yaml:"node-id"`
+	// Bind is the local address for Raft traffic, defaults to the member's raft address
+	Bind string `yaml:"bind"`
+	// Path to the Raft log and snapshots, in memory when empty
+	Path string `yaml:"path"`
+	// Bootstrap forms a new cluster from the members when there is no existing Raft state
+	Bootstrap bool `yaml:"bootstrap"`
+	// ReadConsistency is linearizable (default) or stale
+	ReadConsistency string `yaml:"read-consistency"`
+	// ApplyTimeout is how long an append waits to be committed, defaults to 10 seconds
+	ApplyTimeout time.Duration `yaml:"apply-timeout"`
+	// HeartbeatTimeout before a follower starts an election, defaults to 1 second
+	HeartbeatTimeout time.Duration `yaml:"heartbeat-timeout"`
+	// ElectionTimeout before a candidate starts a new election, defaults to 1 second
+	ElectionTimeout time.Duration `yaml:"election-timeout"`
+	// LogLevel of the Raft library, defaults to info
+	LogLevel string `yaml:"log-level"`
+	// Members of the cluster
+	Members []Member `yaml:"members"`
+}
+
+type Member struct {
+	// Id of the member
+	Id string `yaml:"id"`
+	// Raft address other members connect to
+	Raft string `yaml:"raft"`
+	// Api is the base URL clients are redirected to when the member is the leader
+	Api string `yaml:"api"`
+}
+
+// Validate checks the configuration can form a cluster
+func (c *Config) Validate() error {
+	if len(c.NodeId) == 0 {
+		return Error("cluster node-id is required")
+	}
+
+	switch c.ReadConsistency {
+	case "", Linearizable, Stale:
+	default:
+		return Error(fmt.Sprintf("unsupported read consistency: %s", c.ReadConsistency))
+	}
+
+	ids := make(map[string]bool)
+	for _, m := range c.Members {
+		if len(m.Id) == 0 || len(m.Raft) == 0 {
+			return Error("cluster members need an id and a raft address")
+		}
+
+		if ids[m.Id] {
+			return Error(fmt.Sprintf("duplicate cluster member: %s", m.Id))
+		}
+		ids[m.Id] = true
+	}
+
+	if _, ok := c.member(c.NodeId); !ok {
+		return Error(fmt.Sprintf("node %s is not a cluster member", c.NodeId))
+	}
+
+	return nil
+}
+
+func (c *Config) member(id string) (Member, bool) {
+	for _, m := range c.Members {
+		if m.Id == id {
+			return m, true
+		}
+	}
+
+	return Member{}, false
+}
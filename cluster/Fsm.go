@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/hashicorp/raft"
+)
+
+// command is a fact appended by the leader, replayed on every member in log order.  A new command
+// only appends the fact when it creates the entity, and a relabel command replaces the entity's
+// labels instead.
+type command struct {
+	Aggregate string
+	Entity    string
+	Fact      eventstore.Fact
+	// Subject is recorded as the creator of a new entity
+	Subject string
+	New     bool
+	Relabel bool
+	Labels  map[string]string
+}
+
+// result is what applying a command returns to the leader waiting on it
+type result struct {
+	tail *eventstore.Tail
+	info *eventstore.EntityInfo
+	err  error
+}
+
+// fsm stores the committed facts in the local event store.  The facts keep the id and timestamp
+// the leader gave them, so every member holds exactly the same data.
+type fsm struct {
+	importer   eventstore.Importer
+	replicator eventstore.Replicator
+}
+
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var cmd command
+	if err := gob.NewDecoder(bytes.NewReader(log.Data)).Decode(&cmd); err != nil {
+		return result{err: err}
+	}
+
+	if cmd.Relabel {
+		labeler, ok := f.importer.(eventstore.Labeler)
+		if !ok {
+			return result{err: Error("the event store does not label entities")}
+		}
+
+		info, err := labeler.SetLabels(cmd.Aggregate, cmd.Entity, cmd.Labels)
+		return result{info: info, err: err}
+	}
+
+	if cmd.New {
+		importer, ok := f.importer.(eventstore.NewEntityImporter)
+		if !ok {
+			return result{err: Error("the event store does not create entities")}
+		}
+
+		tail, err := importer.AppendNewFact(cmd.Aggregate, cmd.Entity, cmd.Fact, cmd.Subject)
+		return result{tail: tail, err: err}
+	}
+
+	if importer, ok := f.importer.(eventstore.SubjectImporter); ok {
+		tail, err := importer.AppendFactBy(cmd.Aggregate, cmd.Entity, cmd.Fact, cmd.Subject)
+		return result{tail: tail, err: err}
+	}
+
+	tail, err := f.importer.AppendFact(cmd.Aggregate, cmd.Entity, cmd.Fact)
+	return result{tail: tail, err: err}
+}
+
+// Snapshot copies the whole store when Raft persists it.  The copy may hold facts committed after
+// the snapshot was requested, that is harmless because replaying a stored fact does nothing.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &snapshot{replicator: f.replicator}, nil
+}
+
+// Restore writes the snapshot over the local store.  The local facts are always a prefix of the
+// committed log, so they never conflict with the snapshot and do not need to be discarded first.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	_, err := f.replicator.ApplyChanges(rc)
+	return err
+}
+
+type snapshot struct {
+	replicator eventstore.Replicator
+}
+
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := s.replicator.Changes(sink, 0); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *snapshot) Release() {}
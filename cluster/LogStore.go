@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/hashicorp/raft"
+)
+
+const errNotFound = Error("not found")
+
+var (
+	logPrefix    = []byte("log|")
+	stablePrefix = []byte("stable|")
+)
+
+// LogStore keeps the Raft log and the Raft election state in its own Badger database
+type LogStore struct {
+	db *badger.DB
+}
+
+var _ raft.LogStore = (*LogStore)(nil)
+var _ raft.StableStore = (*LogStore)(nil)
+
+// NewLogStore opens the log in dir, an empty dir keeps the log in memory.  Writes are synced to disk
+// before they return: Raft counts an entry or a vote as kept once it is stored, and a member that
+// forgets either after a crash can lose committed facts or vote twice in a term.
+func NewLogStore(dir string) (*LogStore, error) {
+	opt := badger.DefaultOptions(dir).WithLogger(nil).WithSyncWrites(true)
+	if len(dir) == 0 {
+		opt = opt.WithInMemory(true)
+	}
+
+	db, err := badger.Open(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogStore{db: db}, nil
+}
+
+func (s *LogStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *LogStore) FirstIndex() (uint64, error) {
+	return s.edgeIndex(false)
+}
+
+func (s *LogStore) LastIndex() (uint64, error) {
+	return s.edgeIndex(true)
+}
+
+func (s *LogStore) edgeIndex(reverse bool) (uint64, error) {
+	var index uint64
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Reverse = reverse
+		opt.Prefix = logPrefix
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		seek := logPrefix
+		if reverse {
+			seek = logKey(^uint64(0))
+		}
+
+		it.Seek(seek)
+		if it.ValidForPrefix(logPrefix) {
+			index = binary.BigEndian.Uint64(it.Item().Key()[len(logPrefix):])
+		}
+
+		return nil
+	})
+
+	return index, err
+}
+
+func (s *LogStore) GetLog(index uint64, log *raft.Log) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(logKey(index))
+		if err == badger.ErrKeyNotFound {
+			return raft.ErrLogNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return gob.NewDecoder(bytes.NewReader(val)).Decode(log)
+		})
+	})
+}
+
+func (s *LogStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+func (s *LogStore) StoreLogs(logs []*raft.Log) error {
+	batch := s.db.NewWriteBatch()
+	defer batch.Cancel()
+
+	for _, log := range logs {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(log); err != nil {
+			return err
+		}
+
+		if err := batch.Set(logKey(log.Index), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return batch.Flush()
+}
+
+func (s *LogStore) DeleteRange(min, max uint64) error {
+	batch := s.db.NewWriteBatch()
+	defer batch.Cancel()
+
+	for index := min; index <= max && index >= min; index++ {
+		if err := batch.Delete(logKey(index)); err != nil {
+			return err
+		}
+	}
+
+	return batch.Flush()
+}
+
+func (s *LogStore) Set(key []byte, val []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(stableKey(key), val)
+	})
+}
+
+// Get fails with "not found" for unknown keys, the error Raft expects from a new store
+func (s *LogStore) Get(key []byte) ([]byte, error) {
+	var val []byte
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(stableKey(key))
+		if err == badger.ErrKeyNotFound {
+			return errNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+
+	return val, err
+}
+
+func (s *LogStore) SetUint64(key []byte, val uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, val)
+	return s.Set(key, buf)
+}
+
+func (s *LogStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err == errNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(val), nil
+}
+
+func logKey(index uint64) []byte {
+	key := make([]byte, len(logPrefix)+8)
+	copy(key, logPrefix)
+	binary.BigEndian.PutUint64(key[len(logPrefix):], index)
+	return key
+}
+
+func stableKey(key []byte) []byte {
+	return append(append([]byte{}, stablePrefix...), key...)
+}
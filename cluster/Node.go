@@ -0,0 +1,797 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/gob"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/hashicorp/raft"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	defaultApplyTimeout = 10 * time.Second
+	retainSnapshots     = 2
+	maxPool             = 3
+	dialTimeout         = 10 * time.Second
+	appliedPollInterval = time.Millisecond
+)
+
+const errApplyTimeout = Error("timed out waiting for the committed facts to be applied")
+
+// Node is a cluster member.  It is an eventstore.EventStore that sends appends through the Raft log
+// and reads from the local store once it has caught up with the cluster.
+type Node struct {
+	config    Config
+	store     eventstore.EventStore
+	raft      *raft.Raft
+	logs      *LogStore
+	transport raft.Transport
+	maker     eventstore.FactMaker
+	// mu keeps the ids in log order: facts are submitted to Raft in the order their ids were generated
+	mu sync.Mutex
+	// term is the leadership term the local store last caught up in, issued the last id submitted
+	term   string
+	issued ulid.ULID
+}
+
+var _ eventstore.EventStore = (*Node)(nil)
+
+// NewNode joins the cluster described by config with the local store.  The store must implement
+// eventstore.Importer, eventstore.Replicator and eventstore.FactMaker.  When transport is nil the node listens for Raft
+// traffic over TCP on its member address.
+func NewNode(config Config, store eventstore.EventStore, transport raft.Transport) (*Node, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	importer, ok := store.(eventstore.Importer)
+	if !ok {
+		return nil, Error("the event store cannot import facts, it cannot be clustered")
+	}
+
+	replicator, ok := store.(eventstore.Replicator)
+	if !ok {
+		return nil, Error("the event store cannot be replicated, it cannot be clustered")
+	}
+
+	maker, ok := store.(eventstore.FactMaker)
+	if !ok {
+		return nil, Error("the event store cannot create facts, it cannot be clustered")
+	}
+
+	if transport == nil {
+		t, err := config.tcpTransport()
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	}
+
+	logDir, snapshots, err := config.snapshotStore()
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := NewLogStore(logDir)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := raft.NewRaft(config.raftConfig(), &fsm{importer: importer, replicator: replicator}, logs, logs, snapshots, transport)
+	if err != nil {
+		_ = logs.Close()
+		return nil, err
+	}
+
+	n := &Node{
+		config:    config,
+		store:     store,
+		raft:      r,
+		logs:      logs,
+		transport: transport,
+		maker:     maker,
+	}
+
+	if config.Bootstrap {
+		if err := n.bootstrap(snapshots); err != nil {
+			_ = n.shutdown()
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+func (c *Config) tcpTransport() (raft.Transport, error) {
+	self, _ := c.member(c.NodeId)
+
+	advertise, err := net.ResolveTCPAddr("tcp", self.Raft)
+	if err != nil {
+		return nil, err
+	}
+
+	bind := c.Bind
+	if len(bind) == 0 {
+		bind = self.Raft
+	}
+
+	return raft.NewTCPTransport(bind, advertise, maxPool, dialTimeout, os.Stderr)
+}
+
+// snapshotStore returns the Raft log directory and the snapshot store, both in memory without a path
+func (c *Config) snapshotStore() (string, raft.SnapshotStore, error) {
+	if len(c.Path) == 0 {
+		return "", raft.NewInmemSnapshotStore(), nil
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(c.Path, retainSnapshots, os.Stderr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return filepath.Join(c.Path, "log"), snapshots, nil
+}
+
+func (c *Config) raftConfig() *raft.Config {
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(c.NodeId)
+
+	if c.HeartbeatTimeout > 0 {
+		conf.HeartbeatTimeout = c.HeartbeatTimeout
+		if conf.LeaderLeaseTimeout > c.HeartbeatTimeout {
+			conf.LeaderLeaseTimeout = c.HeartbeatTimeout
+		}
+	}
+
+	if c.ElectionTimeout > 0 {
+		conf.ElectionTimeout = c.ElectionTimeout
+	}
+
+	if len(c.LogLevel) > 0 {
+		conf.LogLevel = c.LogLevel
+	}
+
+	return conf
+}
+
+func (n *Node) bootstrap(snapshots raft.SnapshotStore) error {
+	existing, err := raft.HasExistingState(n.logs, n.logs, snapshots)
+	if err != nil || existing {
+		return err
+	}
+
+	var servers []raft.Server
+	for _, m := range n.config.Members {
+		servers = append(servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(m.Id),
+			Address:  raft.ServerAddress(m.Raft),
+		})
+	}
+
+	return n.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+}
+
+func (n *Node) Register(t interface{}) {
+	n.store.Register(t)
+}
+
+// Append gives the fact its id and timestamp on the leader and returns once a majority of the
+// members stored it.  Other members return NotLeader.
+func (n *Node) Append(aggregate string, entity string, content interface{}) (*eventstore.Tail, error) {
+	return n.AppendWith(aggregate, entity, content, eventstore.Metadata{})
+}
+
+// AppendOccurred appends content that happened at occurredAt, or now when it is zero
+func (n *Node) AppendOccurred(aggregate string, entity string, occurredAt time.Time, content interface{}) (*eventstore.Tail, error) {
+	return n.AppendWith(aggregate, entity, content, eventstore.Metadata{OccurredAt: occurredAt})
+}
+
+// AppendWith appends content with the metadata, see Append
+func (n *Node) AppendWith(aggregate string, entity string, content interface{}, metadata eventstore.Metadata) (*eventstore.Tail, error) {
+	if err := validateMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	return n.apply(aggregate, entity, metadata.Subject, func() (eventstore.Fact, error) {
+		return n.newFact(aggregate, entity, content, metadata)
+	})
+}
+
+// AppendNew generates the id of a new entity on the leader and appends content as its first fact.  Every
+// member refuses to create an entity that already has facts, so the id is never reused.
+func (n *Node) AppendNew(aggregate string, content interface{}, metadata eventstore.Metadata) (string, *eventstore.Tail, error) {
+	importer, ok := n.store.(eventstore.NewEntityImporter)
+	if !ok {
+		return "", nil, Error("the event store does not create entities")
+	}
+
+	if err := validateMetadata(metadata); err != nil {
+		return "", nil, err
+	}
+
+	entity, err := importer.NewEntityId(aggregate)
+	if err != nil {
+		return "", nil, err
+	}
+
+	applied, err := n.commit(func() (command, error) {
+		fact, err := n.newFact(aggregate, entity, content, metadata)
+		return command{Aggregate: aggregate, Entity: entity, Fact: fact, Subject: metadata.Subject, New: true}, err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if applied.err != nil {
+		return "", nil, applied.err
+	}
+
+	return entity, applied.tail, nil
+}
+
+func validateMetadata(metadata eventstore.Metadata) error {
+	for _, tag := range metadata.Tags {
+		if err := eventstore.ValidateTag(tag); err != nil {
+			return err
+		}
+	}
+
+	return eventstore.ValidateCorrelationId(metadata.CorrelationId)
+}
+
+// newFact gives the content its id and timestamp the way the store does, following both the entity's tail
+// and the facts still in flight.  It is called with the submit lock held, once the store has caught up.
+func (n *Node) newFact(aggregate string, entity string, content interface{}, metadata eventstore.Metadata) (eventstore.Fact, error) {
+	last := n.issued
+
+	tail, err := n.store.Tail(aggregate, entity)
+	if err != nil {
+		if _, ok := err.(eventstore.EntityNotFound); !ok {
+			return eventstore.Fact{}, err
+		}
+	} else if tail.Fact.Id.Compare(last) > 0 {
+		last = tail.Fact.Id
+	}
+
+	fact := n.maker.NewFact(last, content, metadata)
+	n.issued = fact.Id
+
+	return fact, nil
+}
+
+// AppendFact commits a fact created elsewhere, keeping its id and timestamp
+func (n *Node) AppendFact(aggregate string, entity string, fact eventstore.Fact) (*eventstore.Tail, error) {
+	return n.AppendFactBy(aggregate, entity, fact, "")
+}
+
+// AppendFactBy commits a fact created elsewhere, recording the subject as the creator of a new entity
+func (n *Node) AppendFactBy(aggregate string, entity string, fact eventstore.Fact, subject string) (*eventstore.Tail, error) {
+	return n.apply(aggregate, entity, subject, func() (eventstore.Fact, error) {
+		return fact, nil
+	})
+}
+
+// SetLabels commits new labels for the entity
+func (n *Node) SetLabels(aggregate string, entity string, labels map[string]string) (*eventstore.EntityInfo, error) {
+	if _, ok := n.store.(eventstore.Labeler); !ok {
+		return nil, Error("the event store does not label entities")
+	}
+	if err := eventstore.ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+
+	applied, err := n.commit(func() (command, error) {
+		return command{Aggregate: aggregate, Entity: entity, Relabel: true, Labels: labels}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return applied.info, applied.err
+}
+
+func (n *Node) apply(aggregate string, entity string, subject string, newFact func() (eventstore.Fact, error)) (*eventstore.Tail, error) {
+	applied, err := n.commit(func() (command, error) {
+		fact, err := newFact()
+		return command{Aggregate: aggregate, Entity: entity, Fact: fact, Subject: subject}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return applied.tail, applied.err
+}
+
+// commit waits for the command to be applied to the local store
+func (n *Node) commit(newCommand func() (command, error)) (result, error) {
+	future, err := n.submit(newCommand)
+	if err != nil {
+		return result{}, err
+	}
+
+	if err := future.Error(); err != nil {
+		return result{}, n.raftError(err)
+	}
+
+	return future.Response().(result), nil
+}
+
+func (n *Node) submit(newCommand func() (command, error)) (raft.ApplyFuture, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.raft.State() != raft.Leader {
+		return nil, n.notLeader()
+	}
+
+	if err := n.settleTerm(n.raft.Stats()["term"]); err != nil {
+		return nil, err
+	}
+
+	cmd, err := newCommand()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&cmd); err != nil {
+		return nil, err
+	}
+
+	return n.raft.Apply(buf.Bytes(), n.applyTimeout()), nil
+}
+
+func (n *Node) Read(aggregate string, entity string, originEventId string, maxCount int) (*eventstore.RecordList, error) {
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return n.store.Read(aggregate, entity, originEventId, maxCount)
+}
+
+// ReadFiltered reads the matching facts from the local store when it can filter them
+func (n *Node) ReadFiltered(aggregate string, entity string, originEventId string, maxCount int, filter eventstore.ReadFilter) (*eventstore.RecordList, error) {
+	reader, ok := n.store.(eventstore.FilteredReader)
+	if !ok {
+		return nil, Error("the event store does not filter reads")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return reader.ReadFiltered(aggregate, entity, originEventId, maxCount, filter)
+}
+
+func (n *Node) Get(aggregate string, entity string, factId string) (*eventstore.Fact, error) {
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return n.store.Get(aggregate, entity, factId)
+}
+
+// ScanModified lists the modified entities in the local store when it indexes them
+func (n *Node) ScanModified(aggregate string, since time.Time) ([]eventstore.ModifiedEntity, error) {
+	scanner, ok := n.store.(eventstore.ModifiedScanner)
+	if !ok {
+		return nil, Error("the event store does not index modified entities")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return scanner.ScanModified(aggregate, since)
+}
+
+// Describe reads the entities' metadata from the local store when it keeps it
+func (n *Node) Describe(aggregate string, entities ...string) ([]eventstore.EntityDescription, error) {
+	describer, ok := n.store.(eventstore.Describer)
+	if !ok {
+		return nil, Error("the event store does not describe entities")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return describer.Describe(aggregate, entities...)
+}
+
+// Locate finds a fact in the local store when it indexes fact ids
+func (n *Node) Locate(factId string) (*eventstore.FactLocation, error) {
+	locator, ok := n.store.(eventstore.FactLocator)
+	if !ok {
+		return nil, Error("the event store does not index fact ids")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return locator.Locate(factId)
+}
+
+// TailMany reads the tails from the local store when it can read entities in batches
+func (n *Node) TailMany(aggregate string, entities []string) ([]eventstore.EntityTail, error) {
+	reader, ok := n.store.(eventstore.BatchReader)
+	if !ok {
+		return nil, Error("the event store does not read batches")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return reader.TailMany(aggregate, entities)
+}
+
+// ReadMany reads the facts from the local store when it can read entities in batches
+func (n *Node) ReadMany(aggregate string, entities []string, maxCount int) ([]eventstore.EntityRecords, error) {
+	reader, ok := n.store.(eventstore.BatchReader)
+	if !ok {
+		return nil, Error("the event store does not read batches")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return reader.ReadMany(aggregate, entities, maxCount)
+}
+
+func (n *Node) Tail(aggregate string, entity string) (*eventstore.Tail, error) {
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return n.store.Tail(aggregate, entity)
+}
+
+func (n *Node) Scan(aggregate string) (*eventstore.EntityList, error) {
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return n.store.Scan(aggregate)
+}
+
+// Lookup searches the local copy of the secondary indexes when the local store keeps them
+func (n *Node) Lookup(aggregate string, index string, value string, origin string, maxCount int) (*eventstore.IndexMatchList, error) {
+	indexer, ok := n.store.(eventstore.Indexer)
+	if !ok {
+		return nil, Error("the event store does not keep secondary indexes")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return indexer.Lookup(aggregate, index, value, origin, maxCount)
+}
+
+// Tagged lists the tagged facts in the local store when it indexes tags
+func (n *Node) Tagged(aggregate string, tag string, origin string, maxCount int) (*eventstore.EntityFactList, error) {
+	reader, ok := n.store.(eventstore.TagReader)
+	if !ok {
+		return nil, Error("the event store does not index tags")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return reader.Tagged(aggregate, tag, origin, maxCount)
+}
+
+// Correlated lists the correlated facts in the local store when it indexes correlation ids
+func (n *Node) Correlated(correlationId string, include func(aggregate string) bool) ([]eventstore.CorrelatedFact, error) {
+	correlator, ok := n.store.(eventstore.Correlator)
+	if !ok {
+		return nil, Error("the event store does not index correlation ids")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return correlator.Correlated(correlationId, include)
+}
+
+// Searchable lists the aggregates the local store keeps full text indexes for
+func (n *Node) Searchable() []string {
+	searcher, ok := n.store.(eventstore.Searcher)
+	if !ok {
+		return nil
+	}
+
+	return searcher.Searchable()
+}
+
+// Search ranks the matching facts in the local copy of the full text indexes
+func (n *Node) Search(aggregates []string, query string, maxCount int) ([]eventstore.SearchHit, error) {
+	searcher, ok := n.store.(eventstore.Searcher)
+	if !ok {
+		return nil, Error("the event store does not keep full text indexes")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return searcher.Search(aggregates, query, maxCount)
+}
+
+// Verify walks the local copy of the entity's hash chain when the local store supports it
+func (n *Node) Verify(aggregate string, entity string) (*eventstore.Verification, error) {
+	verifier, ok := n.store.(eventstore.Verifier)
+	if !ok {
+		return nil, Error("the event store does not hash facts")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return verifier.Verify(aggregate, entity)
+}
+
+// CollectGarbage reclaims the local store's disk space when it supports it
+func (n *Node) CollectGarbage(discardRatio float64) (*eventstore.MaintenanceResult, error) {
+	maintainer, err := n.maintainer()
+	if err != nil {
+		return nil, err
+	}
+
+	return maintainer.CollectGarbage(discardRatio)
+}
+
+// Compact compacts the local store when it supports it
+func (n *Node) Compact(discardRatio float64) (*eventstore.MaintenanceResult, error) {
+	maintainer, err := n.maintainer()
+	if err != nil {
+		return nil, err
+	}
+
+	return maintainer.Compact(discardRatio)
+}
+
+func (n *Node) maintainer() (eventstore.Maintainer, error) {
+	maintainer, ok := n.store.(eventstore.Maintainer)
+	if !ok {
+		return nil, Error("the event store does not need maintenance")
+	}
+
+	return maintainer, nil
+}
+
+// Checkpoint signs a checkpoint of the local store when it supports it
+func (n *Node) Checkpoint(key ed25519.PrivateKey) (*eventstore.Checkpoint, error) {
+	checkpointer, err := n.checkpointer()
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpointer.Checkpoint(key)
+}
+
+func (n *Node) LatestCheckpoint() (*eventstore.Checkpoint, error) {
+	checkpointer, err := n.checkpointer()
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpointer.LatestCheckpoint()
+}
+
+// Proof proves a fact is in one of the local store's checkpoints
+func (n *Node) Proof(factId string) (*eventstore.InclusionProof, error) {
+	checkpointer, err := n.checkpointer()
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpointer.Proof(factId)
+}
+
+func (n *Node) checkpointer() (eventstore.Checkpointer, error) {
+	checkpointer, ok := n.store.(eventstore.Checkpointer)
+	if !ok {
+		return nil, Error("the event store does not sign checkpoints")
+	}
+
+	return checkpointer, nil
+}
+
+// Aggregates lists the local store's aggregates when it supports it
+func (n *Node) Aggregates() ([]string, error) {
+	lister, ok := n.store.(eventstore.AggregateLister)
+	if !ok {
+		return nil, Error("the event store cannot list its aggregates")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return lister.Aggregates()
+}
+
+// CompressionStats reports the local store's compression when it supports it
+func (n *Node) CompressionStats(aggregate string) (*eventstore.CompressionStats, error) {
+	reporter, ok := n.store.(eventstore.CompressionReporter)
+	if !ok {
+		return nil, Error("the event store does not compress facts")
+	}
+
+	if err := n.catchUp(); err != nil {
+		return nil, err
+	}
+
+	return reporter.CompressionStats(aggregate)
+}
+
+// Backup writes the local copy of the facts when the local store supports backups
+func (n *Node) Backup(w io.Writer, since uint64) (uint64, error) {
+	backuper, ok := n.store.(eventstore.Backuper)
+	if !ok {
+		return 0, Error("the event store does not support backups")
+	}
+
+	return backuper.Backup(w, since)
+}
+
+// Restore is refused, loading a backup into one member would make it disagree with the others
+func (n *Node) Restore(io.Reader) error {
+	return Error("a cluster member cannot restore a backup, restore it before forming the cluster")
+}
+
+// catchUp waits until every fact committed before the read is stored locally.  Stale reads skip it.
+// Rather than writing a barrier to the log for each read, the leader confirms with the other members
+// that it still leads and waits until it has applied the commit index it had when the read started.
+func (n *Node) catchUp() error {
+	if n.config.ReadConsistency == Stale {
+		return nil
+	}
+
+	stats := n.raft.Stats()
+	commit, err := strconv.ParseUint(stats["commit_index"], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	err = n.settleTerm(stats["term"])
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := n.raftError(n.raft.VerifyLeader().Error()); err != nil {
+		return err
+	}
+
+	return n.waitApplied(commit)
+}
+
+// settleTerm waits with a barrier for a new leader to apply what the previous one committed: until it
+// commits an entry of its own term, its commit index and the tails in its store can miss those facts.
+// The caller holds mu.
+func (n *Node) settleTerm(term string) error {
+	if term == n.term {
+		return nil
+	}
+
+	if err := n.raftError(n.raft.Barrier(n.applyTimeout()).Error()); err != nil {
+		return err
+	}
+
+	n.term = term
+	return nil
+}
+
+// waitApplied polls until the log is applied up to index
+func (n *Node) waitApplied(index uint64) error {
+	deadline := time.Now().Add(n.applyTimeout())
+	for n.raft.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			return errApplyTimeout
+		}
+		time.Sleep(appliedPollInterval)
+	}
+
+	return nil
+}
+
+// IsLeader reports whether this member accepts appends
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Leader is the API address of the current leader, empty while there is an election
+func (n *Node) Leader() string {
+	_, id := n.raft.LeaderWithID()
+	m, _ := n.config.member(string(id))
+	return m.Api
+}
+
+// ReadinessCheck fails while the member does not know of a leader
+func (n *Node) ReadinessCheck() error {
+	if _, id := n.raft.LeaderWithID(); len(id) == 0 {
+		return Error("the cluster has no leader")
+	}
+
+	return nil
+}
+
+func (n *Node) Close() error {
+	err := n.shutdown()
+
+	if closeErr := n.store.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (n *Node) shutdown() error {
+	err := n.raft.Shutdown().Error()
+
+	if closer, ok := n.transport.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if closeErr := n.logs.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (n *Node) notLeader() error {
+	return NotLeader{Leader: n.Leader()}
+}
+
+func (n *Node) raftError(err error) error {
+	if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+		return n.notLeader()
+	}
+
+	return err
+}
+
+func (n *Node) applyTimeout() time.Duration {
+	if n.config.ApplyTimeout > 0 {
+		return n.config.ApplyTimeout
+	}
+
+	return defaultApplyTimeout
+}
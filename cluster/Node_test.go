@@ -0,0 +1,356 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/hashicorp/raft"
+)
+
+type Test struct {
+	Value int
+}
+
+type testCluster struct {
+	nodes      []*Node
+	transports []*raft.InmemTransport
+	stopped    []bool
+}
+
+func startCluster(t *testing.T, size int, consistency string) *testCluster {
+	return startClusterWith(t, size, consistency, func(int) eventstore.EventStore {
+		return eventstore.MemoryStore()
+	})
+}
+
+// startClusterWith starts a cluster whose members store their facts in the stores newStore returns
+func startClusterWith(t *testing.T, size int, consistency string, newStore func(i int) eventstore.EventStore) *testCluster {
+	c := &testCluster{stopped: make([]bool, size)}
+
+	var members []Member
+	for i := 0; i < size; i++ {
+		addr, transport := raft.NewInmemTransportWithTimeout("", 200*time.Millisecond)
+		c.transports = append(c.transports, transport)
+		members = append(members, Member{
+			Id:   fmt.Sprintf("node%d", i),
+			Raft: string(addr),
+			Api:  fmt.Sprintf("http://node%d:8080", i),
+		})
+	}
+
+	for _, a := range c.transports {
+		for _, b := range c.transports {
+			a.Connect(b.LocalAddr(), b)
+		}
+	}
+
+	for i := 0; i < size; i++ {
+		config := Config{
+			Enabled:          true,
+			NodeId:           members[i].Id,
+			Bootstrap:        i == 0,
+			ReadConsistency:  consistency,
+			HeartbeatTimeout: 100 * time.Millisecond,
+			ElectionTimeout:  100 * time.Millisecond,
+			LogLevel:         "ERROR",
+			Members:          members,
+		}
+
+		node, err := NewNode(config, newStore(i), c.transports[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.Register(Test{})
+		c.nodes = append(c.nodes, node)
+	}
+
+	t.Cleanup(func() {
+		for i, node := range c.nodes {
+			if !c.stopped[i] {
+				if err := node.Close(); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	})
+
+	return c
+}
+
+func (c *testCluster) leader(t *testing.T) int {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for i, node := range c.nodes {
+			if !c.stopped[i] && node.IsLeader() {
+				return i
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatal("no leader was elected")
+	return -1
+}
+
+func (c *testCluster) stop(t *testing.T, i int) {
+	for _, transport := range c.transports {
+		transport.Disconnect(c.transports[i].LocalAddr())
+	}
+
+	if err := c.nodes[i].Close(); err != nil {
+		t.Error(err)
+	}
+	c.stopped[i] = true
+}
+
+func TestClusterReplicatesAppends(t *testing.T) {
+	c := startCluster(t, 3, Stale)
+	leader := c.nodes[c.leader(t)]
+
+	for i := 0; i < 5; i++ {
+		if _, err := leader.Append("clustered", "1", Test{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := leader.Read("clustered", "1", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, node := range c.nodes {
+		var records *eventstore.RecordList
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			records, err = node.Read("clustered", "1", "", -1)
+			if err == nil && records.Total == expected.Total {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if err != nil {
+			t.Fatalf("node %d: %v", i, err)
+		}
+
+		if len(records.List) != len(expected.List) {
+			t.Fatalf("node %d: expected %d facts, received %d", i, len(expected.List), len(records.List))
+		}
+
+		for j, fact := range records.List {
+			if fact.Id != expected.List[j].Id || !fact.Timestamp.Equal(expected.List[j].Timestamp) {
+				t.Errorf("node %d fact %d: expected %s, received %s", i, j, expected.List[j].Id, fact.Id)
+			}
+		}
+	}
+}
+
+func TestClusterReadsDoNotWriteToTheLog(t *testing.T) {
+	c := startCluster(t, 3, Linearizable)
+	leader := c.nodes[c.leader(t)]
+
+	if _, err := leader.Append("clustered", "1", Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first read of a term may settle it with a barrier
+	if _, err := leader.Read("clustered", "1", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	before := leader.raft.LastIndex()
+	for i := 0; i < 5; i++ {
+		records, err := leader.Read("clustered", "1", "", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if records.Total != 1 {
+			t.Fatalf("expected 1 fact, received %d", records.Total)
+		}
+	}
+
+	if after := leader.raft.LastIndex(); after != before {
+		t.Errorf("expected reads to leave the log at index %d, it grew to %d", before, after)
+	}
+}
+
+func TestClusterReplicatesEntityMetadata(t *testing.T) {
+	c := startCluster(t, 3, Stale)
+	leader := c.nodes[c.leader(t)]
+
+	if _, err := leader.AppendWith("clustered", "1", Test{Value: 1}, eventstore.Metadata{Subject: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leader.SetLabels("clustered", "1", map[string]string{"tier": "gold"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, node := range c.nodes {
+		var described []eventstore.EntityDescription
+		var err error
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			described, err = node.Describe("clustered", "1")
+			if err == nil && described[0].Err == nil && described[0].Info.Labels["tier"] == "gold" {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if err == nil {
+			err = described[0].Err
+		}
+		if err != nil {
+			t.Fatalf("node %d: %v", i, err)
+		}
+
+		if info := described[0].Info; info.CreatedBy != "alice" || info.Labels["tier"] != "gold" {
+			t.Errorf("node %d: expected alice's entity labelled gold, received %+v", i, info)
+		}
+	}
+}
+
+func TestClusterAppendsNewEntities(t *testing.T) {
+	c := startCluster(t, 3, Stale)
+	leader := c.nodes[c.leader(t)]
+
+	entity, tail, err := leader.AppendNew("clustered", Test{Value: 1}, eventstore.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, node := range c.nodes {
+		var stored *eventstore.Tail
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			stored, err = node.Tail("clustered", entity)
+			if err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if err != nil {
+			t.Fatalf("node %d: %v", i, err)
+		}
+		if stored.Fact.Id != tail.Fact.Id {
+			t.Errorf("node %d: expected %s in %s, received %s", i, tail.Fact.Id, entity, stored.Fact.Id)
+		}
+	}
+}
+
+func TestClusterFollowerRedirectsToLeader(t *testing.T) {
+	c := startCluster(t, 3, Linearizable)
+	leader := c.leader(t)
+	follower := c.nodes[(leader+1)%len(c.nodes)]
+
+	_, err := follower.Append("clustered", "1", Test{Value: 1})
+
+	var notLeader NotLeader
+	if !errors.As(err, &notLeader) {
+		t.Fatalf("expected NotLeader, received %v", err)
+	}
+
+	if notLeader.Location() != c.nodes[leader].config.Members[leader].Api {
+		t.Errorf("expected redirect to %s, received %s", c.nodes[leader].config.Members[leader].Api, notLeader.Location())
+	}
+
+	_, err = follower.Tail("clustered", "1")
+	if !errors.As(err, &notLeader) {
+		t.Errorf("expected linearizable reads on a follower to return NotLeader, received %v", err)
+	}
+}
+
+func TestClusterSurvivesLeaderFailure(t *testing.T) {
+	c := startCluster(t, 3, Linearizable)
+	first := c.leader(t)
+
+	tail, err := c.nodes[first].Append("clustered", "1", Test{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.stop(t, first)
+
+	leader := c.nodes[c.leader(t)]
+
+	next, err := leader.Append("clustered", "1", Test{Value: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next.Total != 2 {
+		t.Errorf("expected the new leader to have 2 facts, received %d", next.Total)
+	}
+
+	if next.Fact.Id.Compare(tail.Fact.Id) <= 0 {
+		t.Errorf("expected id %s to follow %s", next.Fact.Id, tail.Fact.Id)
+	}
+
+	records, err := leader.Read("clustered", "1", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records.List) != 2 || records.List[0].Id != tail.Fact.Id {
+		t.Errorf("expected the fact appended before the failure to survive, received %v", records.List)
+	}
+}
+
+func TestClusterFollowsTheTailAfterFailoverToASlowClock(t *testing.T) {
+	now := time.Now()
+	c := startClusterWith(t, 3, Linearizable, func(i int) eventstore.EventStore {
+		if i == 0 {
+			return eventstore.MemoryStore(eventstore.WithClock(eventstore.NewFakeClock(now)))
+		}
+		return eventstore.MemoryStore(eventstore.WithClock(eventstore.NewFakeClock(now.Add(-time.Hour))))
+	})
+	first := c.leader(t)
+	if first != 0 {
+		t.Skip("the first member did not win the election")
+	}
+
+	tail, err := c.nodes[first].Append("clustered", "1", Test{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tail.Fact.Timestamp.Equal(now.UTC()) {
+		t.Errorf("expected the leader's clock to stamp %s, received %s", now.UTC(), tail.Fact.Timestamp)
+	}
+
+	c.stop(t, first)
+
+	next, err := c.nodes[c.leader(t)].Append("clustered", "1", Test{Value: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next.Fact.Id.Compare(tail.Fact.Id) <= 0 {
+		t.Errorf("expected id %s to follow %s", next.Fact.Id, tail.Fact.Id)
+	}
+
+	if !next.Fact.Timestamp.Equal(now.Add(-time.Hour).UTC()) {
+		t.Errorf("expected the new leader's clock to stamp %s, received %s", now.Add(-time.Hour).UTC(), next.Fact.Timestamp)
+	}
+}
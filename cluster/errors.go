@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import "fmt"
+
+// NotLeader is returned by a member that cannot serve the request because it is not the leader
+type NotLeader struct {
+	// Leader is the API address of the current leader, empty while there is an election
+	Leader string
+}
+
+func (n NotLeader) Error() string {
+	if len(n.Leader) == 0 {
+		return "this server is not the cluster leader and there is no leader yet"
+	}
+
+	return fmt.Sprintf("this server is not the cluster leader, send requests to: %s", n.Leader)
+}
+
+// Location sends clients to the leader
+func (n NotLeader) Location() string {
+	return n.Leader
+}
+
+type Error string
+
+func (err Error) Error() string {
+	return string(err)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPendingRestoreWrites bounds the memory used while loading a backup
+	maxPendingRestoreWrites = 256
+
+	backupPrefix     = "fact-totem-"
+	backupExtension  = ".backup"
+	backupTimeLayout = "20060102T150405.000Z"
+)
+
+func (b *BadgerEventStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return 0, err
+	}
+
+	return db.Backup(w, since)
+}
+
+// Restore loads the backup while the store stays open.  Badger does not isolate the load from
+// concurrent writes, so writes wait until it completes.  Reads may see part of the backup.
+func (b *BadgerEventStore) Restore(r io.Reader) error {
+	db, err := b.kvStore()
+	if err != nil {
+		return err
+	}
+
+	b.writers.Lock()
+	defer b.writers.Unlock()
+
+	return db.Load(r, maxPendingRestoreWrites)
+}
+
+// BackupSchedule writes a full backup to Dir every Interval, keeping the newest Keep files
+type BackupSchedule struct {
+	Store    Backuper
+	Dir      string
+	Interval time.Duration
+	Keep     int
+}
+
+// Run backs up the store until the context is cancelled
+func (s *BackupSchedule) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if file, err := s.BackupNow(); err != nil {
+				log.Printf("Scheduled backup failed: %s", err)
+			} else {
+				log.Printf("Scheduled backup written to %s", file)
+			}
+		}
+	}
+}
+
+// BackupNow writes a full backup and removes the backups beyond Keep.  It returns the backup file.
+func (s *BackupSchedule) BackupNow() (string, error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return "", err
+	}
+
+	name := backupPrefix + time.Now().UTC().Format(backupTimeLayout) + backupExtension
+	file := filepath.Join(s.Dir, name)
+
+	// Write to a temporary file first, so a failed backup never looks complete
+	tmp, err := ioutil.TempFile(s.Dir, name+".*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.Store.Backup(tmp, 0)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return file, s.rotate()
+}
+
+func (s *BackupSchedule) rotate() error {
+	if s.Keep <= 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupExtension) {
+			backups = append(backups, name)
+		}
+	}
+
+	// The timestamp in the name sorts oldest first
+	sort.Strings(backups)
+
+	for len(backups) > s.Keep {
+		if err := os.Remove(filepath.Join(s.Dir, backups[0])); err != nil {
+			return fmt.Errorf("removing old backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBadgerEventStoreBackupRestore(t *testing.T) {
+	source := MemoryStore().(*BadgerEventStore)
+	target := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		if err := source.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := target.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	source.Register(Test{})
+
+	for i := 0; i < 3; i++ {
+		if _, err := source.Append("backup", "1", Test{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var full bytes.Buffer
+	version, err := source.Backup(&full, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tail, err := source.Append("backup", "1", Test{Value: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var incremental bytes.Buffer
+	if _, err := source.Backup(&incremental, version); err != nil {
+		t.Fatal(err)
+	}
+
+	if incremental.Len() >= full.Len() {
+		t.Errorf("expected the incremental backup to be smaller than the full backup")
+	}
+
+	if err := target.Restore(&full); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := target.Restore(&incremental); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := target.Read("backup", "1", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Total != 4 || len(restored.List) != 4 {
+		t.Fatalf("expected 4 restored facts, received total %d with %d facts", restored.Total, len(restored.List))
+	}
+
+	if restored.List[3].Id != tail.Fact.Id {
+		t.Errorf("expected last fact %s, received %s", tail.Fact.Id, restored.List[3].Id)
+	}
+}
+
+func TestBadgerEventStoreRestoreBlocksWrites(t *testing.T) {
+	source := MemoryStore().(*BadgerEventStore)
+	target := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		_ = source.Close()
+		_ = target.Close()
+	}()
+
+	source.Register(Test{})
+	target.Register(Test{})
+	if _, err := source.Append("restored", "1", Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var backup bytes.Buffer
+	if _, err := source.Backup(&backup, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restore holds the store until the whole backup has been read
+	r, w := io.Pipe()
+	restored := make(chan error, 1)
+	go func() {
+		restored <- target.Restore(r)
+	}()
+
+	half := backup.Len() / 2
+	if _, err := w.Write(backup.Next(half)); err != nil {
+		t.Fatal(err)
+	}
+
+	appended := make(chan error, 1)
+	go func() {
+		_, err := target.Append("restored", "2", Test{Value: 2})
+		appended <- err
+	}()
+
+	select {
+	case err := <-appended:
+		t.Fatalf("expected the append to wait for the restore, received %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := w.Write(backup.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	if err := <-restored; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-appended; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupScheduleRotation(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	if _, err := store.Append("backup", "1", Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule := BackupSchedule{
+		Store: store,
+		Dir:   t.TempDir(),
+		Keep:  2,
+	}
+
+	var written []string
+	for i := 0; i < 4; i++ {
+		file, err := schedule.BackupNow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, file)
+
+		// backups are named after the millisecond they were taken
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	entries, err := ioutil.ReadDir(schedule.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 backups to be kept, found %d", len(entries))
+	}
+
+	for i, entry := range entries {
+		if expected := written[i+2]; schedule.Dir+"/"+entry.Name() != expected {
+			t.Errorf("expected %s to be kept, found %s", expected, entry.Name())
+		}
+	}
+}
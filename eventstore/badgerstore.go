@@ -17,11 +17,12 @@
 package eventstore
 
 import (
-	"bytes"
 	"encoding/gob"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/oklog/ulid/v2"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -36,39 +37,76 @@ type BadgerEventStore struct {
 	EncryptionKey              []byte
 	EncryptionRotationDuration time.Duration
 	db                         *badger.DB
-	generator                  IdGenerator
+	mu                         sync.Mutex
+	checkpointMu               sync.Mutex
+	// writers lets appends and other writes run together, while a restore runs alone
+	writers sync.RWMutex
+	storeOptions
 }
 
 type AggregateStats struct {
-	LastId ulid.ULID
-	Total  uint
+	LastId      ulid.ULID
+	Total       uint
+	RawBytes    uint64
+	StoredBytes uint64
+	LastHash    []byte
+	// LastModified is when the last fact was recorded, see ModifiedScanner
+	LastModified time.Time
+	// FirstId, CreatedAt and CreatedBy describe the first fact, see Describer
+	FirstId   ulid.ULID
+	CreatedAt time.Time
+	CreatedBy string
+	// Labels are set on the entity by a Labeler
+	Labels map[string]string
 }
 
-func MemoryStore() EventStore {
+func init() {
+	RegisterDriver(DefaultDriver, openBadger)
+}
+
+func MemoryStore(opts ...Option) EventStore {
 	return &BadgerEventStore{
-		MemoryOnly: true,
-		RootDir:    "",
-		generator:  NewIdGenerator(),
+		MemoryOnly:   true,
+		RootDir:      "",
+		storeOptions: newStoreOptions(opts),
 	}
 }
 
-func FileStore(path string) EventStore {
+func FileStore(path string, opts ...Option) EventStore {
 	return &BadgerEventStore{
 		RootDir:       path,
 		MemoryOnly:    false,
 		EncryptionKey: nil,
-		generator:     NewIdGenerator(),
+		storeOptions:  newStoreOptions(opts),
 	}
 }
 
-func EncryptedFileStore(path string, key []byte, rotationDur time.Duration) EventStore {
+func EncryptedFileStore(path string, key []byte, rotationDur time.Duration, opts ...Option) EventStore {
 	return &BadgerEventStore{
 		RootDir:                    path,
 		MemoryOnly:                 false,
 		EncryptionKey:              key,
 		EncryptionRotationDuration: rotationDur,
-		generator:                  NewIdGenerator(),
+		storeOptions:               newStoreOptions(opts),
+	}
+}
+
+func openBadger(settings Settings, opts ...Option) (EventStore, error) {
+	if len(settings.EncryptionKey) > 0 {
+		if err := ValidateEncryptionKey(settings.EncryptionKey); err != nil {
+			return nil, err
+		}
+
+		// Open the store now, so a key that does not match the store stops the server at startup
+		store := EncryptedFileStore(settings.Path, settings.EncryptionKey, settings.KeyDuration, opts...).(*BadgerEventStore)
+		if _, err := store.kvStore(); err != nil {
+			return nil, err
+		}
+
+		return store, nil
 	}
+
+	return FileStore(settings.Path, opts...), nil
 }
 
 func (b *BadgerEventStore) Register(t interface{}) {
@@ -76,77 +114,253 @@ func (b *BadgerEventStore) Register(t interface{}) {
 }
 
 func (b *BadgerEventStore) Append(aggregate string, entity string, content interface{}) (*Tail, error) {
+	return b.AppendWith(aggregate, entity, content, Metadata{})
+}
+
+// AppendOccurred appends content that happened at occurredAt, or now when it is zero
+func (b *BadgerEventStore) AppendOccurred(aggregate string, entity string, occurredAt time.Time, content interface{}) (*Tail, error) {
+	return b.AppendWith(aggregate, entity, content, Metadata{OccurredAt: occurredAt})
+}
+
+func (b *BadgerEventStore) AppendWith(aggregate string, entity string, content interface{}, metadata Metadata) (*Tail, error) {
 	db, err := b.kvStore()
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now().UTC()
-	tail := Tail{
-		Fact: Fact{
-			Id:        b.generator.NewId(now),
-			Timestamp: now,
-			Content:   content,
-		},
+	var tail *Tail
+	for {
+		tail, err = b.appendFact(db, aggregate, entity, metadata.Subject, func(last ulid.ULID) Fact {
+			return b.newFact(last, content, metadata)
+		})
+
+		// Concurrent appends to the same entity conflict on the stats, and to a searchable aggregate
+		// on its fact count, so try again with a new id to keep the facts in commit order.
+		if err != badger.ErrConflict {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tail, nil
+}
+
+// AppendFact stores a fact created elsewhere, keeping its id and timestamp
+func (b *BadgerEventStore) AppendFact(aggregate string, entity string, fact Fact) (*Tail, error) {
+	return b.AppendFactBy(aggregate, entity, fact, "")
+}
+
+// appendFact stores the fact newFact creates from the entity's last id as the new tail, subject is
+// recorded as the creator of a new entity
+func (b *BadgerEventStore) appendFact(db *badger.DB, aggregate string, entity string, subject string, newFact func(last ulid.ULID) Fact) (*Tail, error) {
+	tail := Tail{}
+
+	b.writers.RLock()
+	defer b.writers.RUnlock()
+
+	err := db.Update(func(txn *badger.Txn) error {
+		return b.appendTxn(txn, aggregate, entity, subject, newFact, &tail)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tail, nil
+}
+
+// appendTxn stores the new tail of the entity in the transaction, see appendFact
+func (b *BadgerEventStore) appendTxn(txn *badger.Txn, aggregate string, entity string, subject string, newFact func(last ulid.ULID) Fact, tail *Tail) error {
+	stats, err := b.readEntityStats(txn, aggregate, entity)
+	if err != nil {
+		return err
 	}
 
-	err = db.Update(func(txn *badger.Txn) error {
-		stats, err := b.readEntityStats(txn, aggregate, entity)
-		factKey := b.factKey(aggregate, entity, tail.Fact.Id.String())
+	fact := newFact(stats.LastId)
+	tail.Fact = fact
 
-		value, err := encodeFact(tail.Fact)
+	factKey := b.factKey(aggregate, entity, tail.Fact.Id.String())
+
+	if stats.Total > 0 && fact.Id.Compare(stats.LastId) <= 0 {
+		_, err := txn.Get(factKey)
+		if err == badger.ErrKeyNotFound {
+			return OutOfOrder{Aggregate: aggregate, Entity: entity, Id: fact.Id, LastId: stats.LastId}
+		}
 		if err != nil {
 			return err
 		}
 
-		entry := badger.NewEntry(factKey, value)
-		err = txn.SetEntry(entry)
-		if err != nil {
+		// the fact is already stored
+		tail.Total = stats.Total
+		return nil
+	}
+
+	located, err := readEntry(txn, locationKey(fact.Id))
+	if err != nil {
+		return err
+	}
+	if err := factExists(fact.Id, located); err != nil {
+		return err
+	}
+
+	if err := linkFact(aggregate, entity, stats.LastHash, &tail.Fact); err != nil {
+		return err
+	}
+
+	value, rawSize, err := b.encodeFact(tail.Fact)
+	if err != nil {
+		return err
+	}
+
+	entry := badger.NewEntry(factKey, value)
+	err = txn.SetEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	entries, err := b.indexEntries(aggregate, entity, tail.Fact)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := setEntry(txn, entry); err != nil {
 			return err
 		}
+	}
 
-		stats.LastId = tail.Fact.Id
-		stats.Total += 1
-		tail.Total = stats.Total
+	stale, modified := stats.touch(aggregate, entity, tail.Fact)
+	if stale != nil {
+		if err := txn.Delete(stale); err != nil {
+			return err
+		}
+	}
+	if err := txn.Set(modified.key, modified.value); err != nil {
+		return err
+	}
+
+	stats.create(tail.Fact, subject)
+	stats.LastId = tail.Fact.Id
+	stats.LastHash = tail.Fact.Hash
+	stats.Total += 1
+	stats.RawBytes += uint64(rawSize)
+	stats.StoredBytes += uint64(len(value))
+	tail.Total = stats.Total
+
+	return b.updateEntityStats(txn, aggregate, entity, stats)
+}
+
+func (b *BadgerEventStore) Read(aggregate string, entity string, factId string, maxCount int) (*RecordList, error) {
+	return b.ReadFiltered(aggregate, entity, factId, maxCount, ReadFilter{})
+}
+
+// ReadFiltered reads the facts of the entity that match the filter, see FilteredReader
+func (b *BadgerEventStore) ReadFiltered(aggregate string, entity string, factId string, maxCount int, filter ReadFilter) (*RecordList, error) {
+	matcher, err := filter.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
 
-		return b.updateEntityStats(txn, aggregate, entity, stats)
+	var records *RecordList
+	err = db.View(func(txn *badger.Txn) error {
+		records, err = b.readRecordList(txn, aggregate, entity, factId, maxCount, matcher)
+		return err
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &tail, nil
+	return records, nil
 }
 
-func (b *BadgerEventStore) Read(aggregate string, entity string, factId string, maxCount int) (*RecordList, error) {
+func (b *BadgerEventStore) Tail(aggregate string, entity string) (*Tail, error) {
 	db, err := b.kvStore()
 	if err != nil {
 		return nil, err
 	}
 
-	var records = RecordList{
-		PageSize: maxCount,
+	var tail *Tail
+	err = db.View(func(txn *badger.Txn) error {
+		tail, err = b.readTail(txn, aggregate, entity)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	if records.PageSize < 1 || records.PageSize > maxPageSize {
-		records.PageSize = maxPageSize
+	return tail, nil
+}
+
+func (b *BadgerEventStore) Get(aggregate string, entity string, factId string) (*Fact, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
 	}
 
+	var fact *Fact
 	err = db.View(func(txn *badger.Txn) error {
-		stats, err := b.readEntityStats(txn, aggregate, entity)
+		item, err := txn.Get(b.factKey(aggregate, entity, factId))
+		if err == badger.ErrKeyNotFound {
+			return FactNotFound{Id: factId}
+		}
 		if err != nil {
 			return err
 		}
 
-		records.Total = stats.Total
+		fact, err = decodeFact(item)
+		return err
+	})
 
-		list, err := b.readRecords(txn, aggregate, entity, factId, records.PageSize)
-		if err != nil {
-			return err
+	if err != nil {
+		return nil, err
+	}
+
+	return fact, nil
+}
+
+func (b *BadgerEventStore) Scan(aggregate string) (*EntityList, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := EntityList{}
+
+	// Include the separator so "test" does not pick up the entities in "test2"
+	prefix := []byte(aggregate + separator)
+
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			id := string(it.Item().Key())
+			parts := strings.Split(id, separator)
+
+			// Every entity has exactly one stats key, which sorts in entity order.  The fact keys
+			// are interleaved with them (e.g. "1|..." sorts after "10") so they are skipped.
+			if len(parts) != 2 {
+				continue
+			}
+
+			keys.List = append(keys.List, parts[1])
+			keys.Total += 1
 		}
 
-		records.List = list
 		return nil
 	})
 
@@ -154,36 +368,43 @@ func (b *BadgerEventStore) Read(aggregate string, entity string, factId string,
 		return nil, err
 	}
 
-	return &records, nil
+	return &keys, nil
 }
 
-func (b *BadgerEventStore) Tail(aggregate string, entity string) (*Tail, error) {
+func (b *BadgerEventStore) Verify(aggregate string, entity string) (*Verification, error) {
+	return verifyChain(b, aggregate, entity)
+}
+
+func (b *BadgerEventStore) Aggregates() ([]string, error) {
 	db, err := b.kvStore()
 	if err != nil {
 		return nil, err
 	}
 
-	tail := Tail{}
+	var aggregates []string
+
 	err = db.View(func(txn *badger.Txn) error {
-		stats, err := b.readEntityStats(txn, aggregate, entity)
-		if err != nil {
-			return err
-		}
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
 
-		tail.Total = stats.Total
+		it := txn.NewIterator(opts)
+		defer it.Close()
 
-		evtKey := b.factKey(aggregate, entity, stats.LastId.String())
-		item, err := txn.Get(evtKey)
-		if err != nil {
-			return err
-		}
+		it.Rewind()
+		for it.Valid() {
+			key := string(it.Item().Key())
+			if strings.HasPrefix(key, systemPrefix) {
+				it.Next()
+				continue
+			}
 
-		record, err := decodeFact(item)
-		if err != nil {
-			return err
+			aggregate := strings.SplitN(key, separator, 2)[0]
+			aggregates = append(aggregates, aggregate)
+
+			// Skip past every key in the aggregate, the byte after the separator sorts after all of them
+			it.Seek([]byte(aggregate + string(separator[0]+1)))
 		}
 
-		tail.Fact = *record
 		return nil
 	})
 
@@ -191,18 +412,19 @@ func (b *BadgerEventStore) Tail(aggregate string, entity string) (*Tail, error)
 		return nil, err
 	}
 
-	return &tail, nil
+	// Keys sort "test2|" before "test|", the names need sorting on their own
+	sort.Strings(aggregates)
+	return aggregates, nil
 }
 
-func (b *BadgerEventStore) Scan(aggregate string) (*EntityList, error) {
+func (b *BadgerEventStore) CompressionStats(aggregate string) (*CompressionStats, error) {
 	db, err := b.kvStore()
 	if err != nil {
 		return nil, err
 	}
 
-	keys := EntityList{}
-
-	prefix := []byte(aggregate)
+	summary := CompressionStats{}
+	prefix := []byte(aggregate + separator)
 
 	err = db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
@@ -212,23 +434,21 @@ func (b *BadgerEventStore) Scan(aggregate string) (*EntityList, error) {
 		it := txn.NewIterator(opts)
 		defer it.Close()
 
-		var lastKey = ""
 		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			id := string(item.Key())
-			parts := strings.Split(id, separator)
-			key := parts[1]
+			parts := strings.Split(string(it.Item().Key()), separator)
+			if len(parts) != 2 {
+				// Only the entity stats are needed, skip the facts
+				continue
+			}
 
-			if len(lastKey) == 0 || lastKey != key {
-				keys.List = append(keys.List, key)
-				keys.Total += 1
-				lastKey = key
+			stats, err := b.readEntityStats(txn, aggregate, parts[1])
+			if err != nil {
+				return err
 			}
-		}
 
-		if len(lastKey) > 0 && (len(keys.List) == 0 || keys.List[len(keys.List)-1] != lastKey) {
-			keys.List = append(keys.List, lastKey)
-			keys.Total += 1
+			summary.Facts += stats.Total
+			summary.RawBytes += stats.RawBytes
+			summary.StoredBytes += stats.StoredBytes
 		}
 
 		return nil
@@ -238,10 +458,13 @@ func (b *BadgerEventStore) Scan(aggregate string) (*EntityList, error) {
 		return nil, err
 	}
 
-	return &keys, nil
+	return &summary, nil
 }
 
 func (b *BadgerEventStore) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	if b.db != nil {
 		if err := b.db.Close(); err != nil {
 			return err
@@ -253,13 +476,21 @@ func (b *BadgerEventStore) Close() error {
 }
 
 func (b *BadgerEventStore) kvStore() (*badger.DB, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	if b.db != nil {
 		return b.db, nil
 	}
 
 	opts := badger.DefaultOptions(b.RootDir).WithInMemory(b.MemoryOnly)
 
-	if b.EncryptionKey != nil && len(b.EncryptionKey) >= 128 {
+	if len(b.EncryptionKey) > 0 {
+		// Never fall back to storing the facts in the clear
+		if err := ValidateEncryptionKey(b.EncryptionKey); err != nil {
+			return nil, err
+		}
+
 		opts = opts.WithEncryptionKey(b.EncryptionKey)
 		opts = opts.WithEncryptionKeyRotationDuration(b.EncryptionRotationDuration)
 		// May need to tune this.. data store shouldn't get too big
@@ -268,10 +499,23 @@ func (b *BadgerEventStore) kvStore() (*badger.DB, error) {
 
 	b.Register(Fact{})
 	db, err := badger.Open(opts)
+	if err == badger.ErrEncryptionKeyMismatch {
+		return nil, EncryptionKeyMismatch{Path: b.RootDir}
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if err := b.syncIndexes(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err := b.syncModified(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	b.db = db
 	return b.db, nil
 }
@@ -284,18 +528,70 @@ func (b *BadgerEventStore) factKey(aggregate string, entity string, factId strin
 	return []byte(strings.Join([]string{aggregate, entity, factId}, separator))
 }
 
-func (b *BadgerEventStore) readRecords(txn *badger.Txn, aggregate string, entity string, minFactId string, pageSize int) ([]Fact, error) {
+// readRecordList reads a page of the entity's facts along with its total
+func (b *BadgerEventStore) readRecordList(txn *badger.Txn, aggregate string, entity string, factId string, maxCount int, filter *factFilter) (*RecordList, error) {
+	var records = RecordList{
+		PageSize: maxCount,
+	}
+
+	if records.PageSize < 1 || records.PageSize > maxPageSize {
+		records.PageSize = maxPageSize
+	}
+
+	stats, err := b.readEntityStats(txn, aggregate, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	records.Total = stats.Total
+
+	records.List, err = b.readRecords(txn, aggregate, entity, factId, records.PageSize, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &records, nil
+}
+
+// readTail reads the last fact of the entity, or returns EntityNotFound
+func (b *BadgerEventStore) readTail(txn *badger.Txn, aggregate string, entity string) (*Tail, error) {
+	stats, err := b.readEntityStats(txn, aggregate, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.Total == 0 {
+		return nil, EntityNotFound{Aggregate: aggregate, Entity: entity}
+	}
+
+	evtKey := b.factKey(aggregate, entity, stats.LastId.String())
+	item, err := txn.Get(evtKey)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := decodeFact(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tail{Fact: *record, Total: stats.Total}, nil
+}
+
+// readRecords reads up to pageSize facts after minFactId that match the filter, skipping the others
+func (b *BadgerEventStore) readRecords(txn *badger.Txn, aggregate string, entity string, minFactId string, pageSize int, filter *factFilter) ([]Fact, error) {
 	var records []Fact
 	opts := badger.DefaultIteratorOptions
 	opts.PrefetchSize = 10
 	it := txn.NewIterator(opts)
 	defer it.Close()
 
-	aggKey := b.aggregateKey(aggregate, entity)
+	// Include the separator so entity "1" does not pick up the facts in entity "10"
+	factPrefix := b.factKey(aggregate, entity, "")
 	startKey := b.factKey(aggregate, entity, minFactId)
 
 	// Walk all the events using the aggregate as a prefix
-	for it.Seek(startKey); len(records) < pageSize && it.ValidForPrefix(aggKey); it.Next() {
+	for it.Seek(startKey); len(records) < pageSize && it.ValidForPrefix(factPrefix); it.Next() {
 		item := it.Item()
 
 		record, err := decodeFact(item)
@@ -304,7 +600,15 @@ func (b *BadgerEventStore) readRecords(txn *badger.Txn, aggregate string, entity
 		}
 
 		// Ensure that "read from" is reading values after the start value
-		if record.Id.String() > minFactId {
+		if record.Id.String() <= minFactId {
+			continue
+		}
+
+		matched, err := filter.matches(*record)
+		if err != nil {
+			return records, err
+		}
+		if matched {
 			records = append(records, *record)
 		}
 	}
@@ -320,8 +624,7 @@ func (b *BadgerEventStore) readEntityStats(txn *badger.Txn, aggregate string, en
 	if err == nil {
 		// If there is an error then this is a virgin aggregate so there is nothing to read
 		err = item.Value(func(val []byte) error {
-			dec := gob.NewDecoder(bytes.NewBuffer(val))
-			return dec.Decode(&stats)
+			return decodeStats(val, &stats)
 		})
 
 		if err != nil {
@@ -335,44 +638,26 @@ func (b *BadgerEventStore) readEntityStats(txn *badger.Txn, aggregate string, en
 func (b *BadgerEventStore) updateEntityStats(txn *badger.Txn, aggregate string, entity string, stats *AggregateStats) error {
 	aggKey := b.aggregateKey(aggregate, entity)
 
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(stats)
+	value, err := encodeStats(stats)
 	if err != nil {
 		return err
 	}
 
-	return txn.Set(aggKey, buf.Bytes())
-}
-
-func encodeFact(fact Fact) ([]byte, error) {
-	var c bytes.Buffer
-	enc := gob.NewEncoder(&c)
-
-	err := enc.Encode(fact)
-	if err != nil {
-		return nil, err
-	}
-
-	return c.Bytes(), nil
+	return txn.Set(aggKey, value)
 }
 
 func decodeFact(item *badger.Item) (*Fact, error) {
-	record := Fact{}
+	var record *Fact
 
 	err := item.Value(func(val []byte) error {
-		c := bytes.NewBuffer(val)
-		dec := gob.NewDecoder(c)
-		if err := dec.Decode(&record); err != nil {
-			return err
-		}
-
-		return nil
+		var err error
+		record, err = decodeFactValue(val)
+		return err
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &record, nil
+	return record, nil
 }
@@ -17,6 +17,8 @@
 package eventstore
 
 import (
+	"bytes"
+	"encoding/json"
 	"reflect"
 	"testing"
 )
@@ -249,6 +251,40 @@ func TestBadgerEventStoreScanAggregate(t *testing.T) {
 	}
 }
 
+func TestBadgerEventStoreRawContent(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(json.RawMessage{})
+	aggregate := "raw"
+	key := "1"
+	content := json.RawMessage(`{"z":1,"big":12345678901234567890,"a":null}`)
+
+	_, err := store.Append(aggregate, key, content)
+	if err != nil {
+		t.Error(err)
+	}
+
+	tail, err := store.Tail(aggregate, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	raw, ok := tail.Fact.Content.(json.RawMessage)
+	if !ok {
+		t.Fatalf("expected json.RawMessage content, received %T", tail.Fact.Content)
+	}
+
+	if !bytes.Equal(raw, content) {
+		t.Errorf("expected content %s, received %s", content, raw)
+	}
+}
+
 func lastEvent(results *RecordList) Fact {
 	return results.List[len(results.List)-1]
 }
@@ -258,3 +294,22 @@ func verifyListLength(t *testing.T, results *RecordList, expectedSize int) {
 		t.Errorf("expected %d events, received %d events", expectedSize, len(results.List))
 	}
 }
+
+func TestBadgerEventStoreIdGenerator(t *testing.T) {
+	store := MemoryStore(WithIdGenerator(NewNodeIdGenerator(7)))
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	store.Register(Test{})
+
+	add, err := store.Append("test", "1", Test{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entropy := add.Fact.Id.Entropy(); entropy[0] != 0 || entropy[1] != 7 {
+		t.Errorf("expected the id %s to start its entropy with node 7", add.Fact.Id)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	bolt "go.etcd.io/bbolt"
+)
+
+// EntityTail is the tail of one entity in a batch, or the error reading it
+type EntityTail struct {
+	Entity string
+	Tail   *Tail
+	Err    error
+}
+
+// EntityRecords is the first page of one entity's facts in a batch, or the error reading it
+type EntityRecords struct {
+	Entity  string
+	Records *RecordList
+	Err     error
+}
+
+// BatchReader is implemented by event stores that can read many entities of an aggregate at once.  The
+// entities are read from one consistent snapshot, and the results are in the order of the entities.  An
+// error reading one entity is returned with that entity, the others are still read.
+type BatchReader interface {
+	// TailMany reads the tail of each entity, an entity without facts has EntityNotFound
+	TailMany(aggregate string, entities []string) ([]EntityTail, error)
+	// ReadMany reads up to maxCount facts from the start of each entity
+	ReadMany(aggregate string, entities []string, maxCount int) ([]EntityRecords, error)
+}
+
+func (b *BadgerEventStore) TailMany(aggregate string, entities []string) ([]EntityTail, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	tails := make([]EntityTail, 0, len(entities))
+	err = db.View(func(txn *badger.Txn) error {
+		for _, entity := range entities {
+			tail, err := b.readTail(txn, aggregate, entity)
+			tails = append(tails, EntityTail{Entity: entity, Tail: tail, Err: err})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tails, nil
+}
+
+func (b *BadgerEventStore) ReadMany(aggregate string, entities []string, maxCount int) ([]EntityRecords, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]EntityRecords, 0, len(entities))
+	err = db.View(func(txn *badger.Txn) error {
+		for _, entity := range entities {
+			records, err := b.readRecordList(txn, aggregate, entity, "", maxCount, nil)
+			lists = append(lists, EntityRecords{Entity: entity, Records: records, Err: err})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (b *BoltEventStore) TailMany(aggregate string, entities []string) ([]EntityTail, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	tails := make([]EntityTail, 0, len(entities))
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, entity := range entities {
+			tail, err := b.readTail(tx, aggregate, entity)
+			tails = append(tails, EntityTail{Entity: entity, Tail: tail, Err: err})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tails, nil
+}
+
+func (b *BoltEventStore) ReadMany(aggregate string, entities []string, maxCount int) ([]EntityRecords, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]EntityRecords, 0, len(entities))
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, entity := range entities {
+			records, err := b.readRecordList(tx, aggregate, entity, "", maxCount, nil)
+			lists = append(lists, EntityRecords{Entity: entity, Records: records, Err: err})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
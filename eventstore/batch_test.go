@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBatchReads(t *testing.T) {
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore() },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir()) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(Test{})
+
+			for i, entity := range []string{"1", "2", "1", "3", "1"} {
+				if _, err := store.Append("test", entity, Test{Value: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reader := store.(BatchReader)
+			entities := []string{"3", "missing", "1"}
+
+			tails, err := reader.TailMany("test", entities)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tails) != 3 {
+				t.Fatalf("expected a tail for each of the 3 entities, got %d", len(tails))
+			}
+			if tails[0].Entity != "3" || tails[0].Err != nil || tails[0].Tail.Fact.Content.(Test).Value != 3 {
+				t.Errorf("expected the tail of 3 to be 3, got %+v", tails[0])
+			}
+			if tails[1].Entity != "missing" || !errors.As(tails[1].Err, &EntityNotFound{}) {
+				t.Errorf("expected the missing entity to be EntityNotFound, got %+v", tails[1])
+			}
+			if tails[2].Entity != "1" || tails[2].Err != nil || tails[2].Tail.Total != 3 || tails[2].Tail.Fact.Content.(Test).Value != 4 {
+				t.Errorf("expected the tail of 1 to be 4 of 3 facts, got %+v", tails[2])
+			}
+
+			lists, err := reader.ReadMany("test", entities, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lists) != 3 {
+				t.Fatalf("expected facts for each of the 3 entities, got %d", len(lists))
+			}
+			if lists[1].Entity != "missing" || lists[1].Err != nil || len(lists[1].Records.List) != 0 {
+				t.Errorf("expected no facts for the missing entity, got %+v", lists[1])
+			}
+
+			first := lists[2].Records
+			if lists[2].Entity != "1" || first.Total != 3 || first.PageSize != 2 || len(first.List) != 2 ||
+				first.List[0].Content.(Test).Value != 0 || first.List[1].Content.(Test).Value != 2 {
+				t.Errorf("expected the first 2 of 3 facts of entity 1, got %+v", first)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"github.com/oklog/ulid/v2"
+	"sort"
+	"time"
+)
+
+// TimeAxis is one of the two times every fact carries
+type TimeAxis int
+
+const (
+	// Recorded is the time the fact was appended, its Timestamp
+	Recorded TimeAxis = iota
+	// Occurred is the time the fact happened, its OccurredAt
+	Occurred
+)
+
+// TemporalQuery selects the facts of an entity by either time axis.  Every range includes its start and
+// excludes its end, and a zero time leaves that end unbounded.  Setting RecordedTo to T answers "what did
+// we know as of T", and adding an occurred range narrows that to what we knew about the range.
+type TemporalQuery struct {
+	OccurredFrom time.Time
+	OccurredTo   time.Time
+	RecordedFrom time.Time
+	RecordedTo   time.Time
+	// OrderBy sorts the facts, facts with the same time stay in the order they were recorded
+	OrderBy TimeAxis
+	// Origin is the id of the last fact on the previous page, empty for the first page
+	Origin string
+	// PageSize is the maximum number of facts returned
+	PageSize int
+	// Filter narrows the facts further by type and content
+	Filter ReadFilter
+}
+
+func (q *TemporalQuery) matches(fact Fact) bool {
+	return inRange(fact.Timestamp, q.RecordedFrom, q.RecordedTo) &&
+		inRange(fact.OccurredAt, q.OccurredFrom, q.OccurredTo)
+}
+
+func inRange(t time.Time, from time.Time, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+
+	return to.IsZero() || t.Before(to)
+}
+
+// ReadTemporal reads a page of the entity's facts that match the query.  The Total of the list is the number
+// of facts in the entity, as it is for a filtered read.  In recorded order the read starts after the origin and
+// stops once the page is full.  In occurred order every fact after the origin is read, keeping one page.
+func ReadTemporal(store EventStore, aggregate string, entity string, query TemporalQuery) (*RecordList, error) {
+	filter, err := query.Filter.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	records := RecordList{PageSize: query.PageSize}
+	if records.PageSize < 1 || records.PageSize > maxPageSize {
+		records.PageSize = maxPageSize
+	}
+
+	// an unknown origin is an error, starting over would page through the same facts forever
+	var after *Fact
+	if len(query.Origin) > 0 {
+		after, err = store.Get(aggregate, entity, query.Origin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	origin := ""
+	if query.OrderBy == Recorded {
+		origin = query.Origin
+	}
+
+	var matched []Fact
+	for query.OrderBy == Occurred || len(matched) < records.PageSize {
+		page, err := store.Read(aggregate, entity, origin, maxPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		records.Total = page.Total
+		if len(page.List) == 0 {
+			break
+		}
+
+		for _, fact := range page.List {
+			if query.OrderBy == Occurred && after != nil && !occursAfter(fact, *after) {
+				continue
+			}
+
+			if !query.matches(fact) {
+				continue
+			}
+
+			filtered, err := filter.matches(fact)
+			if err != nil {
+				return nil, err
+			}
+			if filtered {
+				matched = append(matched, fact)
+			}
+		}
+
+		if query.OrderBy == Occurred && len(matched) > 2*records.PageSize {
+			matched = firstOccurred(matched, records.PageSize)
+		}
+
+		origin = page.List[len(page.List)-1].Id.String()
+	}
+
+	if query.OrderBy == Occurred {
+		matched = firstOccurred(matched, records.PageSize)
+	}
+
+	if len(matched) > records.PageSize {
+		matched = matched[:records.PageSize]
+	}
+
+	records.List = matched
+	return &records, nil
+}
+
+// occursAfter orders the facts by when they occurred, and facts that occurred together by when they were recorded
+func occursAfter(fact Fact, other Fact) bool {
+	if !fact.OccurredAt.Equal(other.OccurredAt) {
+		return fact.OccurredAt.After(other.OccurredAt)
+	}
+
+	return fact.Id.Compare(other.Id) > 0
+}
+
+// firstOccurred sorts the facts, which are in the order they were recorded, by when they occurred and keeps
+// the first count
+func firstOccurred(facts []Fact, count int) []Fact {
+	sort.SliceStable(facts, func(i, j int) bool {
+		return facts[i].OccurredAt.Before(facts[j].OccurredAt)
+	})
+
+	if len(facts) > count {
+		facts = facts[:count]
+	}
+
+	return facts
+}
+
+// NewFact creates the next fact for an entity whose last fact is last
+func (o *storeOptions) NewFact(last ulid.ULID, content interface{}, metadata Metadata) Fact {
+	return o.newFact(last, content, metadata)
+}
+
+// newFact creates the next fact for an entity whose last fact is last
+func (o *storeOptions) newFact(last ulid.ULID, content interface{}, metadata Metadata) Fact {
+	now := o.clock.Now().UTC()
+	occurredAt := metadata.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = now
+	}
+
+	return Fact{
+		Id:            followingId(o.generator.NewId(now), last),
+		Timestamp:     now,
+		OccurredAt:    occurredAt.UTC(),
+		Tags:          uniqueTags(metadata.Tags),
+		CorrelationId: metadata.CorrelationId,
+		Content:       content,
+	}
+}
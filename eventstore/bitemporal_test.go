@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadTemporal(t *testing.T) {
+	recorded := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(recorded)
+	store := MemoryStore(WithClock(clock))
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	store.Register(Test{})
+
+	appender := store.(BitemporalAppender)
+	march := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// recorded on June 1st, 2nd and 3rd, the last one a late arrival for March
+	appends := []struct {
+		occurred time.Time
+		value    int
+	}{{april, 1}, {may, 2}, {march, 3}}
+	for _, a := range appends {
+		if _, err := appender.AppendOccurred("test", "1", a.occurred, Test{Value: a.value}); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(24 * time.Hour)
+	}
+
+	current, err := store.Append("test", "1", Test{Value: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.Fact.OccurredAt.Equal(current.Fact.Timestamp) {
+		t.Errorf("expected a fact without an occurred time to occur at %s, got %s", current.Fact.Timestamp, current.Fact.OccurredAt)
+	}
+
+	values := func(query TemporalQuery) []int {
+		records, err := ReadTemporal(store, "test", "1", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if records.Total < uint(len(records.List)) {
+			t.Errorf("total %d is less than the %d facts returned", records.Total, len(records.List))
+		}
+
+		var found []int
+		for _, fact := range records.List {
+			found = append(found, fact.Content.(Test).Value)
+		}
+		return found
+	}
+
+	tests := []struct {
+		name     string
+		query    TemporalQuery
+		expected []int
+	}{
+		{"everything", TemporalQuery{}, []int{1, 2, 3, 4}},
+		{"by occurred time", TemporalQuery{OrderBy: Occurred}, []int{3, 1, 2, 4}},
+		{"occurred range", TemporalQuery{OccurredFrom: march, OccurredTo: may}, []int{1, 3}},
+		{"as of the second day", TemporalQuery{RecordedTo: recorded.Add(25 * time.Hour)}, []int{1, 2}},
+		{"known about spring as of the second day", TemporalQuery{RecordedTo: recorded.Add(25 * time.Hour), OccurredFrom: march, OccurredTo: may}, []int{1}},
+		{"recorded late", TemporalQuery{RecordedFrom: recorded.Add(48 * time.Hour)}, []int{3, 4}},
+		{"paged", TemporalQuery{OrderBy: Occurred, PageSize: 2}, []int{3, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found := values(test.query)
+			if len(found) != len(test.expected) {
+				t.Fatalf("expected %v but got %v", test.expected, found)
+			}
+			for i := range found {
+				if found[i] != test.expected[i] {
+					t.Fatalf("expected %v but got %v", test.expected, found)
+				}
+			}
+		})
+	}
+
+	first, err := ReadTemporal(store, "test", "1", TemporalQuery{OrderBy: Occurred, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := values(TemporalQuery{OrderBy: Occurred, PageSize: 2, Origin: first.List[1].Id.String()})
+	if len(next) != 2 || next[0] != 2 || next[1] != 4 {
+		t.Errorf("expected the second page [2 4] but got %v", next)
+	}
+
+	first, err = ReadTemporal(store, "test", "1", TemporalQuery{PageSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next = values(TemporalQuery{PageSize: 3, Origin: first.List[2].Id.String()})
+	if len(next) != 1 || next[0] != 4 {
+		t.Errorf("expected the second page [4] but got %v", next)
+	}
+
+	_, err = ReadTemporal(store, "test", "1", TemporalQuery{Origin: NewIdGenerator().NewId(recorded).String()})
+	if !errors.As(err, &FactNotFound{}) {
+		t.Errorf("expected FactNotFound for an unknown origin, received %v", err)
+	}
+}
+
+func TestBackdatedFactsAreChained(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	store.Register(Test{})
+
+	occurred := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	add, err := store.(BitemporalAppender).AppendOccurred("test", "1", occurred, Test{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := store.(Verifier).Verify("test", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.Valid || verified.Verified != 1 {
+		t.Errorf("expected the backdated fact to verify, got %+v", verified)
+	}
+
+	// the occurred time is part of the hash, so it cannot be changed without breaking the chain
+	moved := add.Fact
+	moved.OccurredAt = occurred.Add(time.Hour)
+	hash, err := chainHash(nil, moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hash) == string(add.Fact.Hash) {
+		t.Error("expected the occurred time to change the hash")
+	}
+}
@@ -0,0 +1,530 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/oklog/ulid/v2"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const boltFile = "facts.bolt"
+
+var (
+	factsBucket = []byte("facts")
+	statsBucket = []byte("stats")
+	// indexBucket holds the derived index entries with the same keys the badger store uses
+	indexBucket = []byte("indexes")
+)
+
+// BoltEventStore keeps facts in a single bbolt file.  Facts are nested in a bucket per aggregate and
+// entity, and the entity stats are kept in a parallel set of buckets.
+type BoltEventStore struct {
+	RootDir string
+	db      *bolt.DB
+	mu      sync.Mutex
+	storeOptions
+}
+
+func init() {
+	RegisterDriver("bolt", openBolt)
+}
+
+func BoltFileStore(path string, opts ...Option) EventStore {
+	return &BoltEventStore{
+		RootDir:      path,
+		storeOptions: newStoreOptions(opts),
+	}
+}
+
+func openBolt(settings Settings, opts ...Option) (EventStore, error) {
+	if len(settings.EncryptionKey) > 0 {
+		return nil, fmt.Errorf("the bolt event store does not support encryption")
+	}
+
+	return BoltFileStore(settings.Path, opts...), nil
+}
+
+func (b *BoltEventStore) Register(t interface{}) {
+	gob.Register(t)
+}
+
+func (b *BoltEventStore) Append(aggregate string, entity string, content interface{}) (*Tail, error) {
+	return b.AppendWith(aggregate, entity, content, Metadata{})
+}
+
+// AppendOccurred appends content that happened at occurredAt, or now when it is zero
+func (b *BoltEventStore) AppendOccurred(aggregate string, entity string, occurredAt time.Time, content interface{}) (*Tail, error) {
+	return b.AppendWith(aggregate, entity, content, Metadata{OccurredAt: occurredAt})
+}
+
+func (b *BoltEventStore) AppendWith(aggregate string, entity string, content interface{}, metadata Metadata) (*Tail, error) {
+	// bolt only allows one writer at a time, so generating the id inside the transaction
+	// keeps the facts in commit order.
+	return b.update(aggregate, entity, metadata.Subject, func(last ulid.ULID) Fact {
+		return b.newFact(last, content, metadata)
+	})
+}
+
+// AppendFact stores a fact created elsewhere, keeping its id and timestamp
+func (b *BoltEventStore) AppendFact(aggregate string, entity string, fact Fact) (*Tail, error) {
+	return b.AppendFactBy(aggregate, entity, fact, "")
+}
+
+// update stores the fact newFact creates from the entity's last id as the new tail, subject is recorded
+// as the creator of a new entity
+func (b *BoltEventStore) update(aggregate string, entity string, subject string, newFact func(last ulid.ULID) Fact) (*Tail, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	tail := Tail{}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return b.appendTx(tx, aggregate, entity, subject, newFact, &tail)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tail, nil
+}
+
+// appendTx stores the new tail of the entity in the transaction, see update
+func (b *BoltEventStore) appendTx(tx *bolt.Tx, aggregate string, entity string, subject string, newFact func(last ulid.ULID) Fact, tail *Tail) error {
+	facts, err := b.createEntityBucket(tx, aggregate, entity)
+	if err != nil {
+		return err
+	}
+
+	stats, err := b.readEntityStats(tx, aggregate, entity)
+	if err != nil {
+		return err
+	}
+
+	tail.Fact = newFact(stats.LastId)
+	key := []byte(tail.Fact.Id.String())
+	if stats.Total > 0 && tail.Fact.Id.Compare(stats.LastId) <= 0 {
+		if facts.Get(key) == nil {
+			return OutOfOrder{Aggregate: aggregate, Entity: entity, Id: tail.Fact.Id, LastId: stats.LastId}
+		}
+
+		// the fact is already stored
+		tail.Total = stats.Total
+		return nil
+	}
+
+	if err := factExists(tail.Fact.Id, tx.Bucket(indexBucket).Get(locationKey(tail.Fact.Id))); err != nil {
+		return err
+	}
+
+	if err := linkFact(aggregate, entity, stats.LastHash, &tail.Fact); err != nil {
+		return err
+	}
+
+	value, rawSize, err := b.encodeFact(tail.Fact)
+	if err != nil {
+		return err
+	}
+
+	err = facts.Put(key, value)
+	if err != nil {
+		return err
+	}
+
+	entries, err := b.indexEntries(aggregate, entity, tail.Fact)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := putEntry(tx.Bucket(indexBucket), entry); err != nil {
+			return err
+		}
+	}
+
+	stale, modified := stats.touch(aggregate, entity, tail.Fact)
+	if stale != nil {
+		if err := tx.Bucket(indexBucket).Delete(stale); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(indexBucket).Put(modified.key, modified.value); err != nil {
+		return err
+	}
+
+	stats.create(tail.Fact, subject)
+	stats.LastId = tail.Fact.Id
+	stats.LastHash = tail.Fact.Hash
+	stats.Total += 1
+	stats.RawBytes += uint64(rawSize)
+	stats.StoredBytes += uint64(len(value))
+	tail.Total = stats.Total
+
+	return b.updateEntityStats(tx, aggregate, entity, stats)
+}
+
+func (b *BoltEventStore) Read(aggregate string, entity string, factId string, maxCount int) (*RecordList, error) {
+	return b.ReadFiltered(aggregate, entity, factId, maxCount, ReadFilter{})
+}
+
+// ReadFiltered reads the facts of the entity that match the filter, see FilteredReader
+func (b *BoltEventStore) ReadFiltered(aggregate string, entity string, factId string, maxCount int, filter ReadFilter) (*RecordList, error) {
+	matcher, err := filter.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	var records *RecordList
+	err = db.View(func(tx *bolt.Tx) error {
+		records, err = b.readRecordList(tx, aggregate, entity, factId, maxCount, matcher)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (b *BoltEventStore) Tail(aggregate string, entity string) (*Tail, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	var tail *Tail
+	err = db.View(func(tx *bolt.Tx) error {
+		tail, err = b.readTail(tx, aggregate, entity)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tail, nil
+}
+
+// readRecordList reads a page of the entity's facts along with its total
+func (b *BoltEventStore) readRecordList(tx *bolt.Tx, aggregate string, entity string, factId string, maxCount int, filter *factFilter) (*RecordList, error) {
+	var records = RecordList{
+		PageSize: maxCount,
+	}
+
+	if records.PageSize < 1 || records.PageSize > maxPageSize {
+		records.PageSize = maxPageSize
+	}
+
+	stats, err := b.readEntityStats(tx, aggregate, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	records.Total = stats.Total
+
+	facts := b.entityBucket(tx, aggregate, entity)
+	if facts == nil {
+		return &records, nil
+	}
+
+	c := facts.Cursor()
+	k, v := c.Seek([]byte(factId))
+	for ; k != nil && len(records.List) < records.PageSize; k, v = c.Next() {
+		// Ensure that "read from" is reading values after the start value
+		if string(k) <= factId {
+			continue
+		}
+
+		record, err := decodeFactValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		matched, err := filter.matches(*record)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			records.List = append(records.List, *record)
+		}
+	}
+
+	return &records, nil
+}
+
+// readTail reads the last fact of the entity, or returns EntityNotFound
+func (b *BoltEventStore) readTail(tx *bolt.Tx, aggregate string, entity string) (*Tail, error) {
+	stats, err := b.readEntityStats(tx, aggregate, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := b.entityBucket(tx, aggregate, entity)
+	if stats.Total == 0 || facts == nil {
+		return nil, EntityNotFound{Aggregate: aggregate, Entity: entity}
+	}
+
+	value := facts.Get([]byte(stats.LastId.String()))
+	if value == nil {
+		return nil, EntityNotFound{Aggregate: aggregate, Entity: entity}
+	}
+
+	record, err := decodeFactValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tail{Fact: *record, Total: stats.Total}, nil
+}
+
+func (b *BoltEventStore) Get(aggregate string, entity string, factId string) (*Fact, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	var fact *Fact
+	err = db.View(func(tx *bolt.Tx) error {
+		var value []byte
+		if facts := b.entityBucket(tx, aggregate, entity); facts != nil {
+			value = facts.Get([]byte(factId))
+		}
+		if value == nil {
+			return FactNotFound{Id: factId}
+		}
+
+		fact, err = decodeFactValue(value)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fact, nil
+}
+
+func (b *BoltEventStore) Scan(aggregate string) (*EntityList, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := EntityList{}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		agg := tx.Bucket(factsBucket).Bucket([]byte(aggregate))
+		if agg == nil {
+			return nil
+		}
+
+		return agg.ForEach(func(k, _ []byte) error {
+			keys.List = append(keys.List, string(k))
+			keys.Total += 1
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &keys, nil
+}
+
+func (b *BoltEventStore) Verify(aggregate string, entity string) (*Verification, error) {
+	return verifyChain(b, aggregate, entity)
+}
+
+func (b *BoltEventStore) Aggregates() ([]string, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregates []string
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(factsBucket).ForEach(func(k, _ []byte) error {
+			aggregates = append(aggregates, string(k))
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aggregates, nil
+}
+
+func (b *BoltEventStore) CompressionStats(aggregate string) (*CompressionStats, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := CompressionStats{}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		agg := tx.Bucket(statsBucket).Bucket([]byte(aggregate))
+		if agg == nil {
+			return nil
+		}
+
+		return agg.ForEach(func(_, v []byte) error {
+			stats := AggregateStats{}
+			if err := decodeStats(v, &stats); err != nil {
+				return err
+			}
+
+			summary.Facts += stats.Total
+			summary.RawBytes += stats.RawBytes
+			summary.StoredBytes += stats.StoredBytes
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+func (b *BoltEventStore) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.db != nil {
+		if err := b.db.Close(); err != nil {
+			return err
+		}
+		b.db = nil
+	}
+
+	return nil
+}
+
+func (b *BoltEventStore) boltDb() (*bolt.DB, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.db != nil {
+		return b.db, nil
+	}
+
+	if err := os.MkdirAll(b.RootDir, 0700); err != nil {
+		return nil, err
+	}
+
+	b.Register(Fact{})
+	db, err := bolt.Open(filepath.Join(b.RootDir, boltFile), 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{factsBucket, statsBucket, indexBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		if err := b.syncIndexes(tx); err != nil {
+			return err
+		}
+
+		return b.syncModified(tx)
+	})
+
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	b.db = db
+	return b.db, nil
+}
+
+// entityBucket returns the bucket holding the entity's facts, or nil if there are none
+func (b *BoltEventStore) entityBucket(tx *bolt.Tx, aggregate string, entity string) *bolt.Bucket {
+	agg := tx.Bucket(factsBucket).Bucket([]byte(aggregate))
+	if agg == nil {
+		return nil
+	}
+
+	return agg.Bucket([]byte(entity))
+}
+
+func (b *BoltEventStore) createEntityBucket(tx *bolt.Tx, aggregate string, entity string) (*bolt.Bucket, error) {
+	agg, err := tx.Bucket(factsBucket).CreateBucketIfNotExists([]byte(aggregate))
+	if err != nil {
+		return nil, err
+	}
+
+	return agg.CreateBucketIfNotExists([]byte(entity))
+}
+
+func (b *BoltEventStore) readEntityStats(tx *bolt.Tx, aggregate string, entity string) (*AggregateStats, error) {
+	stats := AggregateStats{}
+
+	agg := tx.Bucket(statsBucket).Bucket([]byte(aggregate))
+	if agg == nil {
+		// This is a virgin aggregate so there is nothing to read
+		return &stats, nil
+	}
+
+	value := agg.Get([]byte(entity))
+	if value == nil {
+		return &stats, nil
+	}
+
+	if err := decodeStats(value, &stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (b *BoltEventStore) updateEntityStats(tx *bolt.Tx, aggregate string, entity string, stats *AggregateStats) error {
+	agg, err := tx.Bucket(statsBucket).CreateBucketIfNotExists([]byte(aggregate))
+	if err != nil {
+		return err
+	}
+
+	value, err := encodeStats(stats)
+	if err != nil {
+		return err
+	}
+
+	return agg.Put([]byte(entity), value)
+}
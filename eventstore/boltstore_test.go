@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBoltEventStoreAppendAndRead(t *testing.T) {
+	store := BoltFileStore(t.TempDir())
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	aggregate := "test"
+	key := "1"
+
+	var lastEvt string
+	for i := 0; i < 5; i++ {
+		add, err := store.Append(aggregate, key, Test{Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 1 {
+			lastEvt = add.Fact.Id.String()
+		}
+	}
+
+	results, err := store.Read(aggregate, key, lastEvt, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results.Total != 5 {
+		t.Errorf("expected %d grand total events in the store, but there are %d", 5, results.Total)
+	}
+
+	verifyListLength(t, results, 3)
+
+	if !reflect.DeepEqual(results.List[0].Content, Test{Value: 2}) {
+		t.Errorf("expected the fact after %s, received %v", lastEvt, results.List[0].Content)
+	}
+
+	tail, err := store.Tail(aggregate, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tail.Fact.Id != lastEvent(results).Id {
+		t.Errorf("expected tail '%s' but received tail '%s'", lastEvent(results).Id, tail.Fact.Id)
+	}
+}
+
+func TestBoltEventStoreScanAggregate(t *testing.T) {
+	store := BoltFileStore(t.TempDir())
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+
+	for _, key := range []string{"b", "a", "c"} {
+		if _, err := store.Append("barney", key, Test{Value: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := store.Append("fred", "z", Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.Scan("barney")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(keys.List, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected keys: %v", keys.List)
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	_, err := Open("floppy", Settings{Path: t.TempDir()})
+	if err == nil {
+		t.Error("expected an error for an unknown driver")
+	}
+}
+
+func TestOpenBoltDriver(t *testing.T) {
+	store, err := Open("bolt", Settings{Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.(*BoltEventStore); !ok {
+		t.Errorf("expected a bolt event store, received %T", store)
+	}
+
+	if _, err := Open("bolt", Settings{Path: t.TempDir(), EncryptionKey: []byte("secret")}); err == nil {
+		t.Error("expected an error because bolt does not support encryption")
+	}
+}
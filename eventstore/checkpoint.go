@@ -0,0 +1,380 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/oklog/ulid/v2"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	checkpointPrefix = []byte(systemPrefix + "checkpoint|")
+	leavesPrefix     = []byte(systemPrefix + "checkpoint-leaves|")
+	proofPrefix      = []byte(systemPrefix + "proof|")
+)
+
+// Checkpoint is a signed statement of the facts appended to the store since the previous checkpoint
+type Checkpoint struct {
+	// Sequence numbers the checkpoints from 1
+	Sequence  uint64
+	Timestamp time.Time
+	// Version is the store version the checkpoint covers
+	Version uint64
+	// Size is the number of facts in the Merkle tree
+	Size uint64
+	// Root of the Merkle tree over the fact hashes
+	Root []byte
+	// PreviousRoot links the checkpoint to the one before it
+	PreviousRoot []byte
+	// Signature is the Ed25519 signature of SignedBytes
+	Signature []byte
+}
+
+// SignedBytes is the statement the checkpoint's signature covers
+func (c *Checkpoint) SignedBytes() []byte {
+	return []byte(fmt.Sprintf("fact-totem checkpoint v1\n%d\n%d\n%d\n%x\n%x\n",
+		c.Sequence, c.Size, c.Timestamp.UnixNano(), c.PreviousRoot, c.Root))
+}
+
+// InclusionProof proves a fact is covered by a signed checkpoint
+type InclusionProof struct {
+	Aggregate string
+	Entity    string
+	Id        ulid.ULID
+	// Hash is the fact's hash chain value, the Merkle leaf is built from it
+	Hash []byte
+	// Index of the fact's leaf in the checkpoint's Merkle tree
+	Index uint64
+	// Path is the audit path from the leaf to the root, closest sibling first
+	Path       [][]byte
+	Checkpoint Checkpoint
+}
+
+// Verify checks the proof leads to the checkpoint root and the checkpoint was signed by key
+func (p *InclusionProof) Verify(key ed25519.PublicKey) error {
+	root := merkleRootFromPath(p.Index, p.Checkpoint.Size, merkleLeaf(p.Hash), p.Path)
+	if root == nil || !bytes.Equal(root, p.Checkpoint.Root) {
+		return fmt.Errorf("fact %s is not included in checkpoint %d", p.Id, p.Checkpoint.Sequence)
+	}
+
+	if !ed25519.Verify(key, p.Checkpoint.SignedBytes(), p.Checkpoint.Signature) {
+		return fmt.Errorf("checkpoint %d signature is not valid", p.Checkpoint.Sequence)
+	}
+
+	return nil
+}
+
+// Checkpointer is implemented by event stores that can sign periodic checkpoints of their facts
+type Checkpointer interface {
+	// Checkpoint builds a Merkle tree over the facts appended since the previous checkpoint, signs its
+	// root and stores it.  It returns nil when no facts were appended.
+	Checkpoint(key ed25519.PrivateKey) (*Checkpoint, error)
+	// LatestCheckpoint returns the newest checkpoint, nil when there is none
+	LatestCheckpoint() (*Checkpoint, error)
+	// Proof returns the inclusion proof of a fact, or NotCheckpointed when no checkpoint covers it yet
+	Proof(factId string) (*InclusionProof, error)
+}
+
+// checkpointLeaf is a fact in a checkpoint's Merkle tree
+type checkpointLeaf struct {
+	Aggregate string
+	Entity    string
+	Id        ulid.ULID
+	Hash      []byte
+}
+
+// proofLocation finds a fact's leaf
+type proofLocation struct {
+	Sequence uint64
+	Index    uint64
+}
+
+func (b *BadgerEventStore) Checkpoint(key ed25519.PrivateKey) (*Checkpoint, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	b.writers.RLock()
+	defer b.writers.RUnlock()
+
+	b.checkpointMu.Lock()
+	defer b.checkpointMu.Unlock()
+
+	previous, err := b.LatestCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := Checkpoint{Sequence: 1}
+	if previous != nil {
+		checkpoint.Sequence = previous.Sequence + 1
+		checkpoint.PreviousRoot = previous.Root
+	}
+
+	var leaves []checkpointLeaf
+	err = db.View(func(txn *badger.Txn) error {
+		checkpoint.Version = txn.ReadTs()
+		leaves, err = b.leavesSince(txn, previous)
+		return err
+	})
+
+	if err != nil || len(leaves) == 0 {
+		return nil, err
+	}
+
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = merkleLeaf(leaf.Hash)
+	}
+
+	checkpoint.Timestamp = b.clock.Now().UTC()
+	checkpoint.Size = uint64(len(leaves))
+	checkpoint.Root = merkleRoot(hashes)
+	checkpoint.Signature = ed25519.Sign(key, checkpoint.SignedBytes())
+
+	// The leaves and proof locations are written first, a checkpoint only exists once its own key is written
+	batch := db.NewWriteBatch()
+	defer batch.Cancel()
+
+	if err := setGob(batch, sequenceKey(leavesPrefix, checkpoint.Sequence), leaves); err != nil {
+		return nil, err
+	}
+
+	for i, leaf := range leaves {
+		location := proofLocation{Sequence: checkpoint.Sequence, Index: uint64(i)}
+		if err := setGob(batch, proofKey(leaf.Id.String()), location); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		return setGob(txn, sequenceKey(checkpointPrefix, checkpoint.Sequence), checkpoint)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+// leavesSince collects the hashed facts written after the previous checkpoint, in fact id order.  The
+// iterator skips the tables written before the checkpoint's version and only reads the values of new facts.
+func (b *BadgerEventStore) leavesSince(txn *badger.Txn, previous *Checkpoint) ([]checkpointLeaf, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	if previous != nil {
+		opts.SinceTs = previous.Version
+	}
+
+	var leaves []checkpointLeaf
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		key := string(item.Key())
+
+		if item.Version() <= opts.SinceTs || strings.HasPrefix(key, systemPrefix) {
+			continue
+		}
+
+		// Only fact keys have three parts, the stats keys have two
+		parts := strings.Split(key, separator)
+		if len(parts) != 3 {
+			continue
+		}
+
+		fact, err := decodeFact(item)
+		if err != nil {
+			return nil, err
+		}
+
+		// Facts appended before hashing was added cannot be proven
+		if len(fact.Hash) == 0 {
+			continue
+		}
+
+		leaves = append(leaves, checkpointLeaf{Aggregate: parts[0], Entity: parts[1], Id: fact.Id, Hash: fact.Hash})
+	}
+
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].Id.Compare(leaves[j].Id) < 0
+	})
+
+	return leaves, nil
+}
+
+func (b *BadgerEventStore) LatestCheckpoint() (*Checkpoint, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint *Checkpoint
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.Prefix = checkpointPrefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		it.Seek(sequenceKey(checkpointPrefix, ^uint64(0)))
+		if !it.ValidForPrefix(checkpointPrefix) {
+			return nil
+		}
+
+		checkpoint = &Checkpoint{}
+		return it.Item().Value(func(val []byte) error {
+			return gob.NewDecoder(bytes.NewReader(val)).Decode(checkpoint)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+func (b *BadgerEventStore) Proof(factId string) (*InclusionProof, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	proof := InclusionProof{}
+	err = db.View(func(txn *badger.Txn) error {
+		var location proofLocation
+		if err := readGob(txn, proofKey(factId), &location); err != nil {
+			return err
+		}
+
+		if err := readGob(txn, sequenceKey(checkpointPrefix, location.Sequence), &proof.Checkpoint); err != nil {
+			return err
+		}
+
+		var leaves []checkpointLeaf
+		if err := readGob(txn, sequenceKey(leavesPrefix, location.Sequence), &leaves); err != nil {
+			return err
+		}
+
+		if location.Index >= uint64(len(leaves)) {
+			return fmt.Errorf("checkpoint %d has no leaf %d", location.Sequence, location.Index)
+		}
+
+		hashes := make([][]byte, len(leaves))
+		for i, leaf := range leaves {
+			hashes[i] = merkleLeaf(leaf.Hash)
+		}
+
+		leaf := leaves[location.Index]
+		proof.Aggregate = leaf.Aggregate
+		proof.Entity = leaf.Entity
+		proof.Id = leaf.Id
+		proof.Hash = leaf.Hash
+		proof.Index = location.Index
+		proof.Path = merklePath(int(location.Index), hashes)
+		return nil
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, NotCheckpointed{Id: factId}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &proof, nil
+}
+
+// CheckpointSchedule signs a checkpoint of the new facts every Interval
+type CheckpointSchedule struct {
+	Store    Checkpointer
+	Key      ed25519.PrivateKey
+	Interval time.Duration
+}
+
+// Run signs checkpoints until the context is cancelled
+func (s *CheckpointSchedule) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkpoint, err := s.Store.Checkpoint(s.Key)
+			if err != nil {
+				log.Printf("Checkpoint failed: %s", err)
+			} else if checkpoint != nil {
+				log.Printf("Checkpoint %d signed over %d facts", checkpoint.Sequence, checkpoint.Size)
+			}
+		}
+	}
+}
+
+func sequenceKey(prefix []byte, sequence uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], sequence)
+	return key
+}
+
+func proofKey(factId string) []byte {
+	return []byte(string(proofPrefix) + factId)
+}
+
+// setGob writes the gob encoded value with a transaction or a write batch
+func setGob(w interface{ Set(key, val []byte) error }, key []byte, value interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return err
+	}
+
+	return w.Set(key, buf.Bytes())
+}
+
+func readGob(txn *badger.Txn, key []byte, value interface{}) error {
+	item, err := txn.Get(key)
+	if err != nil {
+		return err
+	}
+
+	return item.Value(func(val []byte) error {
+		return gob.NewDecoder(bytes.NewReader(val)).Decode(value)
+	})
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMerklePathsLeadToRoot(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		var leaves [][]byte
+		for i := 0; i < size; i++ {
+			leaves = append(leaves, merkleLeaf([]byte(fmt.Sprintf("fact %d", i))))
+		}
+
+		root := merkleRoot(leaves)
+		for i := range leaves {
+			path := merklePath(i, leaves)
+			if computed := merkleRootFromPath(uint64(i), uint64(size), leaves[i], path); !bytes.Equal(computed, root) {
+				t.Errorf("size %d leaf %d: path does not lead to the root", size, i)
+			}
+
+			if size > 1 {
+				if computed := merkleRootFromPath(uint64(i), uint64(size), leaves[(i+1)%size], path); bytes.Equal(computed, root) {
+					t.Errorf("size %d leaf %d: path proves the wrong leaf", size, i)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckpointInclusionProofs(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer store.Close()
+	store.Register(Test{})
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var first []Fact
+	for i := 0; i < 5; i++ {
+		tail, err := store.Append("checkpoint", fmt.Sprint(i%2), Test{Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		first = append(first, tail.Fact)
+	}
+
+	checkpoint, err := store.Checkpoint(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checkpoint == nil || checkpoint.Sequence != 1 || checkpoint.Size != 5 {
+		t.Fatalf("expected checkpoint 1 over 5 facts, received %+v", checkpoint)
+	}
+
+	if empty, err := store.Checkpoint(private); err != nil || empty != nil {
+		t.Errorf("expected no checkpoint without new facts, received %+v, %v", empty, err)
+	}
+
+	tail, err := store.Append("checkpoint", "2", Test{Value: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Proof(tail.Fact.Id.String()); !errors.As(err, &NotCheckpointed{}) {
+		t.Errorf("expected NotCheckpointed before the next checkpoint, received %v", err)
+	}
+
+	second, err := store.Checkpoint(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Sequence != 2 || second.Size != 1 || !bytes.Equal(second.PreviousRoot, checkpoint.Root) {
+		t.Errorf("expected checkpoint 2 over 1 fact linked to checkpoint 1, received %+v", second)
+	}
+
+	for _, fact := range append(first, tail.Fact) {
+		proof, err := store.Proof(fact.Id.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := proof.Verify(public); err != nil {
+			t.Errorf("fact %s: %v", fact.Id, err)
+		}
+	}
+
+	proof, err := store.Proof(first[2].Id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof.Hash = first[3].Hash
+	if err := proof.Verify(public); err == nil {
+		t.Error("expected a proof for altered fact hash to fail")
+	}
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	proof.Hash = first[2].Hash
+	if err := proof.Verify(other); err == nil {
+		t.Error("expected a proof checked with another key to fail")
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"github.com/oklog/ulid/v2"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	if now := clock.Now(); !now.Equal(start) {
+		t.Errorf("expected %s but got %s", start, now)
+	}
+
+	if now := clock.Advance(time.Hour); !now.Equal(start.Add(time.Hour)) || !clock.Now().Equal(now) {
+		t.Errorf("expected the clock to move an hour, got %s", clock.Now())
+	}
+
+	clock.Set(start)
+	if now := clock.Now(); !now.Equal(start) {
+		t.Errorf("expected %s but got %s", start, now)
+	}
+}
+
+func TestAppendUsesTheClock(t *testing.T) {
+	stores := map[string]func(clock Clock) EventStore{
+		"badger": func(clock Clock) EventStore { return MemoryStore(WithClock(clock)) },
+		"bolt":   func(clock Clock) EventStore { return BoltFileStore(t.TempDir(), WithClock(clock)) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+			clock := NewFakeClock(start)
+			store := open(clock)
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(Test{})
+
+			first, err := store.Append("test", "1", Test{Value: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !first.Fact.Timestamp.Equal(start) {
+				t.Errorf("expected timestamp %s but got %s", start, first.Fact.Timestamp)
+			}
+			if ms := first.Fact.Id.Time(); ms != ulid.Timestamp(start) {
+				t.Errorf("expected the id time %d but got %d", ulid.Timestamp(start), ms)
+			}
+
+			// a clock that goes back still appends after the tail
+			clock.Set(start.Add(-time.Minute))
+			second, err := store.Append("test", "1", Test{Value: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if second.Fact.Id.Compare(first.Fact.Id) <= 0 {
+				t.Errorf("id %s does not follow %s", second.Fact.Id, first.Fact.Id)
+			}
+			if !second.Fact.Timestamp.Equal(start.Add(-time.Minute)) {
+				t.Errorf("expected timestamp %s but got %s", start.Add(-time.Minute), second.Fact.Timestamp)
+			}
+		})
+	}
+}
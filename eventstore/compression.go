@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"strings"
+	"sync"
+)
+
+// Compression identifies the codec used to compress fact content.
+type Compression byte
+
+const (
+	NoCompression Compression = iota
+	Snappy
+	Zstd
+)
+
+// headerMarker flags values written with a compression header.  A gob stream never starts with a byte
+// between 0x80 and 0xF7, so values stored before compression was introduced are still recognized.
+const headerMarker byte = 0x80
+
+var compressionNames = map[Compression]string{
+	NoCompression: "none",
+	Snappy:        "snappy",
+	Zstd:          "zstd",
+}
+
+var (
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdOnce    sync.Once
+	zstdErr     error
+)
+
+func (c Compression) String() string {
+	return compressionNames[c]
+}
+
+// ParseCompression converts the configured name into a Compression.  An empty name means no compression.
+func ParseCompression(name string) (Compression, error) {
+	if len(name) == 0 {
+		return NoCompression, nil
+	}
+
+	for c, n := range compressionNames {
+		if strings.EqualFold(n, name) {
+			return c, nil
+		}
+	}
+
+	return NoCompression, fmt.Errorf("unsupported compression: '%s'", name)
+}
+
+// compress wraps the encoded fact with a header, compressing it when it meets the threshold.
+func compress(codec Compression, threshold int, value []byte) ([]byte, error) {
+	if len(value) < threshold {
+		codec = NoCompression
+	}
+
+	header := []byte{headerMarker | byte(codec)}
+
+	switch codec {
+	case Snappy:
+		return append(header, snappy.Encode(nil, value)...), nil
+	case Zstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdEncoder.EncodeAll(value, header), nil
+	}
+
+	return append(header, value...), nil
+}
+
+// decompress strips the header and returns the encoded fact.  Values without a header are returned as is.
+func decompress(value []byte) ([]byte, error) {
+	if len(value) == 0 || value[0] < headerMarker || value[0] > headerMarker|byte(Zstd) {
+		return value, nil
+	}
+
+	codec := Compression(value[0] &^ headerMarker)
+	body := value[1:]
+
+	switch codec {
+	case Snappy:
+		return snappy.Decode(nil, body)
+	case Zstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdDecoder.DecodeAll(body, nil)
+	}
+
+	return body, nil
+}
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+
+	return zstdErr
+}
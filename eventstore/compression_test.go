@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	value := []byte(strings.Repeat("compress me please ", 50))
+
+	for _, codec := range []Compression{NoCompression, Snappy, Zstd} {
+		stored, err := compress(codec, 0, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if codec != NoCompression && len(stored) >= len(value) {
+			t.Errorf("%s: expected compressed size below %d, received %d", codec, len(value), len(stored))
+		}
+
+		restored, err := decompress(stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(value, restored) {
+			t.Errorf("%s: content did not survive the round trip", codec)
+		}
+	}
+}
+
+func TestCompressBelowThreshold(t *testing.T) {
+	value := []byte("tiny")
+
+	stored, err := compress(Zstd, 1024, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored[0] != headerMarker {
+		t.Errorf("expected uncompressed header, received %x", stored[0])
+	}
+}
+
+func TestDecompressLegacyValue(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(Fact{}); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := decompress(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), restored) {
+		t.Error("values without a header should be returned untouched")
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, expected := range map[string]Compression{"": NoCompression, "none": NoCompression, "Snappy": Snappy, "zstd": Zstd} {
+		codec, err := ParseCompression(name)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if codec != expected {
+			t.Errorf("'%s': expected %s, received %s", name, expected, codec)
+		}
+	}
+
+	if _, err := ParseCompression("lzma"); err == nil {
+		t.Error("expected an error for an unsupported codec")
+	}
+}
+
+func TestBadgerEventStoreCompressionStats(t *testing.T) {
+	store := MemoryStore(WithCompression(Zstd, 0))
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	aggregate := "squeeze"
+
+	for _, key := range []string{"a", "b"} {
+		for i := 0; i < 3; i++ {
+			if _, err := store.Append(aggregate, key, Test{Value: i}); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	results, err := store.Read(aggregate, "a", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyListLength(t, results, 3)
+
+	stats, err := store.(CompressionReporter).CompressionStats(aggregate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Facts != 6 {
+		t.Errorf("expected 6 facts, received %d", stats.Facts)
+	}
+
+	if stats.RawBytes == 0 || stats.StoredBytes == 0 {
+		t.Errorf("expected sizes to be tracked, received %+v", stats)
+	}
+}
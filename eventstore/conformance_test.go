@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore_test
+
+import (
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/D-Haven/fact-totem/eventstore/eventstoretest"
+	"testing"
+)
+
+func TestBadgerEventStoreConformance(t *testing.T) {
+	eventstoretest.Run(t, func(dir string) (eventstore.EventStore, error) {
+		return eventstore.FileStore(dir), nil
+	})
+}
+
+func TestCompressedBadgerEventStoreConformance(t *testing.T) {
+	eventstoretest.Run(t, func(dir string) (eventstore.EventStore, error) {
+		return eventstore.FileStore(dir, eventstore.WithCompression(eventstore.Zstd, 0)), nil
+	})
+}
+
+func TestBoltEventStoreConformance(t *testing.T) {
+	eventstoretest.Run(t, func(dir string) (eventstore.EventStore, error) {
+		return eventstore.BoltFileStore(dir), nil
+	})
+}
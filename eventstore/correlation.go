@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"github.com/oklog/ulid/v2"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	correlationKeyPrefix = systemPrefix + "correlation" + indexSeparator
+	// MaxCorrelationIdLength is the longest correlation id in bytes
+	MaxCorrelationIdLength = 128
+)
+
+// CorrelatedFact is a fact along with the aggregate and entity it belongs to
+type CorrelatedFact struct {
+	Aggregate string
+	Entity    string
+	Fact      Fact
+}
+
+// Correlator is implemented by event stores that index the correlation ids of their facts
+type Correlator interface {
+	// Correlated lists every fact with the correlation id, in any aggregate the filter includes, ordered
+	// by timestamp.  A nil filter includes every aggregate.
+	Correlated(correlationId string, include func(aggregate string) bool) ([]CorrelatedFact, error)
+}
+
+// ValidateCorrelationId checks that a correlation id can be stored.  An empty id means the fact has none.
+func ValidateCorrelationId(correlationId string) error {
+	switch {
+	case len(correlationId) > MaxCorrelationIdLength:
+		return InvalidCorrelationId{CorrelationId: correlationId, Reason: "correlation ids are limited to 128 bytes"}
+	case !utf8.ValidString(correlationId):
+		return InvalidCorrelationId{CorrelationId: correlationId, Reason: "correlation ids must be UTF-8 text"}
+	case strings.Contains(correlationId, indexSeparator):
+		return InvalidCorrelationId{CorrelationId: correlationId, Reason: "correlation ids cannot contain a NUL character"}
+	}
+
+	return nil
+}
+
+// correlationEntries are the correlation index entries of a fact.  Unlike the other indexes, the key
+// names the aggregate so one correlation id can be followed across all of them.
+func correlationEntries(aggregate string, entity string, fact Fact) ([]indexEntry, error) {
+	if len(fact.CorrelationId) == 0 {
+		return nil, nil
+	}
+
+	if err := ValidateCorrelationId(fact.CorrelationId); err != nil {
+		return nil, err
+	}
+
+	key := correlationPrefix(fact.CorrelationId) + fact.Id.String() + indexSeparator + aggregate + indexSeparator + entity
+	return []indexEntry{{key: []byte(key)}}, nil
+}
+
+func correlationPrefix(correlationId string) string {
+	return correlationKeyPrefix + correlationId + indexSeparator
+}
+
+// correlated reads every fact the correlation index points to, one aggregate at a time
+func correlated(store factFetcher, correlationId string, include func(aggregate string) bool) ([]CorrelatedFact, error) {
+	prefix := correlationPrefix(correlationId)
+
+	var aggregates []string
+	matches := map[string][]IndexMatch{}
+	err := store.scanPrefix([]byte(prefix), func(key []byte, _ []byte) error {
+		// the fact id is followed by the aggregate and the entity, which may hold anything
+		parts := strings.SplitN(string(key[len(prefix):]), indexSeparator, 3)
+		if len(parts) != 3 {
+			return nil
+		}
+
+		id, err := ulid.ParseStrict(parts[0])
+		if err != nil {
+			return nil
+		}
+
+		aggregate := parts[1]
+		if include != nil && !include(aggregate) {
+			return nil
+		}
+
+		if _, seen := matches[aggregate]; !seen {
+			aggregates = append(aggregates, aggregate)
+		}
+		matches[aggregate] = append(matches[aggregate], IndexMatch{Entity: parts[2], Id: id})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var facts []CorrelatedFact
+	for _, aggregate := range aggregates {
+		found, err := store.fetchFacts(aggregate, matches[aggregate])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fact := range found {
+			facts = append(facts, CorrelatedFact{Aggregate: aggregate, Entity: fact.Entity, Fact: fact.Fact})
+		}
+	}
+
+	// fact ids only order the facts of one entity, the timestamps order the whole set
+	sort.SliceStable(facts, func(i, j int) bool {
+		if facts[i].Fact.Timestamp.Equal(facts[j].Fact.Timestamp) {
+			return facts[i].Fact.Id.Compare(facts[j].Fact.Id) < 0
+		}
+		return facts[i].Fact.Timestamp.Before(facts[j].Fact.Timestamp)
+	})
+
+	return facts, nil
+}
+
+func (b *BadgerEventStore) Correlated(correlationId string, include func(aggregate string) bool) ([]CorrelatedFact, error) {
+	return correlated(b, correlationId, include)
+}
+
+func (b *BoltEventStore) Correlated(correlationId string, include func(aggregate string) bool) ([]CorrelatedFact, error) {
+	return correlated(b, correlationId, include)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oklog/ulid/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCorrelated(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore(WithClock(clock)) },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir(), WithClock(clock)) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(Test{})
+			appender := store.(MetadataAppender)
+
+			appends := []struct {
+				aggregate     string
+				entity        string
+				correlationId string
+			}{
+				{"orders", "1", "checkout-1"},
+				{"payments", "9", "checkout-1"},
+				{"orders", "2", "checkout-2"},
+				{"shipments", "4", "checkout-1"},
+				{"orders", "1", ""},
+			}
+			for i, a := range appends {
+				clock.Advance(time.Minute)
+				if _, err := appender.AppendWith(a.aggregate, a.entity, Test{Value: i}, Metadata{CorrelationId: a.correlationId}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// a fact imported from elsewhere sorts by its timestamp, not its id
+			imported := Fact{
+				Id:            ulid.MustNew(ulid.Timestamp(clock.Now().Add(time.Hour)), strings.NewReader(strings.Repeat("\x00", 16))),
+				Timestamp:     clock.Now().Add(-time.Hour),
+				CorrelationId: "checkout-1",
+				Content:       Test{Value: 8},
+			}
+			if _, err := store.(Importer).AppendFact("audit", "x", imported); err != nil {
+				t.Fatal(err)
+			}
+
+			correlator := store.(Correlator)
+			values := func(correlationId string, include func(string) bool) string {
+				facts, err := correlator.Correlated(correlationId, include)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found []string
+				for _, f := range facts {
+					found = append(found, fmt.Sprintf("%s/%s:%d", f.Aggregate, f.Entity, f.Fact.Content.(Test).Value))
+				}
+				return strings.Join(found, " ")
+			}
+
+			expectText(t, "checkout-1", "audit/x:8 orders/1:0 payments/9:1 shipments/4:3", values("checkout-1", nil))
+			expectText(t, "checkout-2", "orders/2:2", values("checkout-2", nil))
+			expectText(t, "unknown", "", values("unknown", nil))
+			expectText(t, "filtered", "orders/1:0 shipments/4:3", values("checkout-1", func(aggregate string) bool {
+				return aggregate == "orders" || aggregate == "shipments"
+			}))
+
+			verified, err := store.(Verifier).Verify("payments", "9")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verified.Valid {
+				t.Errorf("expected the correlated fact to verify: %s", verified.Reason)
+			}
+
+			_, err = appender.AppendWith("orders", "1", Test{Value: 9}, Metadata{CorrelationId: "a\x00b"})
+			if !errors.As(err, &InvalidCorrelationId{}) {
+				t.Errorf("expected InvalidCorrelationId but got %v", err)
+			}
+		})
+	}
+}
+
+func TestCorrelationIdIsHashed(t *testing.T) {
+	fact := Fact{Content: "x"}
+	plain, err := chainHash(nil, fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fact.CorrelationId = "checkout-1"
+	correlated, err := chainHash(nil, fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(plain) == string(correlated) {
+		t.Error("expected the correlation id to change the hash")
+	}
+}
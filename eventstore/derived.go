@@ -0,0 +1,494 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/dgraph-io/badger/v4"
+	bolt "go.etcd.io/bbolt"
+	"strings"
+)
+
+const (
+	// indexSeparator splits the parts of a derived index key, it cannot appear in JSON text
+	indexSeparator = "\x00"
+	// indexDefPrefix followed by the prefix of an index holds the definition it was built with
+	indexDefPrefix = systemPrefix + "index-def" + indexSeparator
+)
+
+// derivedIndex is kept up to date from the facts appended to an aggregate, in the same transaction
+type derivedIndex interface {
+	// aggregate is the aggregate the index is built from, empty for an index over every aggregate
+	aggregate() string
+	// prefix starts the key of every entry in the index
+	prefix() []byte
+	// definition is compared to the definition the index was built with, the index is rebuilt when it changes
+	definition() string
+	// entries are the keys and values to store for a fact
+	entries(document interface{}, aggregate string, entity string, fact Fact) []indexEntry
+}
+
+type indexEntry struct {
+	key   []byte
+	value []byte
+	// count entries hold a counter that each fact adds one to, instead of a value
+	count bool
+}
+
+// prefixScanner is implemented by the stores in this package to read the derived indexes
+type prefixScanner interface {
+	// scanPrefix calls fn with every key and value that starts with the prefix, in key order.  Neither
+	// is valid after fn returns.
+	scanPrefix(prefix []byte, fn func(key []byte, value []byte) error) error
+	// scanPrefixFrom is scanPrefix starting at the first key at or after start
+	scanPrefixFrom(prefix []byte, start []byte, fn func(key []byte, value []byte) error) error
+}
+
+// countValue reads the counter stored in value, which is empty before the first fact is counted
+func countValue(value []byte) uint64 {
+	if len(value) != 8 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(value)
+}
+
+// addCount adds n to the counter stored in value
+func addCount(value []byte, n uint64) []byte {
+	return encodeVersion(countValue(value) + n)
+}
+
+func indexDefKey(index derivedIndex) []byte {
+	return append([]byte(indexDefPrefix), index.prefix()...)
+}
+
+// indexEntries are the entries to store for the fact in its tag, correlation and location indexes and the
+// aggregate's derived indexes
+func (o *storeOptions) indexEntries(aggregate string, entity string, fact Fact) ([]indexEntry, error) {
+	entries, err := tagEntries(aggregate, entity, fact)
+	if err != nil {
+		return nil, err
+	}
+
+	correlation, err := correlationEntries(aggregate, entity, fact)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, correlation...)
+	entries = append(entries, locationEntry(aggregate, entity, fact))
+
+	indexes := o.derived[aggregate]
+	if len(indexes) == 0 {
+		return entries, nil
+	}
+
+	document, err := factDocument(fact)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range indexes {
+		entries = append(entries, index.entries(document, aggregate, entity, fact)...)
+	}
+
+	return entries, nil
+}
+
+// staleIndexes compares the definitions the indexes were built with, by definition key, to the configured
+// indexes.  The indexes to rebuild changed or are new, the prefixes to drop belong to removed indexes.
+func (o *storeOptions) staleIndexes(built map[string]string) (rebuild []derivedIndex, drop [][]byte) {
+	configured := map[string]bool{}
+	for _, indexes := range o.derived {
+		for _, index := range indexes {
+			key := string(indexDefKey(index))
+			configured[key] = true
+
+			if definition, ok := built[key]; !ok || definition != index.definition() {
+				rebuild = append(rebuild, index)
+			}
+		}
+	}
+
+	for key := range built {
+		if !configured[key] {
+			drop = append(drop, []byte(strings.TrimPrefix(key, indexDefPrefix)))
+		}
+	}
+
+	return rebuild, drop
+}
+
+func (b *BadgerEventStore) scanPrefix(prefix []byte, fn func(key []byte, value []byte) error) error {
+	return b.scanPrefixFrom(prefix, prefix, fn)
+}
+
+func (b *BadgerEventStore) scanPrefixFrom(prefix []byte, start []byte, fn func(key []byte, value []byte) error) error {
+	db, err := b.kvStore()
+	if err != nil {
+		return err
+	}
+
+	return db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.Valid(); it.Next() {
+			err := it.Item().Value(func(value []byte) error {
+				return fn(it.Item().Key(), value)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// setEntry stores an index entry, or counts the fact in a count entry
+func setEntry(txn *badger.Txn, entry indexEntry) error {
+	if !entry.count {
+		return txn.Set(entry.key, entry.value)
+	}
+
+	current, err := readEntry(txn, entry.key)
+	if err != nil {
+		return err
+	}
+
+	return txn.Set(entry.key, addCount(current, 1))
+}
+
+// readEntry reads the value of an index entry, nil when it is not stored
+func readEntry(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+func (b *BadgerEventStore) fetchFacts(aggregate string, matches []IndexMatch) ([]EntityFact, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	facts := make([]EntityFact, 0, len(matches))
+	err = db.View(func(txn *badger.Txn) error {
+		for _, match := range matches {
+			item, err := txn.Get(b.factKey(aggregate, match.Entity, match.Id.String()))
+			if err != nil {
+				return err
+			}
+
+			fact, err := decodeFact(item)
+			if err != nil {
+				return err
+			}
+
+			facts = append(facts, EntityFact{Entity: match.Entity, Fact: *fact})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return facts, nil
+}
+
+// syncIndexes rebuilds the derived indexes whose definition changed and drops the removed ones when
+// the store opens
+func (b *BadgerEventStore) syncIndexes(db *badger.DB) error {
+	built := map[string]string{}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(indexDefPrefix)
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			definition, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			built[string(it.Item().KeyCopy(nil))] = string(definition)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rebuild, drop := b.staleIndexes(built)
+	stale := drop
+	for _, index := range rebuild {
+		stale = append(stale, index.prefix())
+	}
+
+	for _, prefix := range stale {
+		if err := db.DropPrefix(prefix); err != nil {
+			return err
+		}
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, prefix := range drop {
+		if err := wb.Delete(append([]byte(indexDefPrefix), prefix...)); err != nil {
+			return err
+		}
+	}
+
+	// the counters were dropped with their index, a write batch cannot read them back
+	counts := map[string]uint64{}
+	for _, index := range rebuild {
+		err := b.eachFact(db, index.aggregate(), func(aggregate string, entity string, fact *Fact) error {
+			document, err := factDocument(*fact)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range index.entries(document, aggregate, entity, *fact) {
+				if entry.count {
+					counts[string(entry.key)]++
+					continue
+				}
+
+				if err := wb.Set(entry.key, entry.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := wb.Set(indexDefKey(index), []byte(index.definition())); err != nil {
+			return err
+		}
+	}
+
+	for key, count := range counts {
+		if err := wb.Set([]byte(key), addCount(nil, count)); err != nil {
+			return err
+		}
+	}
+
+	return wb.Flush()
+}
+
+// eachFact calls fn with every fact in the aggregate, or in every aggregate when it is empty
+func (b *BadgerEventStore) eachFact(db *badger.DB, aggregate string, fn func(aggregate string, entity string, fact *Fact) error) error {
+	return db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		if len(aggregate) > 0 {
+			opts.Prefix = []byte(aggregate + separator)
+		}
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := string(it.Item().Key())
+			parts := strings.Split(key, separator)
+			if len(parts) != 3 || strings.HasPrefix(key, systemPrefix) {
+				// skip the entity stats and the system keys
+				continue
+			}
+
+			fact, err := decodeFact(it.Item())
+			if err != nil {
+				return err
+			}
+
+			if err := fn(parts[0], parts[1], fact); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *BoltEventStore) scanPrefix(prefix []byte, fn func(key []byte, value []byte) error) error {
+	return b.scanPrefixFrom(prefix, prefix, fn)
+}
+
+func (b *BoltEventStore) scanPrefixFrom(prefix []byte, start []byte, fn func(key []byte, value []byte) error) error {
+	db, err := b.boltDb()
+	if err != nil {
+		return err
+	}
+
+	return db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(indexBucket).Cursor()
+		for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *BoltEventStore) fetchFacts(aggregate string, matches []IndexMatch) ([]EntityFact, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	facts := make([]EntityFact, 0, len(matches))
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, match := range matches {
+			var value []byte
+			if bucket := b.entityBucket(tx, aggregate, match.Entity); bucket != nil {
+				value = bucket.Get([]byte(match.Id.String()))
+			}
+			if value == nil {
+				return EntityNotFound{Aggregate: aggregate, Entity: match.Entity}
+			}
+
+			fact, err := decodeFactValue(value)
+			if err != nil {
+				return err
+			}
+
+			facts = append(facts, EntityFact{Entity: match.Entity, Fact: *fact})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return facts, nil
+}
+
+// syncIndexes rebuilds the derived indexes whose definition changed and drops the removed ones when
+// the store opens
+func (b *BoltEventStore) syncIndexes(tx *bolt.Tx) error {
+	indexes := tx.Bucket(indexBucket)
+
+	built := map[string]string{}
+	c := indexes.Cursor()
+	for k, v := c.Seek([]byte(indexDefPrefix)); k != nil && bytes.HasPrefix(k, []byte(indexDefPrefix)); k, v = c.Next() {
+		built[string(k)] = string(v)
+	}
+
+	rebuild, drop := b.staleIndexes(built)
+	for _, prefix := range drop {
+		if err := indexes.Delete(append([]byte(indexDefPrefix), prefix...)); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range rebuild {
+		drop = append(drop, index.prefix())
+	}
+
+	for _, prefix := range drop {
+		if err := deletePrefix(indexes, prefix); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range rebuild {
+		err := eachBoltFact(tx, index.aggregate(), func(aggregate string, entity string, fact *Fact) error {
+			document, err := factDocument(*fact)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range index.entries(document, aggregate, entity, *fact) {
+				if err := putEntry(indexes, entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := indexes.Put(indexDefKey(index), []byte(index.definition())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eachBoltFact calls fn with every fact in the aggregate, or in every aggregate when it is empty
+func eachBoltFact(tx *bolt.Tx, aggregate string, fn func(aggregate string, entity string, fact *Fact) error) error {
+	facts := tx.Bucket(factsBucket)
+	return facts.ForEach(func(name, _ []byte) error {
+		if len(aggregate) > 0 && string(name) != aggregate {
+			return nil
+		}
+
+		agg := facts.Bucket(name)
+		return agg.ForEach(func(entity, _ []byte) error {
+			return agg.Bucket(entity).ForEach(func(_, v []byte) error {
+				fact, err := decodeFactValue(v)
+				if err != nil {
+					return err
+				}
+
+				return fn(string(name), string(entity), fact)
+			})
+		})
+	})
+}
+
+// putEntry stores an index entry, or counts the fact in a count entry
+func putEntry(bucket *bolt.Bucket, entry indexEntry) error {
+	if entry.count {
+		return bucket.Put(entry.key, addCount(bucket.Get(entry.key), 1))
+	}
+
+	return bucket.Put(entry.key, entry.value)
+}
+
+func deletePrefix(bucket *bolt.Bucket, prefix []byte) error {
+	c := bucket.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,340 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/oklog/ulid/v2"
+	bolt "go.etcd.io/bbolt"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLabels is the most labels an entity can have
+	MaxLabels = 64
+	// MaxLabelLength is the longest label name in bytes
+	MaxLabelLength = 128
+	// MaxLabelValueLength is the longest label value in bytes
+	MaxLabelValueLength = 1024
+)
+
+// EntityInfo describes an entity without reading its facts
+type EntityInfo struct {
+	Entity string
+	Total  uint
+	// FirstId and CreatedAt are the id and time of the first fact
+	FirstId   ulid.ULID
+	CreatedAt time.Time
+	// CreatedBy is the subject that appended the first fact, empty when it is not known
+	CreatedBy string
+	// LastId and LastModified are the id and time of the last fact
+	LastId       ulid.ULID
+	LastModified time.Time
+	Labels       map[string]string
+}
+
+// EntityDescription is the metadata of one entity in a batch, or the error reading it
+type EntityDescription struct {
+	Entity string
+	Info   *EntityInfo
+	Err    error
+}
+
+// Describer is implemented by event stores that keep metadata about their entities
+type Describer interface {
+	// Describe reads the metadata of the entities in the order they are given, from one consistent snapshot.
+	// An error describing one entity is returned with that entity, an entity without facts has EntityNotFound.
+	Describe(aggregate string, entities ...string) ([]EntityDescription, error)
+}
+
+// Labeler is implemented by event stores that can label their entities
+type Labeler interface {
+	// SetLabels replaces the labels of the entity, an entity without facts is EntityNotFound
+	SetLabels(aggregate string, entity string, labels map[string]string) (*EntityInfo, error)
+}
+
+// SubjectImporter is implemented by event stores that can record the subject that created the entity of an
+// imported fact, so a fact replicated to another store keeps its creator
+type SubjectImporter interface {
+	// AppendFactBy is AppendFact, recording the subject when the fact is the first in its entity
+	AppendFactBy(aggregate string, entity string, fact Fact, subject string) (*Tail, error)
+}
+
+// ValidateLabels checks that the labels can be stored
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return InvalidLabel{Reason: "an entity can have at most 64 labels"}
+	}
+
+	for name, value := range labels {
+		switch {
+		case len(name) == 0:
+			return InvalidLabel{Label: name, Reason: "label names cannot be empty"}
+		case len(name) > MaxLabelLength:
+			return InvalidLabel{Label: name, Reason: "label names are limited to 128 bytes"}
+		case len(value) > MaxLabelValueLength:
+			return InvalidLabel{Label: name, Reason: "label values are limited to 1024 bytes"}
+		case !utf8.ValidString(name) || !utf8.ValidString(value):
+			return InvalidLabel{Label: name, Reason: "labels must be UTF-8 text"}
+		}
+	}
+
+	return nil
+}
+
+// create records the first fact of the entity and the subject that appended it
+func (s *AggregateStats) create(fact Fact, subject string) {
+	if s.Total > 0 {
+		return
+	}
+
+	s.FirstId = fact.Id
+	s.CreatedAt = fact.Timestamp
+	s.CreatedBy = subject
+}
+
+func (s *AggregateStats) info(entity string) EntityInfo {
+	info := EntityInfo{
+		Entity:       entity,
+		Total:        s.Total,
+		FirstId:      s.FirstId,
+		CreatedAt:    s.CreatedAt,
+		CreatedBy:    s.CreatedBy,
+		LastId:       s.LastId,
+		LastModified: s.LastModified,
+	}
+
+	if len(s.Labels) > 0 {
+		info.Labels = make(map[string]string, len(s.Labels))
+		for name, value := range s.Labels {
+			info.Labels[name] = value
+		}
+	}
+
+	return info
+}
+
+// relabel replaces the labels, an empty set of labels is stored as none
+func (s *AggregateStats) relabel(labels map[string]string) {
+	s.Labels = nil
+	if len(labels) > 0 {
+		s.Labels = make(map[string]string, len(labels))
+		for name, value := range labels {
+			s.Labels[name] = value
+		}
+	}
+}
+
+func (b *BadgerEventStore) AppendFactBy(aggregate string, entity string, fact Fact, subject string) (*Tail, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	var tail *Tail
+	for {
+		tail, err = b.appendFact(db, aggregate, entity, subject, func(ulid.ULID) Fact {
+			return fact
+		})
+		if err != badger.ErrConflict {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tail, nil
+}
+
+func (b *BadgerEventStore) Describe(aggregate string, entities ...string) ([]EntityDescription, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]EntityDescription, 0, len(entities))
+	err = db.View(func(txn *badger.Txn) error {
+		for _, entity := range entities {
+			info, err := b.describeTxn(txn, aggregate, entity)
+			descriptions = append(descriptions, EntityDescription{Entity: entity, Info: info, Err: err})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return descriptions, nil
+}
+
+func (b *BadgerEventStore) describeTxn(txn *badger.Txn, aggregate string, entity string) (*EntityInfo, error) {
+	stats, err := b.readEntityStats(txn, aggregate, entity)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Total == 0 {
+		return nil, EntityNotFound{Aggregate: aggregate, Entity: entity}
+	}
+
+	// entities created before the first fact was kept in the stats
+	if stats.FirstId == (ulid.ULID{}) {
+		first, err := b.readRecords(txn, aggregate, entity, "", 1, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(first) > 0 {
+			stats.FirstId = first[0].Id
+			stats.CreatedAt = first[0].Timestamp
+		}
+	}
+
+	info := stats.info(entity)
+	return &info, nil
+}
+
+func (b *BadgerEventStore) SetLabels(aggregate string, entity string, labels map[string]string) (*EntityInfo, error) {
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	b.writers.RLock()
+	defer b.writers.RUnlock()
+
+	var info EntityInfo
+	for {
+		err = db.Update(func(txn *badger.Txn) error {
+			stats, err := b.readEntityStats(txn, aggregate, entity)
+			if err != nil {
+				return err
+			}
+			if stats.Total == 0 {
+				return EntityNotFound{Aggregate: aggregate, Entity: entity}
+			}
+
+			stats.relabel(labels)
+			info = stats.info(entity)
+			return b.updateEntityStats(txn, aggregate, entity, stats)
+		})
+
+		// a concurrent append changed the stats, so label them again
+		if err != badger.ErrConflict {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (b *BoltEventStore) AppendFactBy(aggregate string, entity string, fact Fact, subject string) (*Tail, error) {
+	return b.update(aggregate, entity, subject, func(ulid.ULID) Fact {
+		return fact
+	})
+}
+
+func (b *BoltEventStore) Describe(aggregate string, entities ...string) ([]EntityDescription, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]EntityDescription, 0, len(entities))
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, entity := range entities {
+			info, err := b.describeTx(tx, aggregate, entity)
+			descriptions = append(descriptions, EntityDescription{Entity: entity, Info: info, Err: err})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return descriptions, nil
+}
+
+func (b *BoltEventStore) describeTx(tx *bolt.Tx, aggregate string, entity string) (*EntityInfo, error) {
+	stats, err := b.readEntityStats(tx, aggregate, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := b.entityBucket(tx, aggregate, entity)
+	if stats.Total == 0 || facts == nil {
+		return nil, EntityNotFound{Aggregate: aggregate, Entity: entity}
+	}
+
+	// entities created before the first fact was kept in the stats
+	if stats.FirstId == (ulid.ULID{}) {
+		if _, value := facts.Cursor().First(); value != nil {
+			first, err := decodeFactValue(value)
+			if err != nil {
+				return nil, err
+			}
+			stats.FirstId = first.Id
+			stats.CreatedAt = first.Timestamp
+		}
+	}
+
+	info := stats.info(entity)
+	return &info, nil
+}
+
+func (b *BoltEventStore) SetLabels(aggregate string, entity string, labels map[string]string) (*EntityInfo, error) {
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	var info EntityInfo
+	err = db.Update(func(tx *bolt.Tx) error {
+		stats, err := b.readEntityStats(tx, aggregate, entity)
+		if err != nil {
+			return err
+		}
+		if stats.Total == 0 {
+			return EntityNotFound{Aggregate: aggregate, Entity: entity}
+		}
+
+		stats.relabel(labels)
+		info = stats.info(entity)
+		return b.updateEntityStats(tx, aggregate, entity, stats)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/oklog/ulid/v2"
+	bolt "go.etcd.io/bbolt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	stores := map[string]struct {
+		open func(dir string, clock Clock) EventStore
+		// forget removes the first fact from the stats, the way a store written before it was kept looks
+		forget func(store EventStore) error
+	}{
+		"badger": {
+			open: func(dir string, clock Clock) EventStore { return FileStore(dir, WithClock(clock)) },
+			forget: func(store EventStore) error {
+				b := store.(*BadgerEventStore)
+				db, err := b.kvStore()
+				if err != nil {
+					return err
+				}
+				return db.Update(func(txn *badger.Txn) error {
+					stats, err := b.readEntityStats(txn, "orders", "1")
+					if err != nil {
+						return err
+					}
+					stats.FirstId, stats.CreatedAt, stats.CreatedBy = ulid.ULID{}, time.Time{}, ""
+					return b.updateEntityStats(txn, "orders", "1", stats)
+				})
+			},
+		},
+		"bolt": {
+			open: func(dir string, clock Clock) EventStore { return BoltFileStore(dir, WithClock(clock)) },
+			forget: func(store EventStore) error {
+				b := store.(*BoltEventStore)
+				db, err := b.boltDb()
+				if err != nil {
+					return err
+				}
+				return db.Update(func(tx *bolt.Tx) error {
+					stats, err := b.readEntityStats(tx, "orders", "1")
+					if err != nil {
+						return err
+					}
+					stats.FirstId, stats.CreatedAt, stats.CreatedBy = ulid.ULID{}, time.Time{}, ""
+					return b.updateEntityStats(tx, "orders", "1", stats)
+				})
+			},
+		},
+	}
+
+	for name, driver := range stores {
+		t.Run(name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			store := driver.open(t.TempDir(), clock)
+			store.Register(Test{})
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			appender := store.(MetadataAppender)
+			first, err := appender.AppendWith("orders", "1", Test{Value: 1}, Metadata{Subject: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			clock.Set(start.Add(time.Hour))
+			last, err := appender.AppendWith("orders", "1", Test{Value: 2}, Metadata{Subject: "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Append("orders", "2", Test{Value: 3}); err != nil {
+				t.Fatal(err)
+			}
+
+			describer := store.(Describer)
+			describe := func(entities ...string) []EntityInfo {
+				descriptions, err := describer.Describe("orders", entities...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				infos := make([]EntityInfo, 0, len(descriptions))
+				for _, description := range descriptions {
+					if description.Err != nil {
+						t.Fatalf("%s: %v", description.Entity, description.Err)
+					}
+					infos = append(infos, *description.Info)
+				}
+				return infos
+			}
+
+			infos := describe("2", "1")
+			if len(infos) != 2 || infos[0].Entity != "2" || infos[0].CreatedBy != "" {
+				t.Fatalf("expected entity 2 without a creator first, received %+v", infos)
+			}
+
+			info := infos[1]
+			if info.Entity != "1" || info.Total != 2 || info.CreatedBy != "alice" {
+				t.Errorf("expected 2 facts created by alice, received %+v", info)
+			}
+			if info.FirstId != first.Fact.Id || !info.CreatedAt.Equal(start) {
+				t.Errorf("expected created by %s at %s, received %s at %s", first.Fact.Id, start, info.FirstId, info.CreatedAt)
+			}
+			if info.LastId != last.Fact.Id || !info.LastModified.Equal(start.Add(time.Hour)) {
+				t.Errorf("expected modified by %s, received %s at %s", last.Fact.Id, info.LastId, info.LastModified)
+			}
+
+			descriptions, err := describer.Describe("orders", "1", "missing")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(descriptions) != 2 || descriptions[0].Info == nil || descriptions[0].Info.Total != 2 {
+				t.Errorf("expected entity 1 to be described, received %+v", descriptions)
+			}
+			if len(descriptions) != 2 || !errors.As(descriptions[1].Err, &EntityNotFound{}) {
+				t.Errorf("expected EntityNotFound for the missing entity, received %+v", descriptions)
+			}
+
+			labeler := store.(Labeler)
+			labelled, err := labeler.SetLabels("orders", "1", map[string]string{"tier": "gold", "region": "eu"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(labelled.Labels) != 2 || labelled.Labels["tier"] != "gold" || labelled.Total != 2 {
+				t.Errorf("expected the labels with the entity, received %+v", labelled)
+			}
+
+			// appending keeps the labels, setting them replaces all of them
+			if _, err := store.Append("orders", "1", Test{Value: 4}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := labeler.SetLabels("orders", "1", map[string]string{"tier": "silver"}); err != nil {
+				t.Fatal(err)
+			}
+			infos = describe("1")
+			if len(infos[0].Labels) != 1 || infos[0].Labels["tier"] != "silver" || infos[0].Total != 3 {
+				t.Errorf("expected only the silver label, received %+v", infos[0])
+			}
+
+			if _, err := labeler.SetLabels("orders", "missing", map[string]string{"tier": "gold"}); !errors.As(err, &EntityNotFound{}) {
+				t.Errorf("expected EntityNotFound, received %v", err)
+			}
+			for _, labels := range []map[string]string{
+				{"": "empty"},
+				{strings.Repeat("k", MaxLabelLength+1): "long"},
+				{"long": strings.Repeat("v", MaxLabelValueLength+1)},
+			} {
+				if _, err := labeler.SetLabels("orders", "1", labels); !errors.As(err, &InvalidLabel{}) {
+					t.Errorf("expected InvalidLabel, received %v", err)
+				}
+			}
+
+			if _, err := labeler.SetLabels("orders", "1", nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := driver.forget(store); err != nil {
+				t.Fatal(err)
+			}
+			infos = describe("1")
+			if infos[0].Labels != nil || infos[0].FirstId != first.Fact.Id || !infos[0].CreatedAt.Equal(start) {
+				t.Errorf("expected the first fact read from the entity without labels, received %+v", infos[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// encodeFact returns the value to store along with the size of the fact before compression
+func (o *storeOptions) encodeFact(fact Fact) ([]byte, int, error) {
+	var c bytes.Buffer
+	enc := gob.NewEncoder(&c)
+
+	err := enc.Encode(fact)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	value, err := compress(o.Compression, o.CompressionThreshold, c.Bytes())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return value, c.Len(), nil
+}
+
+func decodeFactValue(val []byte) (*Fact, error) {
+	record := Fact{}
+
+	val, err := decompress(val)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := gob.NewDecoder(bytes.NewBuffer(val))
+	if err := dec.Decode(&record); err != nil {
+		return nil, err
+	}
+
+	// facts stored before they had an occurred time happened when they were recorded
+	if record.OccurredAt.IsZero() {
+		record.OccurredAt = record.Timestamp
+	}
+
+	return &record, nil
+}
+
+func encodeStats(stats *AggregateStats) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+
+	err := enc.Encode(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeStats(val []byte, stats *AggregateStats) error {
+	dec := gob.NewDecoder(bytes.NewBuffer(val))
+	return dec.Decode(stats)
+}
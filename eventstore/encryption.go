@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ValidateEncryptionKey checks the key is an AES-128, AES-192 or AES-256 key
+func ValidateEncryptionKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+
+	return InvalidEncryptionKey{Length: len(key)}
+}
+
+// ParseEncryptionKey reads a key stored as hex, base64, raw bytes or text.  Hex and base64 are tried first, so
+// a 32 character hex key is a 16 byte key and not 32 bytes of text.  Surrounding whitespace, such as the new line
+// an editor adds to the end of a file, is ignored unless the raw content is already a valid key.
+func ParseEncryptionKey(data []byte) ([]byte, error) {
+	text := bytes.TrimSpace(data)
+
+	if key, err := hex.DecodeString(string(text)); err == nil && ValidateEncryptionKey(key) == nil {
+		return key, nil
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(string(text)); err == nil && ValidateEncryptionKey(key) == nil {
+		return key, nil
+	}
+
+	if ValidateEncryptionKey(data) == nil {
+		return data, nil
+	}
+
+	if ValidateEncryptionKey(text) == nil {
+		return text, nil
+	}
+
+	return nil, InvalidEncryptionKey{Length: len(text)}
+}
+
+// RotateEncryptionKey re-encrypts the key registry of the closed badger store in dir with newKey
+func RotateEncryptionKey(dir string, oldKey []byte, newKey []byte) error {
+	if len(oldKey) == 0 {
+		return fmt.Errorf("the store is not encrypted, there is no key to rotate")
+	}
+
+	if err := ValidateEncryptionKey(newKey); err != nil {
+		return err
+	}
+
+	opt := badger.KeyRegistryOptions{
+		Dir:           dir,
+		ReadOnly:      true,
+		EncryptionKey: oldKey,
+	}
+
+	registry, err := badger.OpenKeyRegistry(opt)
+	if err != nil {
+		return err
+	}
+
+	opt.EncryptionKey = newKey
+	return badger.WriteKeyRegistry(registry, opt)
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestParseEncryptionKey(t *testing.T) {
+	text := []byte("correct horse battery staple!!!!")
+	raw := bytes.Repeat([]byte{0x0a}, 16)
+	hexKey := []byte("00112233445566778899aabbccddeeff")
+	base64Key := []byte("ABEiM0RVZneImaq7zN3u/wARIjNEVWZ3")
+
+	cases := map[string]struct {
+		data     []byte
+		expected []byte
+	}{
+		"text":              {text, text},
+		"text with newline": {append(append([]byte{}, text...), '\n'), text},
+		"raw bytes":         {raw, raw},
+		"hex":               {[]byte(hex.EncodeToString(raw) + "\n"), raw},
+		"base64":            {[]byte(base64.StdEncoding.EncodeToString(raw)), raw},
+		// both are also valid 32 byte text keys, the encodings win
+		"32 character hex":    {hexKey, mustDecodeHex(t, hexKey)},
+		"32 character base64": {base64Key, mustDecodeBase64(t, base64Key)},
+	}
+
+	for name, c := range cases {
+		parsed, err := ParseEncryptionKey(c.data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if !bytes.Equal(parsed, c.expected) {
+			t.Errorf("%s: expected a %d byte key, parsed %d bytes", name, len(c.expected), len(parsed))
+		}
+	}
+
+	// A 128 byte key used to be required, and silently left the store unencrypted
+	for _, length := range []int{0, 8, 31, 128} {
+		if _, err := ParseEncryptionKey(bytes.Repeat([]byte{'k'}, length)); !errors.As(err, &InvalidEncryptionKey{}) {
+			t.Errorf("expected a %d byte key to be rejected, received %v", length, err)
+		}
+	}
+}
+
+func TestOpenRejectsInvalidEncryptionKey(t *testing.T) {
+	_, err := Open(DefaultDriver, Settings{Path: t.TempDir(), EncryptionKey: bytes.Repeat([]byte{'k'}, 128)})
+	if !errors.As(err, &InvalidEncryptionKey{}) {
+		t.Errorf("expected InvalidEncryptionKey, received %v", err)
+	}
+}
+
+func TestOpenRejectsKeyForUnencryptedStore(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{'k'}, 32)
+
+	plain, err := Open(DefaultDriver, Settings{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := plain.Append("plain", "1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := plain.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(DefaultDriver, Settings{Path: dir, EncryptionKey: key}); !errors.As(err, &EncryptionKeyMismatch{}) {
+		t.Errorf("expected EncryptionKeyMismatch, received %v", err)
+	}
+
+	// the store is left as it was
+	reopened, err := Open(DefaultDriver, Settings{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := reopened.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if tail, err := reopened.Tail("plain", "1"); err != nil || tail.Total != 1 {
+		t.Errorf("expected the unencrypted store to still open without a key, received %v, %v", tail, err)
+	}
+}
+
+func mustDecodeHex(t *testing.T, data []byte) []byte {
+	key, err := hex.DecodeString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func mustDecodeBase64(t *testing.T, data []byte) []byte {
+	key, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
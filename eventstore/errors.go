@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"fmt"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// EntityNotFound is returned when an entity has no facts yet
+type EntityNotFound struct {
+	Aggregate string
+	Entity    string
+}
+
+func (e EntityNotFound) Error() string {
+	return fmt.Sprintf("entity not found: %s%s%s", e.Aggregate, separator, e.Entity)
+}
+
+// OutOfOrder is returned when a fact would not become the new tail of its entity
+type OutOfOrder struct {
+	Aggregate string
+	Entity    string
+	Id        ulid.ULID
+	LastId    ulid.ULID
+}
+
+func (e OutOfOrder) Error() string {
+	return fmt.Sprintf("fact %s is older than the tail %s of %s%s%s", e.Id, e.LastId, e.Aggregate, separator, e.Entity)
+}
+
+// HashMismatch is returned when a fact carries a hash that does not continue its entity's hash chain
+type HashMismatch struct {
+	Aggregate string
+	Entity    string
+	Id        ulid.ULID
+}
+
+func (e HashMismatch) Error() string {
+	return fmt.Sprintf("fact %s does not match the hash chain of %s%s%s", e.Id, e.Aggregate, separator, e.Entity)
+}
+
+// NotCheckpointed is returned when no checkpoint covers a fact yet
+type NotCheckpointed struct {
+	Id string
+}
+
+func (e NotCheckpointed) Error() string {
+	return fmt.Sprintf("fact %s is not covered by a checkpoint yet", e.Id)
+}
+
+// InvalidEncryptionKey is returned for keys that are not 16, 24 or 32 bytes long
+type InvalidEncryptionKey struct {
+	Length int
+}
+
+func (e InvalidEncryptionKey) Error() string {
+	return fmt.Sprintf("encryption key is %d bytes, it must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256", e.Length)
+}
+
+// EncryptionKeyMismatch is returned when a store is opened with a different encryption key than it was created
+// with, including a key for a store created without one
+type EncryptionKeyMismatch struct {
+	Path string
+}
+
+func (e EncryptionKeyMismatch) Error() string {
+	return fmt.Sprintf("the encryption key does not match the store in %s, a store is encrypted when it is created and cannot be encrypted in place", e.Path)
+}
+
+// InvalidIndex is returned for a secondary index definition that cannot be used
+type InvalidIndex struct {
+	Aggregate string
+	Name      string
+	Reason    string
+}
+
+func (e InvalidIndex) Error() string {
+	return fmt.Sprintf("index %s of %s is invalid: %s", e.Name, e.Aggregate, e.Reason)
+}
+
+// IndexNotFound is returned when an aggregate has no secondary index with the name
+type IndexNotFound struct {
+	Aggregate string
+	Name      string
+}
+
+func (e IndexNotFound) Error() string {
+	return fmt.Sprintf("aggregate %s has no index named %s", e.Aggregate, e.Name)
+}
+
+// NotSearchable is returned when an aggregate has no full text search index
+type NotSearchable struct {
+	Aggregate string
+}
+
+func (e NotSearchable) Error() string {
+	return fmt.Sprintf("aggregate %s is not searchable", e.Aggregate)
+}
+
+// InvalidTag is returned for a tag that cannot be stored
+type InvalidTag struct {
+	Tag    string
+	Reason string
+}
+
+func (e InvalidTag) Error() string {
+	return fmt.Sprintf("invalid tag %q: %s", e.Tag, e.Reason)
+}
+
+// InvalidCorrelationId is returned for a correlation id that cannot be stored
+type InvalidCorrelationId struct {
+	CorrelationId string
+	Reason        string
+}
+
+func (e InvalidCorrelationId) Error() string {
+	return fmt.Sprintf("invalid correlation id %q: %s", e.CorrelationId, e.Reason)
+}
+
+// InvalidFilter is returned for a read filter predicate that cannot be evaluated
+type InvalidFilter struct {
+	Path   string
+	Reason string
+}
+
+func (e InvalidFilter) Error() string {
+	return fmt.Sprintf("invalid filter on %q: %s", e.Path, e.Reason)
+}
+
+// FactNotFound is returned when there is no fact with the id
+type FactNotFound struct {
+	Id string
+}
+
+func (e FactNotFound) Error() string {
+	return fmt.Sprintf("fact not found: %s", e.Id)
+}
+
+// InvalidLabel is returned for entity labels that cannot be stored
+type InvalidLabel struct {
+	Label  string
+	Reason string
+}
+
+func (e InvalidLabel) Error() string {
+	if len(e.Label) == 0 {
+		return fmt.Sprintf("invalid labels: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid label %q: %s", e.Label, e.Reason)
+}
+
+// EntityExists is returned when a new entity would reuse the id of an entity that already has facts
+type EntityExists struct {
+	Aggregate string
+	Entity    string
+}
+
+func (e EntityExists) Error() string {
+	return fmt.Sprintf("entity already exists: %s%s%s", e.Aggregate, separator, e.Entity)
+}
+
+// FactExists is returned when a fact's id is already used by a fact of another entity
+type FactExists struct {
+	Id        ulid.ULID
+	Aggregate string
+	Entity    string
+}
+
+func (e FactExists) Error() string {
+	return fmt.Sprintf("fact %s is already stored in %s%s%s", e.Id, e.Aggregate, separator, e.Entity)
+}
+
+// InvalidEntityIdFormat is returned for an entity id format that cannot be parsed
+type InvalidEntityIdFormat struct {
+	Format string
+	Reason string
+}
+
+func (e InvalidEntityIdFormat) Error() string {
+	return fmt.Sprintf("invalid entity id format '%s': %s", e.Format, e.Reason)
+}
@@ -0,0 +1,539 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package eventstoretest provides a conformance suite that any eventstore.EventStore can run against itself
+// to verify it behaves like the BadgerEventStore.
+package eventstoretest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Payload is the content appended by the suite.  It is registered with every store under test.
+type Payload struct {
+	Value int
+}
+
+// Factory opens an event store that keeps its data in dir.  Opening the same dir a second time must
+// return a store with the same facts.
+type Factory func(dir string) (eventstore.EventStore, error)
+
+// Run executes the whole conformance suite against the stores created by open.
+func Run(t *testing.T, open Factory) {
+	t.Run("Ordering", func(t *testing.T) { Ordering(t, open) })
+	t.Run("Paging", func(t *testing.T) { Paging(t, open) })
+	t.Run("EmptyEntity", func(t *testing.T) { EmptyEntity(t, open) })
+	t.Run("ConcurrentAppends", func(t *testing.T) { ConcurrentAppends(t, open) })
+	t.Run("ScanIsolation", func(t *testing.T) { ScanIsolation(t, open) })
+	t.Run("Durability", func(t *testing.T) { Durability(t, open) })
+	t.Run("Import", func(t *testing.T) { Import(t, open) })
+	t.Run("HashChain", func(t *testing.T) { HashChain(t, open) })
+	t.Run("Get", func(t *testing.T) { Get(t, open) })
+}
+
+// Ordering verifies facts are read back in the order they were appended with increasing ids.
+func Ordering(t *testing.T, open Factory) {
+	store := openStore(t, open, t.TempDir())
+	aggregate, entity := "ordering", "1"
+	count := 20
+
+	var appended []eventstore.Fact
+	for i := 0; i < count; i++ {
+		tail, err := store.Append(aggregate, entity, Payload{Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tail.Total != uint(i+1) {
+			t.Errorf("expected total %d after append, received %d", i+1, tail.Total)
+		}
+
+		appended = append(appended, tail.Fact)
+	}
+
+	results, err := store.Read(aggregate, entity, "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results.Total != uint(count) {
+		t.Errorf("expected total %d, received %d", count, results.Total)
+	}
+
+	if len(results.List) != count {
+		t.Fatalf("expected %d facts, received %d", count, len(results.List))
+	}
+
+	for i, fact := range results.List {
+		if fact.Id != appended[i].Id {
+			t.Errorf("fact %d: expected id %s, received %s", i, appended[i].Id, fact.Id)
+		}
+
+		if !reflect.DeepEqual(fact.Content, Payload{Value: i}) {
+			t.Errorf("fact %d: expected content %v, received %v", i, Payload{Value: i}, fact.Content)
+		}
+
+		if i > 0 && fact.Id.Compare(results.List[i-1].Id) <= 0 {
+			t.Errorf("fact %d: id %s does not follow %s", i, fact.Id, results.List[i-1].Id)
+		}
+	}
+
+	tail, err := store.Tail(aggregate, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tail.Fact.Id != appended[count-1].Id {
+		t.Errorf("expected tail %s, received %s", appended[count-1].Id, tail.Fact.Id)
+	}
+}
+
+// Paging verifies pages are filled up to the page size and the origin fact is never repeated.
+func Paging(t *testing.T, open Factory) {
+	store := openStore(t, open, t.TempDir())
+	aggregate, entity := "paging", "1"
+	count, pageSize := 25, 10
+
+	for i := 0; i < count; i++ {
+		if _, err := store.Append(aggregate, entity, Payload{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	origin := ""
+	var read []eventstore.Fact
+	for _, expected := range []int{10, 10, 5, 0} {
+		page, err := store.Read(aggregate, entity, origin, pageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if page.PageSize != pageSize {
+			t.Errorf("expected page size %d, received %d", pageSize, page.PageSize)
+		}
+
+		if page.Total != uint(count) {
+			t.Errorf("expected total %d, received %d", count, page.Total)
+		}
+
+		if len(page.List) != expected {
+			t.Fatalf("reading from '%s': expected %d facts, received %d", origin, expected, len(page.List))
+		}
+
+		if expected > 0 {
+			read = append(read, page.List...)
+			origin = page.List[len(page.List)-1].Id.String()
+		}
+	}
+
+	for i, fact := range read {
+		if !reflect.DeepEqual(fact.Content, Payload{Value: i}) {
+			t.Errorf("fact %d: expected content %v, received %v", i, Payload{Value: i}, fact.Content)
+		}
+	}
+
+	for _, size := range []int{0, -1} {
+		page, err := store.Read(aggregate, entity, "", size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if page.PageSize < 1 {
+			t.Errorf("page size %d: expected a default page size, received %d", size, page.PageSize)
+		}
+
+		if len(page.List) != count {
+			t.Errorf("page size %d: expected %d facts, received %d", size, count, len(page.List))
+		}
+	}
+}
+
+// EmptyEntity verifies an entity without facts reads as empty and has no tail.
+func EmptyEntity(t *testing.T, open Factory) {
+	store := openStore(t, open, t.TempDir())
+
+	if _, err := store.Append("empty", "other", Payload{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := store.Tail("empty", "missing")
+	var notFound eventstore.EntityNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected eventstore.EntityNotFound, received %v", err)
+	}
+
+	results, err := store.Read("empty", "missing", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results.Total != 0 || len(results.List) != 0 {
+		t.Errorf("expected no facts, received %d with total %d", len(results.List), results.Total)
+	}
+
+	keys, err := store.Scan("nothing-here")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.Total != 0 || len(keys.List) != 0 {
+		t.Errorf("expected no entities, received %v", keys.List)
+	}
+}
+
+// ConcurrentAppends verifies no facts are lost and ids stay in order when appending from many goroutines.
+func ConcurrentAppends(t *testing.T, open Factory) {
+	store := openStore(t, open, t.TempDir())
+	aggregate, entity := "concurrent", "1"
+	workers, perWorker := 8, 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*workers*perWorker)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := store.Append(aggregate, entity, Payload{Value: w*perWorker + i}); err != nil {
+					errs <- err
+				}
+				if _, err := store.Append(aggregate, fmt.Sprintf("worker-%d", w), Payload{Value: i}); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	results, err := store.Read(aggregate, entity, "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := workers * perWorker
+	if results.Total != uint(expected) || len(results.List) != expected {
+		t.Fatalf("expected %d facts, received %d with total %d", expected, len(results.List), results.Total)
+	}
+
+	seen := map[int]bool{}
+	for i, fact := range results.List {
+		if i > 0 && fact.Id.Compare(results.List[i-1].Id) <= 0 {
+			t.Errorf("fact %d: id %s does not follow %s", i, fact.Id, results.List[i-1].Id)
+		}
+
+		seen[fact.Content.(Payload).Value] = true
+	}
+
+	if len(seen) != expected {
+		t.Errorf("expected %d distinct facts, received %d", expected, len(seen))
+	}
+
+	tail, err := store.Tail(aggregate, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tail.Fact.Id != results.List[expected-1].Id {
+		t.Errorf("expected tail %s, received %s", results.List[expected-1].Id, tail.Fact.Id)
+	}
+
+	keys, err := store.Scan(aggregate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.Total != uint(workers+1) {
+		t.Errorf("expected %d entities, received %v", workers+1, keys.List)
+	}
+}
+
+// ScanIsolation verifies aggregates and entities sharing a name prefix do not bleed into each other.
+func ScanIsolation(t *testing.T, open Factory) {
+	store := openStore(t, open, t.TempDir())
+
+	appends := []struct{ aggregate, entity string }{
+		{"test", "1"},
+		{"test", "10"},
+		{"test", "2"},
+		{"test2", "3"},
+		{"tes", "4"},
+	}
+
+	for i, a := range appends {
+		if _, err := store.Append(a.aggregate, a.entity, Payload{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := store.Scan("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"1", "10", "2"}
+	if !reflect.DeepEqual(keys.List, expected) || keys.Total != uint(len(expected)) {
+		t.Errorf("expected entities %v, received %v with total %d", expected, keys.List, keys.Total)
+	}
+
+	results, err := store.Read("test", "1", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.List) != 1 || !reflect.DeepEqual(results.List[0].Content, Payload{Value: 0}) {
+		t.Errorf("entity '1' should only contain its own fact, received %v", results.List)
+	}
+}
+
+// Durability verifies facts survive closing and reopening the store.
+func Durability(t *testing.T, open Factory) {
+	dir := t.TempDir()
+	aggregate, entity := "durable", "1"
+
+	store, err := open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Register(Payload{})
+
+	var last eventstore.Fact
+	for i := 0; i < 5; i++ {
+		tail, err := store.Append(aggregate, entity, Payload{Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = tail.Fact
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openStore(t, open, dir)
+
+	tail, err := reopened.Tail(aggregate, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tail.Fact.Id != last.Id || tail.Total != 5 {
+		t.Errorf("expected tail %s of 5 facts, received %s of %d", last.Id, tail.Fact.Id, tail.Total)
+	}
+
+	results, err := reopened.Read(aggregate, entity, "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.List) != 5 {
+		t.Errorf("expected 5 facts after reopening, received %d", len(results.List))
+	}
+
+	if _, err := reopened.Append(aggregate, entity, Payload{Value: 5}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openStore(t *testing.T, open Factory, dir string) eventstore.EventStore {
+	store, err := open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Register(Payload{})
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return store
+}
+
+// Import verifies facts created elsewhere keep their id, are stored once and are never stored behind the tail.
+// Stores that do not implement eventstore.Importer skip the test.
+func Import(t *testing.T, open Factory) {
+	store := openStore(t, open, t.TempDir())
+	importer, ok := store.(eventstore.Importer)
+	if !ok {
+		t.Skip("store does not implement eventstore.Importer")
+	}
+
+	aggregate, entity := "import", "1"
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var facts []eventstore.Fact
+	for i := 0; i < 3; i++ {
+		timestamp := start.Add(time.Duration(i) * time.Second)
+		facts = append(facts, eventstore.Fact{
+			Id:        ulid.MustNew(ulid.Timestamp(timestamp), ulid.DefaultEntropy()),
+			Timestamp: timestamp,
+			Content:   Payload{Value: i},
+		})
+	}
+
+	for _, fact := range []eventstore.Fact{facts[0], facts[2]} {
+		if _, err := importer.AppendFact(aggregate, entity, fact); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tail, err := importer.AppendFact(aggregate, entity, facts[0])
+	if err != nil {
+		t.Fatalf("storing a fact twice should be a no-op: %v", err)
+	}
+
+	if tail.Total != 2 {
+		t.Errorf("expected total 2, received %d", tail.Total)
+	}
+
+	_, err = importer.AppendFact(aggregate, entity, facts[1])
+	if !errors.As(err, &eventstore.OutOfOrder{}) {
+		t.Errorf("expected OutOfOrder storing a fact behind the tail, received %v", err)
+	}
+
+	results, err := store.Read(aggregate, entity, "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.List) != 2 {
+		t.Fatalf("expected 2 facts, received %d", len(results.List))
+	}
+
+	for i, expected := range []eventstore.Fact{facts[0], facts[2]} {
+		if results.List[i].Id != expected.Id || !results.List[i].Timestamp.Equal(expected.Timestamp) {
+			t.Errorf("fact %d: expected %s at %s, received %s at %s", i, expected.Id, expected.Timestamp,
+				results.List[i].Id, results.List[i].Timestamp)
+		}
+	}
+}
+
+// HashChain verifies every appended fact is hashed and the chain verifies.  Stores that do not implement
+// eventstore.Verifier skip the test.
+func HashChain(t *testing.T, open Factory) {
+	store := openStore(t, open, t.TempDir())
+	verifier, ok := store.(eventstore.Verifier)
+	if !ok {
+		t.Skip("store does not implement eventstore.Verifier")
+	}
+
+	aggregate, entity := "chain", "1"
+	count := 10
+
+	for i := 0; i < count; i++ {
+		tail, err := store.Append(aggregate, entity, Payload{Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tail.Fact.Hash) == 0 {
+			t.Errorf("fact %d was not hashed", i)
+		}
+	}
+
+	result, err := verifier.Verify(aggregate, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Valid || result.Verified != uint(count) {
+		t.Errorf("expected %d verified facts, received %+v", count, result)
+	}
+}
+
+// Get verifies every appended fact can be read back by its id, and located by its id alone when the store
+// implements eventstore.FactLocator.
+func Get(t *testing.T, open Factory) {
+	dir := t.TempDir()
+	store, err := open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Register(Payload{})
+
+	var appended []eventstore.Fact
+	for i := 0; i < 4; i++ {
+		tail, err := store.Append("get", fmt.Sprint(i%2), Payload{Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appended = append(appended, tail.Fact)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openStore(t, open, dir)
+	for i, expected := range appended {
+		fact, err := reopened.Get("get", fmt.Sprint(i%2), expected.Id.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fact.Id != expected.Id || !reflect.DeepEqual(fact.Content, expected.Content) {
+			t.Errorf("expected fact %s with %v, received %s with %v", expected.Id, expected.Content, fact.Id, fact.Content)
+		}
+	}
+
+	var notFound eventstore.FactNotFound
+	if _, err := reopened.Get("get", "1", appended[0].Id.String()); !errors.As(err, &notFound) {
+		t.Errorf("expected eventstore.FactNotFound reading a fact from another entity, received %v", err)
+	}
+	if _, err := reopened.Get("get", "missing", appended[0].Id.String()); !errors.As(err, &notFound) {
+		t.Errorf("expected eventstore.FactNotFound reading a missing entity, received %v", err)
+	}
+
+	locator, ok := reopened.(eventstore.FactLocator)
+	if !ok {
+		return
+	}
+
+	for i, expected := range appended {
+		location, err := locator.Locate(expected.Id.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if location.Aggregate != "get" || location.Entity != fmt.Sprint(i%2) || location.Id != expected.Id {
+			t.Errorf("expected fact %s in get|%d, located %s in %s|%s", expected.Id, i%2, location.Id,
+				location.Aggregate, location.Entity)
+		}
+	}
+
+	missing := ulid.MustNew(ulid.Now(), ulid.DefaultEntropy()).String()
+	for _, id := range []string{missing, "not-a-ulid"} {
+		if _, err := locator.Locate(id); !errors.As(err, &notFound) {
+			t.Errorf("expected eventstore.FactNotFound locating %s, received %v", id, err)
+		}
+	}
+}
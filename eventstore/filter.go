@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Operator compares the value in a fact to the value of a predicate
+type Operator string
+
+const (
+	Equal          Operator = "="
+	NotEqual       Operator = "!="
+	Less           Operator = "<"
+	LessOrEqual    Operator = "<="
+	Greater        Operator = ">"
+	GreaterOrEqual Operator = ">="
+)
+
+// ReadFilter narrows the facts a read returns.  A fact matches when its type is one of the Types, or there
+// are none, and every predicate holds.
+type ReadFilter struct {
+	// Types are the fact types to return, see FactType
+	Types []string
+	// Predicates all have to hold for a fact to be returned
+	Predicates []Predicate
+}
+
+// Predicate compares the value at a JSON path in the fact's content, so "$.total" is the content's total.
+// When the path ends at an array the predicate holds if it holds for any of the elements, except for
+// NotEqual which holds when none of them are equal.  Numbers compare as numbers and strings compare
+// as text, so RFC 3339 times in the same zone compare in time order.
+type Predicate struct {
+	Path     string
+	Operator Operator
+	Value    interface{}
+}
+
+// FilteredReader is implemented by event stores that can filter the facts they read
+type FilteredReader interface {
+	// ReadFiltered reads the facts of the entity that match the filter, starting after the origin fact id.
+	// The page is filled with matching facts only, so the id of its last fact is the origin of the next
+	// page.  The Total of the list is still the number of facts in the entity.
+	ReadFiltered(aggregate string, entity string, originEventId string, maxCount int, filter ReadFilter) (*RecordList, error)
+}
+
+// FactType is the name of the content's Go type when the content is a registered struct, otherwise it is
+// the "type" field of JSON content
+func FactType(fact Fact) string {
+	content := reflect.ValueOf(fact.Content)
+	for content.Kind() == reflect.Ptr && !content.IsNil() {
+		content = content.Elem()
+	}
+	if content.Kind() == reflect.Struct {
+		return content.Type().Name()
+	}
+
+	var fields map[string]interface{}
+	switch c := fact.Content.(type) {
+	case map[string]interface{}:
+		fields = c
+	case json.RawMessage:
+		if err := json.Unmarshal(c, &fields); err != nil {
+			return ""
+		}
+	}
+
+	name, _ := fields["type"].(string)
+	return name
+}
+
+// factFilter is a ReadFilter with its paths parsed.  A nil factFilter matches every fact.
+type factFilter struct {
+	types      map[string]bool
+	predicates []predicate
+}
+
+type predicate struct {
+	steps    []pathStep
+	operator Operator
+	value    interface{}
+}
+
+// compile checks the filter, returning nil when it does not filter anything
+func (f ReadFilter) compile() (*factFilter, error) {
+	if len(f.Types) == 0 && len(f.Predicates) == 0 {
+		return nil, nil
+	}
+
+	filter := factFilter{}
+	if len(f.Types) > 0 {
+		filter.types = map[string]bool{}
+		for _, name := range f.Types {
+			filter.types[name] = true
+		}
+	}
+
+	for _, p := range f.Predicates {
+		steps, reason := parsePath(p.Path)
+		if len(reason) > 0 {
+			return nil, InvalidFilter{Path: p.Path, Reason: reason}
+		}
+
+		value, ok := orderable(p.Value)
+		if !ok {
+			return nil, InvalidFilter{Path: p.Path, Reason: "the value must be a string, number, boolean or null"}
+		}
+
+		switch p.Operator {
+		case Equal, NotEqual:
+		case Less, LessOrEqual, Greater, GreaterOrEqual:
+			switch value.(type) {
+			case string, float64:
+			default:
+				return nil, InvalidFilter{Path: p.Path, Reason: "a range needs a string or number value"}
+			}
+		default:
+			return nil, InvalidFilter{Path: p.Path, Reason: "unknown operator " + string(p.Operator)}
+		}
+
+		// the paths start at the content of the fact
+		steps = append([]pathStep{{field: "Content"}}, steps...)
+		filter.predicates = append(filter.predicates, predicate{steps: steps, operator: p.Operator, value: value})
+	}
+
+	return &filter, nil
+}
+
+func (f *factFilter) matches(fact Fact) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+
+	if f.types != nil && !f.types[FactType(fact)] {
+		return false, nil
+	}
+
+	if len(f.predicates) == 0 {
+		return true, nil
+	}
+
+	document, err := factDocument(fact)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range f.predicates {
+		if !p.holds(selectPath(p.steps, document)) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (p *predicate) holds(selected interface{}) bool {
+	values := []interface{}{selected}
+	if list, ok := selected.([]interface{}); ok {
+		values = list
+	}
+
+	if p.operator == NotEqual {
+		for _, value := range values {
+			if value, ok := orderable(value); ok && value == p.value {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, value := range values {
+		if value, ok := orderable(value); ok && p.compare(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *predicate) compare(value interface{}) bool {
+	if p.operator == Equal {
+		return value == p.value
+	}
+
+	var order int
+	switch want := p.value.(type) {
+	case float64:
+		got, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		order = compareFloat(got, want)
+	case string:
+		got, ok := value.(string)
+		if !ok {
+			return false
+		}
+		order = strings.Compare(got, want)
+	}
+
+	switch p.operator {
+	case Less:
+		return order < 0
+	case LessOrEqual:
+		return order <= 0
+	case Greater:
+		return order > 0
+	case GreaterOrEqual:
+		return order >= 0
+	}
+
+	return false
+}
+
+// orderable converts the JSON scalars to the types predicates compare, so 2 and 2.0 are equal
+func orderable(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil, string, bool, float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	default:
+		return nil, false
+	}
+}
+
+func compareFloat(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadFiltered(t *testing.T) {
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore() },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir()) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(map[string]interface{}{})
+			store.Register([]interface{}{})
+
+			contents := []map[string]interface{}{
+				{"type": "OrderPlaced", "total": 12.0, "placed": "2021-06-01"},
+				{"type": "ItemAdded", "sku": "a"},
+				{"type": "OrderPlaced", "total": 40.0, "placed": "2021-06-03"},
+				{"type": "ItemAdded", "sku": "b"},
+				{"type": "OrderShipped", "carriers": []interface{}{"ups", "dhl"}},
+				{"type": "OrderPlaced", "total": 7.5, "placed": "2021-06-05"},
+			}
+			for _, content := range contents {
+				if _, err := store.Append("orders", "1", content); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reader := store.(FilteredReader)
+			read := func(filter ReadFilter, origin string, size int) (string, *RecordList) {
+				list, err := reader.ReadFiltered("orders", "1", origin, size, filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found []string
+				for _, fact := range list.List {
+					content := fact.Content.(map[string]interface{})
+					found = append(found, fmt.Sprintf("%s:%v%v%v", content["type"], content["total"], content["sku"], content["carriers"]))
+				}
+				return strings.Join(found, " "), list
+			}
+
+			found, _ := read(ReadFilter{Types: []string{"ItemAdded", "OrderShipped"}}, "", 0)
+			expectText(t, "types", "ItemAdded:<nil>a<nil> ItemAdded:<nil>b<nil> OrderShipped:<nil><nil>[ups dhl]", found)
+
+			found, _ = read(ReadFilter{Predicates: []Predicate{{Path: "$.total", Operator: GreaterOrEqual, Value: 12}}}, "", 0)
+			expectText(t, "range", "OrderPlaced:12<nil><nil> OrderPlaced:40<nil><nil>", found)
+
+			found, _ = read(ReadFilter{Types: []string{"OrderPlaced"}, Predicates: []Predicate{
+				{Path: "$.placed", Operator: Greater, Value: "2021-06-01"},
+				{Path: "$.total", Operator: Less, Value: 20},
+			}}, "", 0)
+			expectText(t, "both", "OrderPlaced:7.5<nil><nil>", found)
+
+			found, _ = read(ReadFilter{Predicates: []Predicate{{Path: "$.carriers", Operator: Equal, Value: "dhl"}}}, "", 0)
+			expectText(t, "array", "OrderShipped:<nil><nil>[ups dhl]", found)
+
+			found, _ = read(ReadFilter{Predicates: []Predicate{{Path: "$['sku']", Operator: NotEqual, Value: "a"}}}, "", 0)
+			expectText(t, "not equal", "OrderPlaced:12<nil><nil> OrderPlaced:40<nil><nil> ItemAdded:<nil>b<nil> OrderShipped:<nil><nil>[ups dhl] OrderPlaced:7.5<nil><nil>", found)
+
+			// pages are filled with matches, and the last match is the origin of the next page
+			placed := ReadFilter{Types: []string{"OrderPlaced"}}
+			found, page := read(placed, "", 2)
+			expectText(t, "first page", "OrderPlaced:12<nil><nil> OrderPlaced:40<nil><nil>", found)
+			if page.Total != 6 {
+				t.Errorf("expected the total to count all 6 facts, got %d", page.Total)
+			}
+
+			found, page = read(placed, page.List[1].Id.String(), 2)
+			expectText(t, "second page", "OrderPlaced:7.5<nil><nil>", found)
+
+			found, _ = read(placed, page.List[0].Id.String(), 2)
+			expectText(t, "last page", "", found)
+
+			temporal, err := ReadTemporal(store, "orders", "1", TemporalQuery{Filter: placed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(temporal.List) != 3 || temporal.Total != 6 {
+				t.Errorf("expected the temporal read to be filtered to 3 of 6 facts, got %d of %d", len(temporal.List), temporal.Total)
+			}
+
+			_, err = reader.ReadFiltered("orders", "1", "", 0, ReadFilter{Predicates: []Predicate{{Path: "total", Operator: Equal, Value: 1}}})
+			if !errors.As(err, &InvalidFilter{}) {
+				t.Errorf("expected InvalidFilter but got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidFilters(t *testing.T) {
+	predicates := []Predicate{
+		{Path: "$.total", Operator: "~", Value: 1},
+		{Path: "$.total", Operator: Less, Value: true},
+		{Path: "$.total", Operator: Equal, Value: []string{"a"}},
+		{Path: "$", Operator: Equal, Value: 1},
+	}
+
+	for _, p := range predicates {
+		if _, err := (ReadFilter{Predicates: []Predicate{p}}).compile(); err == nil {
+			t.Errorf("expected %v to be invalid", p)
+		}
+	}
+}
+
+func TestFactType(t *testing.T) {
+	expectText(t, "struct", "Test", FactType(Fact{Content: Test{Value: 1}}))
+	expectText(t, "pointer", "Test", FactType(Fact{Content: &Test{Value: 1}}))
+	expectText(t, "map", "OrderPlaced", FactType(Fact{Content: map[string]interface{}{"type": "OrderPlaced"}}))
+	expectText(t, "raw", "OrderPlaced", FactType(Fact{Content: json.RawMessage(`{"type": "OrderPlaced"}`)}))
+	expectText(t, "untyped", "", FactType(Fact{Content: "text"}))
+}
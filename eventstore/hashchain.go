@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// chainHash is the SHA-256 of the previous fact's hash, the fact id, timestamp and JSON content, followed
+// by the occurred time when it differs from the timestamp, the JSON tags when there are any and the JSON
+// correlation id when it is set.  Facts without them hash the same way they did before facts had them.
+// JSON sorts map keys, so the same content always hashes the same way.
+func chainHash(previous []byte, fact Fact) ([]byte, error) {
+	content, err := json.Marshal(fact.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(fact.Timestamp.UnixNano()))
+
+	h := sha256.New()
+	h.Write(previous)
+	h.Write(fact.Id[:])
+	h.Write(timestamp[:])
+	h.Write(content)
+
+	if !fact.OccurredAt.IsZero() && !fact.OccurredAt.Equal(fact.Timestamp) {
+		var occurred [8]byte
+		binary.BigEndian.PutUint64(occurred[:], uint64(fact.OccurredAt.UnixNano()))
+		h.Write(occurred[:])
+	}
+
+	if len(fact.Tags) > 0 {
+		tags, err := json.Marshal(fact.Tags)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(tags)
+	}
+
+	if len(fact.CorrelationId) > 0 {
+		correlationId, err := json.Marshal(fact.CorrelationId)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(correlationId)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// linkFact sets the hash of a new tail.  A fact that already carries a hash, as imported facts do,
+// must match the chain it is appended to.
+func linkFact(aggregate string, entity string, previous []byte, fact *Fact) error {
+	// facts exported before they had an occurred time happened when they were recorded
+	if fact.OccurredAt.IsZero() {
+		fact.OccurredAt = fact.Timestamp
+	}
+
+	hash, err := chainHash(previous, *fact)
+	if err != nil {
+		return err
+	}
+
+	if len(fact.Hash) > 0 && !bytes.Equal(fact.Hash, hash) {
+		return HashMismatch{Aggregate: aggregate, Entity: entity, Id: fact.Id}
+	}
+
+	fact.Hash = hash
+	return nil
+}
+
+// verifyChain recomputes the hash of every fact in the entity.  Facts appended before hashing was
+// added have no hash and come before the first hashed fact.
+func verifyChain(store EventStore, aggregate string, entity string) (*Verification, error) {
+	result := Verification{Valid: true}
+
+	var previous []byte
+	var total uint
+	origin := ""
+	for {
+		page, err := store.Read(aggregate, entity, origin, maxPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		total = page.Total
+		if len(page.List) == 0 {
+			break
+		}
+
+		for _, fact := range page.List {
+			if len(fact.Hash) == 0 {
+				if previous != nil {
+					return result.broken(fact, "the fact has no hash but follows a hashed fact"), nil
+				}
+
+				result.Unchained++
+				continue
+			}
+
+			expected, err := chainHash(previous, fact)
+			if err != nil {
+				return nil, err
+			}
+
+			if !bytes.Equal(expected, fact.Hash) {
+				return result.broken(fact, "the hash does not match the fact or the fact before it"), nil
+			}
+
+			previous = fact.Hash
+			result.Verified++
+		}
+
+		origin = page.List[len(page.List)-1].Id.String()
+	}
+
+	if total == 0 {
+		return nil, EntityNotFound{Aggregate: aggregate, Entity: entity}
+	}
+
+	if walked := result.Verified + result.Unchained; walked != total {
+		result.Valid = false
+		result.Reason = "the entity records more facts than are stored, facts were removed from the tail"
+	}
+
+	return &result, nil
+}
+
+func (v *Verification) broken(fact Fact, reason string) *Verification {
+	v.Valid = false
+	v.BrokenId = fact.Id
+	v.Reason = reason
+	return v
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func appendChain(t *testing.T, store *BadgerEventStore, count int) []Fact {
+	store.Register(Test{})
+
+	var facts []Fact
+	for i := 0; i < count; i++ {
+		tail, err := store.Append("chain", "1", Test{Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		facts = append(facts, tail.Fact)
+	}
+
+	return facts
+}
+
+func verify(t *testing.T, store *BadgerEventStore) *Verification {
+	result, err := store.Verify("chain", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer store.Close()
+
+	facts := appendChain(t, store, 5)
+	for i, fact := range facts {
+		if len(fact.Hash) == 0 {
+			t.Errorf("fact %d has no hash", i)
+		}
+	}
+
+	result := verify(t, store)
+	if !result.Valid || result.Verified != 5 {
+		t.Errorf("expected 5 verified facts, received %+v", result)
+	}
+
+	if _, err := store.Verify("chain", "missing"); !errors.As(err, &EntityNotFound{}) {
+		t.Errorf("expected EntityNotFound, received %v", err)
+	}
+}
+
+func TestVerifyDetectsAlteredFact(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer store.Close()
+
+	facts := appendChain(t, store, 5)
+
+	altered := facts[2]
+	altered.Content = Test{Value: 42}
+	value, _, err := store.encodeFact(altered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(store.factKey("chain", "1", altered.Id.String()), value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := verify(t, store)
+	if result.Valid || result.BrokenId != altered.Id || result.Verified != 2 {
+		t.Errorf("expected the chain to break at %s after 2 facts, received %+v", altered.Id, result)
+	}
+}
+
+func TestVerifyDetectsRemovedFacts(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer store.Close()
+
+	facts := appendChain(t, store, 5)
+
+	remove := func(fact Fact) {
+		err := store.db.Update(func(txn *badger.Txn) error {
+			return txn.Delete(store.factKey("chain", "1", fact.Id.String()))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remove(facts[4])
+	if result := verify(t, store); result.Valid {
+		t.Errorf("expected removing the tail to be detected, received %+v", result)
+	}
+
+	remove(facts[1])
+	if result := verify(t, store); result.Valid || result.BrokenId != facts[2].Id {
+		t.Errorf("expected the chain to break at %s, received %+v", facts[2].Id, result)
+	}
+}
+
+func TestAppendFactRejectsWrongHash(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer store.Close()
+
+	facts := appendChain(t, store, 2)
+
+	timestamp := facts[1].Timestamp.Add(time.Millisecond)
+	next := Fact{Id: NewIdGenerator().NewId(timestamp), Timestamp: timestamp, Content: Test{Value: 2}}
+	next.Hash = facts[0].Hash
+
+	if _, err := store.AppendFact("chain", "1", next); !errors.As(err, &HashMismatch{}) {
+		t.Errorf("expected HashMismatch, received %v", err)
+	}
+}
@@ -17,28 +17,88 @@
 package eventstore
 
 import (
+	"encoding/binary"
 	"github.com/oklog/ulid/v2"
+	"io"
 	"math/rand"
+	"sync"
 	"time"
 )
 
+// IdGenerator creates the ids of new facts.  Append is called from concurrent HTTP handlers, so implementations
+// must be safe for concurrent use.
 type IdGenerator interface {
 	NewId(t time.Time) ulid.ULID
 }
 
+// ulidGenerator hands out strictly increasing ids: an id that would not sort after the previous one, because it
+// was created in the same millisecond or the clock went back, is the previous id plus one.
 type ulidGenerator struct {
-	entropy *ulid.MonotonicEntropy
+	mu      sync.Mutex
+	entropy io.Reader
+	last    ulid.ULID
 }
 
+// NewIdGenerator creates ids with random entropy seeded from the current time.
 func NewIdGenerator() IdGenerator {
-	source := rand.NewSource(time.Now().UTC().UnixNano())
-	rnd := rand.New(source)
+	return newUlidGenerator(rand.New(rand.NewSource(time.Now().UTC().UnixNano())))
+}
 
-	return &ulidGenerator{
-		entropy: ulid.Monotonic(rnd, 0),
-	}
+// NewDeterministicIdGenerator creates the same ids for the same seed and times, which keeps tests repeatable.
+func NewDeterministicIdGenerator(seed int64) IdGenerator {
+	return newUlidGenerator(rand.New(rand.NewSource(seed)))
+}
+
+// NewNodeIdGenerator starts the entropy of every id with the node id, so writers that share a clock tick never
+// create the same id.
+func NewNodeIdGenerator(node uint16) IdGenerator {
+	return newUlidGenerator(&nodeEntropy{
+		node:   node,
+		source: rand.New(rand.NewSource(time.Now().UTC().UnixNano())),
+	})
+}
+
+func newUlidGenerator(entropy io.Reader) *ulidGenerator {
+	return &ulidGenerator{entropy: entropy}
 }
 
 func (id *ulidGenerator) NewId(t time.Time) ulid.ULID {
-	return ulid.MustNew(ulid.Timestamp(t), id.entropy)
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	// the entropy sources are not safe for concurrent use either, so they are read under the lock
+	id.last = followingId(ulid.MustNew(ulid.Timestamp(t), id.entropy), id.last)
+	return id.last
+}
+
+// nodeEntropy writes the node id ahead of the random bytes
+type nodeEntropy struct {
+	node   uint16
+	source io.Reader
+}
+
+func (n *nodeEntropy) Read(p []byte) (int, error) {
+	if len(p) < 2 {
+		return n.source.Read(p)
+	}
+
+	binary.BigEndian.PutUint16(p, n.node)
+	read, err := io.ReadFull(n.source, p[2:])
+	return read + 2, err
+}
+
+// followingId returns id, or the id right after last when a restart or a clock change made id older
+func followingId(id ulid.ULID, last ulid.ULID) ulid.ULID {
+	if id.Compare(last) > 0 {
+		return id
+	}
+
+	for i := len(last) - 1; i >= 0; i-- {
+		last[i]++
+		if last[i] != 0 {
+			break
+		}
+	}
+
+	return last
 }
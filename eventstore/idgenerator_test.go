@@ -18,7 +18,9 @@
 package eventstore
 
 import (
+	"encoding/binary"
 	"github.com/oklog/ulid/v2"
+	"sync"
 	"testing"
 	"time"
 )
@@ -38,3 +40,97 @@ func TestGeneratorNewId(t *testing.T) {
 		lastId = id
 	}
 }
+
+func TestGeneratorIsSafeForConcurrentUse(t *testing.T) {
+	generator := NewIdGenerator()
+	now := time.Now()
+
+	const workers = 16
+	const perWorker = 2000
+
+	ids := make(chan ulid.ULID, workers*perWorker)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var last ulid.ULID
+			for i := 0; i < perWorker; i++ {
+				// every worker uses the same millisecond to force the monotonic increments
+				id := generator.NewId(now)
+				if id.Compare(last) <= 0 {
+					t.Errorf("id %s does not follow %s", id, last)
+					return
+				}
+				last = id
+				ids <- id
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[ulid.ULID]bool, workers*perWorker)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("all ids must be unique, and this was repeated: %s", id)
+		}
+		seen[id] = true
+	}
+
+	if len(seen) != workers*perWorker {
+		t.Errorf("expected %d ids, got %d", workers*perWorker, len(seen))
+	}
+}
+
+func TestDeterministicGeneratorRepeats(t *testing.T) {
+	first := NewDeterministicIdGenerator(42)
+	second := NewDeterministicIdGenerator(42)
+	now := time.Unix(1600000000, 0)
+
+	for i := 0; i < 100; i++ {
+		a := first.NewId(now)
+		b := second.NewId(now)
+		if a != b {
+			t.Fatalf("id %d differs: %s and %s", i, a, b)
+		}
+	}
+
+	if NewDeterministicIdGenerator(43).NewId(now) == NewDeterministicIdGenerator(42).NewId(now) {
+		t.Error("different seeds should create different ids")
+	}
+}
+
+func TestNodeGeneratorPrefixesEntropy(t *testing.T) {
+	generator := NewNodeIdGenerator(0xbeef)
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		id := generator.NewId(now)
+		entropy := id.Entropy()
+		if node := binary.BigEndian.Uint16(entropy); node != 0xbeef {
+			t.Fatalf("id %s has node %x", id, node)
+		}
+	}
+}
+
+func TestFollowingIdStaysAfterLast(t *testing.T) {
+	now := time.Now()
+	last := NewIdGenerator().NewId(now)
+
+	// a new generator, as after a restart, may start behind the last id in the same millisecond
+	for i := 0; i < 100; i++ {
+		id := followingId(NewIdGenerator().NewId(now), last)
+		if id.Compare(last) <= 0 {
+			t.Fatalf("id %s does not follow %s", id, last)
+		}
+	}
+
+	wrap := ulid.ULID{0, 0, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if id := followingId(ulid.ULID{}, wrap); id.Compare(wrap) <= 0 {
+		t.Errorf("id %s does not follow %s", id, wrap)
+	}
+}
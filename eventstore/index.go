@@ -0,0 +1,339 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/oklog/ulid/v2"
+	"strconv"
+	"strings"
+)
+
+const indexKeyPrefix = systemPrefix + "index" + indexSeparator
+
+// Index finds the facts of an aggregate by a value in the fact.  The path is a JSON path over the fact as
+// it is returned by Read, so "$.Content.customerId" indexes the content and "$.OccurredAt" the metadata.
+// An array at the end of the path indexes each of its elements.
+type Index struct {
+	Aggregate string
+	Name      string
+	Path      string
+	steps     []pathStep
+}
+
+// pathStep is a field name, or an array position when field is empty
+type pathStep struct {
+	field    string
+	position int
+}
+
+// IndexMatch is a fact found through a secondary index
+type IndexMatch struct {
+	Entity string
+	Id     ulid.ULID
+}
+
+type IndexMatchList struct {
+	List     []IndexMatch
+	PageSize int
+}
+
+// Indexer is implemented by event stores that keep secondary indexes, see WithIndexes
+type Indexer interface {
+	// Lookup lists the facts of the aggregate with the value in the named index, in the order they were
+	// recorded.  The list starts after the origin fact id.
+	Lookup(aggregate string, index string, value string, origin string, maxCount int) (*IndexMatchList, error)
+}
+
+// NewIndex parses the JSON path of a secondary index.  The path starts at "$", and is followed by
+// ".field", "['field']" or "[position]" steps.
+func NewIndex(aggregate string, name string, path string) (Index, error) {
+	index := Index{Aggregate: aggregate, Name: name, Path: path}
+	invalid := func(reason string) (Index, error) {
+		return index, InvalidIndex{Aggregate: aggregate, Name: name, Reason: reason}
+	}
+
+	if len(aggregate) == 0 || len(name) == 0 {
+		return invalid("the aggregate and name are required")
+	}
+	if strings.Contains(aggregate, indexSeparator) || strings.Contains(name, indexSeparator) {
+		return invalid("the aggregate and name cannot contain a NUL character")
+	}
+	steps, reason := parsePath(path)
+	if len(reason) > 0 {
+		return invalid(reason)
+	}
+
+	index.steps = steps
+	return index, nil
+}
+
+// parsePath reads the steps of a JSON path, or the reason it cannot be read
+func parsePath(path string) ([]pathStep, string) {
+	var steps []pathStep
+	if !strings.HasPrefix(path, "$") {
+		return nil, "the path must start with $"
+	}
+
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, "empty field name in " + path
+			}
+
+			steps = append(steps, pathStep{field: rest[1 : end+1]})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 3 {
+				return nil, "unterminated or empty field name in " + path
+			}
+
+			steps = append(steps, pathStep{field: rest[2:end]})
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, "unterminated array position in " + path
+			}
+
+			position, err := strconv.Atoi(rest[1:end])
+			if err != nil || position < 0 {
+				return nil, "the array position must be a whole number in " + path
+			}
+
+			steps = append(steps, pathStep{position: position})
+			rest = rest[end+1:]
+		default:
+			return nil, "unexpected '" + rest[:1] + "' in " + path
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, "the path must select a value inside the fact"
+	}
+
+	return steps, ""
+}
+
+// selected is the part of the fact document at the end of the path, nil when the fact does not have it
+func (i *Index) selected(document interface{}) interface{} {
+	return selectPath(i.steps, document)
+}
+
+// selectPath follows the steps through the document, nil when the document does not have them
+func selectPath(steps []pathStep, document interface{}) interface{} {
+	current := document
+	for _, step := range steps {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if len(step.field) == 0 {
+				return nil
+			}
+			current = node[step.field]
+		case []interface{}:
+			if len(step.field) > 0 || step.position >= len(node) {
+				return nil
+			}
+			current = node[step.position]
+		default:
+			return nil
+		}
+	}
+
+	return current
+}
+
+// values are the indexed values of the fact document, numbers keep their JSON text
+func (i *Index) values(document interface{}) []string {
+	current := i.selected(document)
+	if list, ok := current.([]interface{}); ok {
+		var values []string
+		for _, element := range list {
+			if value, ok := scalarValue(element); ok {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+
+	if value, ok := scalarValue(current); ok {
+		return []string{value}
+	}
+
+	return nil
+}
+
+func scalarValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// factDocument is the fact as generic JSON, the way the index paths see it
+func factDocument(fact Fact) (interface{}, error) {
+	raw, err := json.Marshal(fact)
+	if err != nil {
+		return nil, err
+	}
+
+	var document interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+func (i *Index) aggregate() string {
+	return i.Aggregate
+}
+
+func (i *Index) prefix() []byte {
+	return []byte(indexNamePrefix(i.Aggregate, i.Name))
+}
+
+func (i *Index) definition() string {
+	return i.Path
+}
+
+func (i *Index) entries(document interface{}, _ string, entity string, fact Fact) []indexEntry {
+	var entries []indexEntry
+	seen := map[string]bool{}
+	for _, value := range i.values(document) {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+
+		entries = append(entries, indexEntry{key: indexKey(i.Aggregate, i.Name, value, fact.Id, entity)})
+	}
+
+	return entries
+}
+
+// index finds the aggregate's index, it is an error to look up an index that is not configured
+func (o *storeOptions) index(aggregate string, name string) (*Index, error) {
+	for i := range o.indexes[aggregate] {
+		if o.indexes[aggregate][i].Name == name {
+			return &o.indexes[aggregate][i], nil
+		}
+	}
+
+	return nil, IndexNotFound{Aggregate: aggregate, Name: name}
+}
+
+// pageFull stops a scan once it has read a page
+type pageFull struct{}
+
+func (pageFull) Error() string {
+	return "the page is full"
+}
+
+// lookupPrefix reads a page of the index entries that start with the prefix.  The scan seeks past the
+// entries of the origin fact id, the separator that follows an id sorts before the start key's.
+func lookupPrefix(store prefixScanner, prefix string, origin string, maxCount int) (*IndexMatchList, error) {
+	list := IndexMatchList{PageSize: maxCount}
+	if list.PageSize < 1 || list.PageSize > maxPageSize {
+		list.PageSize = maxPageSize
+	}
+
+	start := prefix
+	if len(origin) > 0 {
+		start += origin + "\x01"
+	}
+
+	err := store.scanPrefixFrom([]byte(prefix), []byte(start), func(key []byte, _ []byte) error {
+		match, ok := parseIndexMatch(prefix, key)
+		if !ok {
+			return nil
+		}
+
+		list.List = append(list.List, match)
+		if len(list.List) == list.PageSize {
+			return pageFull{}
+		}
+		return nil
+	})
+
+	if err != nil && err != (pageFull{}) {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// indexKey is the index prefix, aggregate, index name, value, fact id and entity.  The fact id keeps the
+// matches in the order they were recorded.
+func indexKey(aggregate string, name string, value string, id ulid.ULID, entity string) []byte {
+	return []byte(indexValuePrefix(aggregate, name, value) + id.String() + indexSeparator + entity)
+}
+
+func indexNamePrefix(aggregate string, name string) string {
+	return indexKeyPrefix + aggregate + indexSeparator + name + indexSeparator
+}
+
+func indexValuePrefix(aggregate string, name string, value string) string {
+	return indexNamePrefix(aggregate, name) + value + indexSeparator
+}
+
+// parseIndexMatch reads the fact id and entity that follow the prefix of an index key
+func parseIndexMatch(prefix string, key []byte) (IndexMatch, bool) {
+	parts := strings.SplitN(string(key[len(prefix):]), indexSeparator, 2)
+	if len(parts) != 2 {
+		return IndexMatch{}, false
+	}
+
+	id, err := ulid.ParseStrict(parts[0])
+	if err != nil {
+		return IndexMatch{}, false
+	}
+
+	return IndexMatch{Entity: parts[1], Id: id}, true
+}
+
+func (b *BadgerEventStore) Lookup(aggregate string, index string, value string, origin string, maxCount int) (*IndexMatchList, error) {
+	if _, err := b.index(aggregate, index); err != nil {
+		return nil, err
+	}
+
+	return lookupPrefix(b, indexValuePrefix(aggregate, index, value), origin, maxCount)
+}
+
+func (b *BoltEventStore) Lookup(aggregate string, index string, value string, origin string, maxCount int) (*IndexMatchList, error) {
+	if _, err := b.index(aggregate, index); err != nil {
+		return nil, err
+	}
+
+	return lookupPrefix(b, indexValuePrefix(aggregate, index, value), origin, maxCount)
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewIndexPaths(t *testing.T) {
+	valid := []string{"$.Content.customerId", "$.Content['customer id']", "$.Content.lines[0].sku", "$.OccurredAt"}
+	for _, path := range valid {
+		if _, err := NewIndex("orders", "test", path); err != nil {
+			t.Errorf("expected %s to be valid: %s", path, err)
+		}
+	}
+
+	invalid := []string{"", "$", "Content.customerId", "$..x", "$.Content[", "$.Content[-1]", "$.Content['x"}
+	for _, path := range invalid {
+		_, err := NewIndex("orders", "test", path)
+		if !errors.As(err, &InvalidIndex{}) {
+			t.Errorf("expected %q to be an invalid index, got %v", path, err)
+		}
+	}
+}
+
+func TestIndexValues(t *testing.T) {
+	document := map[string]interface{}{
+		"Content": map[string]interface{}{
+			"customer": "c1",
+			"tags":     []interface{}{"a", "b", "a"},
+			"lines":    []interface{}{map[string]interface{}{"sku": "s1"}},
+			"nested":   map[string]interface{}{"x": 1},
+		},
+	}
+
+	tests := map[string]int{
+		"$.Content.customer":     1,
+		"$.Content.tags":         3,
+		"$.Content.lines[0].sku": 1,
+		"$.Content.lines[1].sku": 0,
+		"$.Content.nested":       0,
+		"$.Content.missing":      0,
+	}
+
+	for path, expected := range tests {
+		index, err := NewIndex("orders", "test", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if values := index.values(document); len(values) != expected {
+			t.Errorf("%s expected %d values but got %v", path, expected, values)
+		}
+	}
+}
+
+type indexedOrder struct {
+	Customer string
+	Tags     []string
+	Total    float64
+}
+
+func TestLookup(t *testing.T) {
+	byCustomer, _ := NewIndex("orders", "customer", "$.Content.Customer")
+	byTag, _ := NewIndex("orders", "tag", "$.Content.Tags")
+	byTotal, _ := NewIndex("orders", "total", "$.Content.Total")
+	indexes := WithIndexes(byCustomer, byTag, byTotal)
+
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore(indexes) },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir(), indexes) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(indexedOrder{})
+
+			appends := []struct {
+				entity string
+				order  indexedOrder
+			}{
+				{"1", indexedOrder{Customer: "c1", Tags: []string{"rush", "gift"}, Total: 10}},
+				{"2", indexedOrder{Customer: "c2", Tags: []string{"gift"}, Total: 12.5}},
+				{"3", indexedOrder{Customer: "c1", Total: 10}},
+				{"1", indexedOrder{Customer: "c1", Total: 11}},
+			}
+			for _, a := range appends {
+				if _, err := store.Append("orders", a.entity, a.order); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			indexer := store.(Indexer)
+			entities := func(index string, value string, origin string, size int) ([]string, *IndexMatchList) {
+				matches, err := indexer.Lookup("orders", index, value, origin, size)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found []string
+				for _, m := range matches.List {
+					found = append(found, m.Entity)
+				}
+				return found, matches
+			}
+
+			expect := func(found []string, expected ...string) {
+				t.Helper()
+				if len(found) != len(expected) {
+					t.Fatalf("expected %v but got %v", expected, found)
+				}
+				for i := range found {
+					if found[i] != expected[i] {
+						t.Fatalf("expected %v but got %v", expected, found)
+					}
+				}
+			}
+
+			found, _ := entities("customer", "c1", "", 0)
+			expect(found, "1", "3", "1")
+
+			found, _ = entities("tag", "gift", "", 0)
+			expect(found, "1", "2")
+
+			found, _ = entities("total", "10", "", 0)
+			expect(found, "1", "3")
+
+			found, _ = entities("customer", "nobody", "", 0)
+			expect(found)
+
+			found, page := entities("customer", "c1", "", 2)
+			expect(found, "1", "3")
+
+			found, _ = entities("customer", "c1", page.List[1].Id.String(), 2)
+			expect(found, "1")
+
+			found, _ = entities("customer", "c1", page.List[0].Id.String()[:10], 0)
+			expect(found, "1", "3", "1")
+
+			_, err := indexer.Lookup("orders", "missing", "x", "", 0)
+			if !errors.As(err, &IndexNotFound{}) {
+				t.Errorf("expected IndexNotFound but got %v", err)
+			}
+		})
+	}
+}
+
+func TestIndexesAreRebuiltWhenTheyChange(t *testing.T) {
+	byCustomer, _ := NewIndex("orders", "customer", "$.Content.Customer")
+	byTag, _ := NewIndex("orders", "customer", "$.Content.Tags")
+
+	stores := map[string]func(dir string, opts ...Option) EventStore{
+		"badger": func(dir string, opts ...Option) EventStore { return FileStore(dir, opts...) },
+		"bolt":   func(dir string, opts ...Option) EventStore { return BoltFileStore(dir, opts...) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			lookup := func(store EventStore, value string) uint {
+				matches, err := store.(Indexer).Lookup("orders", "customer", value, "", 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return uint(len(matches.List))
+			}
+
+			// facts appended before the index existed
+			store := open(dir)
+			store.Register(indexedOrder{})
+			if _, err := store.Append("orders", "1", indexedOrder{Customer: "c1", Tags: []string{"gift"}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			store = open(dir, WithIndexes(byCustomer))
+			if found := lookup(store, "c1"); found != 1 {
+				t.Errorf("expected the new index to find the existing fact, found %d", found)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// same name, new path
+			store = open(dir, WithIndexes(byTag))
+			if found := lookup(store, "c1"); found != 0 {
+				t.Errorf("expected the entries of the old path to be dropped, found %d", found)
+			}
+			if found := lookup(store, "gift"); found != 1 {
+				t.Errorf("expected the changed index to be rebuilt, found %d", found)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// removed and added back
+			store = open(dir)
+			if _, err := store.Scan("orders"); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			store = open(dir, WithIndexes(byTag))
+			if found := lookup(store, "gift"); found != 1 {
+				t.Errorf("expected the index to be rebuilt after it was removed, found %d", found)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"github.com/oklog/ulid/v2"
+	"strings"
+)
+
+const (
+	locationKeyPrefix = systemPrefix + "fact" + indexSeparator
+	// locationDefinition is changed when the location entries change, so the index is rebuilt
+	locationDefinition = "aggregate entity"
+)
+
+// FactLocation is where a fact is stored
+type FactLocation struct {
+	Aggregate string
+	Entity    string
+	Id        ulid.ULID
+}
+
+// FactLocator is implemented by event stores that index every fact by its id
+type FactLocator interface {
+	// Locate finds the aggregate and entity of a fact, or returns FactNotFound
+	Locate(factId string) (*FactLocation, error)
+}
+
+// locations is the derived index of where each fact is stored.  It covers every aggregate, so it is built
+// for the facts stored before it existed the first time the store opens.
+type locations struct{}
+
+func (locations) aggregate() string {
+	return ""
+}
+
+func (locations) prefix() []byte {
+	return []byte(locationKeyPrefix)
+}
+
+func (locations) definition() string {
+	return locationDefinition
+}
+
+func (locations) entries(_ interface{}, aggregate string, entity string, fact Fact) []indexEntry {
+	return []indexEntry{locationEntry(aggregate, entity, fact)}
+}
+
+// locationEntry is keyed by the fact id alone, its value is the aggregate and entity
+func locationEntry(aggregate string, entity string, fact Fact) indexEntry {
+	return indexEntry{
+		key:   locationKey(fact.Id),
+		value: []byte(aggregate + indexSeparator + entity),
+	}
+}
+
+func locationKey(id ulid.ULID) []byte {
+	return []byte(locationKeyPrefix + id.String())
+}
+
+// parseLocation reads the aggregate and entity of a location entry
+func parseLocation(id ulid.ULID, value []byte) (*FactLocation, bool) {
+	parts := strings.SplitN(string(value), indexSeparator, 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	return &FactLocation{Aggregate: parts[0], Entity: parts[1], Id: id}, true
+}
+
+// factExists is FactExists when the fact's id already has a location, the location index would otherwise
+// point to the new fact and lose the one stored before
+func factExists(id ulid.ULID, value []byte) error {
+	location, ok := parseLocation(id, value)
+	if !ok {
+		return nil
+	}
+
+	return FactExists{Id: id, Aggregate: location.Aggregate, Entity: location.Entity}
+}
+
+// locate reads the location index entry of the fact
+func locate(store prefixScanner, factId string) (*FactLocation, error) {
+	id, err := ulid.ParseStrict(factId)
+	if err != nil {
+		return nil, FactNotFound{Id: factId}
+	}
+
+	var location *FactLocation
+	err = store.scanPrefix(locationKey(id), func(_ []byte, value []byte) error {
+		if found, ok := parseLocation(id, value); ok {
+			location = found
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, FactNotFound{Id: factId}
+	}
+
+	return location, nil
+}
+
+func (b *BadgerEventStore) Locate(factId string) (*FactLocation, error) {
+	return locate(b, factId)
+}
+
+func (b *BoltEventStore) Locate(factId string) (*FactLocation, error) {
+	return locate(b, factId)
+}
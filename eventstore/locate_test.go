@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	bolt "go.etcd.io/bbolt"
+	"testing"
+)
+
+func TestLocationsAreBuiltForExistingFacts(t *testing.T) {
+	stores := map[string]struct {
+		open func(dir string) EventStore
+		// forget removes the location index, the way a store written before it existed looks
+		forget func(store EventStore) error
+	}{
+		"badger": {
+			open: func(dir string) EventStore { return FileStore(dir) },
+			forget: func(store EventStore) error {
+				db, err := store.(*BadgerEventStore).kvStore()
+				if err != nil {
+					return err
+				}
+				if err := db.DropPrefix([]byte(locationKeyPrefix)); err != nil {
+					return err
+				}
+				return db.Update(func(txn *badger.Txn) error {
+					return txn.Delete(indexDefKey(locations{}))
+				})
+			},
+		},
+		"bolt": {
+			open: func(dir string) EventStore { return BoltFileStore(dir) },
+			forget: func(store EventStore) error {
+				db, err := store.(*BoltEventStore).boltDb()
+				if err != nil {
+					return err
+				}
+				return db.Update(func(tx *bolt.Tx) error {
+					indexes := tx.Bucket(indexBucket)
+					if err := deletePrefix(indexes, []byte(locationKeyPrefix)); err != nil {
+						return err
+					}
+					return indexes.Delete(indexDefKey(locations{}))
+				})
+			},
+		},
+	}
+
+	for name, driver := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store := driver.open(dir)
+			store.Register(Test{})
+
+			order, err := store.Append("orders", "1", Test{Value: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			payment, err := store.Append("payments", "7", Test{Value: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := driver.forget(store); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.(FactLocator).Locate(order.Fact.Id.String()); err == nil {
+				t.Fatal("expected the location index to be gone")
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			store = driver.open(dir)
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			for _, tail := range []struct {
+				aggregate string
+				entity    string
+				fact      Fact
+			}{{"orders", "1", order.Fact}, {"payments", "7", payment.Fact}} {
+				location, err := store.(FactLocator).Locate(tail.fact.Id.String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if location.Aggregate != tail.aggregate || location.Entity != tail.entity {
+					t.Errorf("expected %s to be in %s|%s, located it in %s|%s", tail.fact.Id, tail.aggregate,
+						tail.entity, location.Aggregate, location.Entity)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateFactIdsAreRejected(t *testing.T) {
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore() },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir()) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(Test{})
+
+			tail, err := store.Append("orders", "1", Test{Value: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			importer := store.(Importer)
+			_, err = importer.AppendFact("orders", "2", tail.Fact)
+			var exists FactExists
+			if !errors.As(err, &exists) || exists.Entity != "1" {
+				t.Errorf("expected FactExists in entity 1, received %v", err)
+			}
+
+			// importing the fact into its own entity again is not a duplicate
+			if _, err := importer.AppendFact("orders", "1", tail.Fact); err != nil {
+				t.Errorf("expected the stored fact to be accepted again, received %v", err)
+			}
+
+			location, err := store.(FactLocator).Locate(tail.Fact.Id.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if location.Entity != "1" {
+				t.Errorf("expected the fact to stay in entity 1, received %+v", location)
+			}
+
+			if _, err := store.Tail("orders", "2"); !errors.As(err, &EntityNotFound{}) {
+				t.Errorf("expected the duplicate not to create entity 2, received %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"context"
+	"github.com/dgraph-io/badger/v4"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// DefaultDiscardRatio rewrites value log files when half their data is stale
+const DefaultDiscardRatio = 0.5
+
+// MaintenanceResult reports the disk space before and after a maintenance run
+type MaintenanceResult struct {
+	// Rewrites is the number of value log files that were rewritten
+	Rewrites int
+	// BytesBefore is the size of the store's files before the run
+	BytesBefore int64
+	// BytesAfter is the size of the store's files after the run
+	BytesAfter int64
+}
+
+// Reclaimed is the disk space the run freed
+func (m *MaintenanceResult) Reclaimed() int64 {
+	return m.BytesBefore - m.BytesAfter
+}
+
+// Maintainer is implemented by event stores that need to reclaim disk space in the background
+type Maintainer interface {
+	// CollectGarbage rewrites the files with at least discardRatio stale data
+	CollectGarbage(discardRatio float64) (*MaintenanceResult, error)
+	// Compact merges the whole store into its lowest level, then collects garbage
+	Compact(discardRatio float64) (*MaintenanceResult, error)
+}
+
+func (b *BadgerEventStore) CollectGarbage(discardRatio float64) (*MaintenanceResult, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	result := MaintenanceResult{BytesBefore: b.diskSize()}
+	if err := collectGarbage(db, discardRatio, &result); err != nil {
+		return nil, err
+	}
+	result.BytesAfter = b.diskSize()
+
+	return &result, nil
+}
+
+func (b *BadgerEventStore) Compact(discardRatio float64) (*MaintenanceResult, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	result := MaintenanceResult{BytesBefore: b.diskSize()}
+	if err := db.Flatten(runtime.NumCPU()); err != nil {
+		return nil, err
+	}
+
+	if err := collectGarbage(db, discardRatio, &result); err != nil {
+		return nil, err
+	}
+	result.BytesAfter = b.diskSize()
+
+	return &result, nil
+}
+
+// collectGarbage keeps rewriting value log files until badger finds none worth rewriting
+func collectGarbage(db *badger.DB, discardRatio float64, result *MaintenanceResult) error {
+	for {
+		err := db.RunValueLogGC(discardRatio)
+		if err == badger.ErrNoRewrite {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result.Rewrites++
+	}
+}
+
+// diskSize adds up the store's files.  Badger only refreshes its own size report once a minute.
+func (b *BadgerEventStore) diskSize() int64 {
+	if b.MemoryOnly {
+		return 0
+	}
+
+	var size int64
+	_ = filepath.Walk(b.RootDir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
+
+// MaintenanceSchedule collects garbage every Interval
+type MaintenanceSchedule struct {
+	Store        Maintainer
+	Interval     time.Duration
+	DiscardRatio float64
+}
+
+// Run collects garbage until the context is cancelled
+func (s *MaintenanceSchedule) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := s.Store.CollectGarbage(s.DiscardRatio)
+			if err != nil {
+				log.Printf("Value log garbage collection failed: %s", err)
+			} else if result.Rewrites > 0 {
+				log.Printf("Value log garbage collection rewrote %d files, reclaiming %d bytes", result.Rewrites, result.Reclaimed())
+			}
+		}
+	}
+}
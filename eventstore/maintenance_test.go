@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import "testing"
+
+func TestBadgerEventStoreMaintenance(t *testing.T) {
+	store := FileStore(t.TempDir()).(*BadgerEventStore)
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	for i := 0; i < 100; i++ {
+		if _, err := store.Append("maintenance", "1", Test{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := store.CollectGarbage(DefaultDiscardRatio)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.BytesBefore <= 0 {
+		t.Errorf("expected the store to report its size, received %+v", result)
+	}
+
+	if _, err := store.Compact(DefaultDiscardRatio); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := store.Read("maintenance", "1", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if records.Total != 100 || len(records.List) != 100 {
+		t.Errorf("expected compaction to keep all 100 facts, received %d", len(records.List))
+	}
+}
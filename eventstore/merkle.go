@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import "crypto/sha256"
+
+// The Merkle tree follows RFC 6962: leaves and interior nodes are hashed with different prefixes, and a
+// tree of n leaves splits at the largest power of two smaller than n.
+
+func merkleLeaf(hash []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(hash)
+	return h.Sum(nil)
+}
+
+func merkleNode(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleSplit is the largest power of two smaller than n
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleRoot is the root of a tree over the leaf hashes
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return sha256.New().Sum(nil)
+	case 1:
+		return leaves[0]
+	}
+
+	k := merkleSplit(len(leaves))
+	return merkleNode(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// merklePath is the audit path proving the leaf at index is in the tree, closest sibling first
+func merklePath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+
+	k := merkleSplit(len(leaves))
+	if index < k {
+		return append(merklePath(index, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+
+	return append(merklePath(index-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+// merkleRootFromPath recomputes the root of a tree of size leaves from one leaf and its audit path,
+// returning nil when the path cannot belong to a tree of that size
+func merkleRootFromPath(index uint64, size uint64, leaf []byte, path [][]byte) []byte {
+	if index >= size {
+		return nil
+	}
+
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return nil
+		}
+
+		if fn&1 == 1 || fn == sn {
+			r = merkleNode(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNode(r, p)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return nil
+	}
+
+	return r
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	bolt "go.etcd.io/bbolt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	modifiedKeyPrefix = systemPrefix + "modified" + indexSeparator
+	// modifiedBuiltKey marks a store whose last-modified index covers the entities stored before it existed
+	modifiedBuiltKey = systemPrefix + "modified-built"
+)
+
+// ModifiedEntity is an entity along with the time its last fact was recorded
+type ModifiedEntity struct {
+	Entity       string
+	LastModified time.Time
+}
+
+// ModifiedScanner is implemented by event stores that index the entities of each aggregate by the time
+// they were last modified
+type ModifiedScanner interface {
+	// ScanModified lists the entities of the aggregate last modified at or after since, least recently
+	// modified first.  A zero since lists every entity.
+	ScanModified(aggregate string, since time.Time) ([]ModifiedEntity, error)
+}
+
+func modifiedPrefix(aggregate string) string {
+	return modifiedKeyPrefix + aggregate + indexSeparator
+}
+
+// modifiedKey sorts the entities of the aggregate by the time they were modified, then by name
+func modifiedKey(aggregate string, entity string, modified time.Time) []byte {
+	return []byte(modifiedPrefix(aggregate) + modifiedTime(modified) + indexSeparator + entity)
+}
+
+// modifiedTime is a fixed width hex number of nanoseconds, so the keys sort in time order
+func modifiedTime(t time.Time) string {
+	return fmt.Sprintf("%016x", uint64(t.UnixNano()))
+}
+
+// touch moves the entity in the last-modified index to the time of its new tail, returning the key of the
+// entry it replaces, if any, and the new entry
+func (s *AggregateStats) touch(aggregate string, entity string, tail Fact) ([]byte, indexEntry) {
+	var stale []byte
+	if !s.LastModified.IsZero() {
+		stale = modifiedKey(aggregate, entity, s.LastModified)
+	}
+
+	s.LastModified = tail.Timestamp
+	return stale, indexEntry{key: modifiedKey(aggregate, entity, tail.Timestamp)}
+}
+
+// scanModified reads the last-modified index of the aggregate from the since time on
+func scanModified(store prefixScanner, aggregate string, since time.Time) ([]ModifiedEntity, error) {
+	prefix := modifiedPrefix(aggregate)
+	start := prefix
+	if !since.IsZero() {
+		start += modifiedTime(since)
+	}
+
+	var entities []ModifiedEntity
+	err := store.scanPrefixFrom([]byte(prefix), []byte(start), func(key []byte, _ []byte) error {
+		parts := strings.SplitN(string(key[len(prefix):]), indexSeparator, 2)
+		if len(parts) != 2 {
+			return nil
+		}
+
+		nanos, err := strconv.ParseUint(parts[0], 16, 64)
+		if err != nil {
+			return nil
+		}
+
+		entities = append(entities, ModifiedEntity{Entity: parts[1], LastModified: time.Unix(0, int64(nanos)).UTC()})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entities, nil
+}
+
+func (b *BadgerEventStore) ScanModified(aggregate string, since time.Time) ([]ModifiedEntity, error) {
+	return scanModified(b, aggregate, since)
+}
+
+func (b *BoltEventStore) ScanModified(aggregate string, since time.Time) ([]ModifiedEntity, error) {
+	return scanModified(b, aggregate, since)
+}
+
+// modifiedEntity is an entity whose last-modified time is filled in when the store opens
+type modifiedEntity struct {
+	aggregate string
+	entity    string
+	stats     AggregateStats
+}
+
+// syncModified builds the last-modified index of the entities stored before it existed, from the time
+// their tail was recorded
+func (b *BadgerEventStore) syncModified(db *badger.DB) error {
+	built := false
+	var entities []modifiedEntity
+	err := db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(modifiedBuiltKey))
+		if err == nil {
+			built = true
+			return nil
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := string(it.Item().Key())
+			parts := strings.Split(key, separator)
+			if len(parts) != 2 || strings.HasPrefix(key, systemPrefix) {
+				// only the entity stats
+				continue
+			}
+
+			var stats AggregateStats
+			err := it.Item().Value(func(value []byte) error {
+				return decodeStats(value, &stats)
+			})
+			if err != nil {
+				return err
+			}
+			if stats.Total == 0 {
+				continue
+			}
+
+			tail, err := txn.Get(b.factKey(parts[0], parts[1], stats.LastId.String()))
+			if err != nil {
+				return err
+			}
+
+			fact, err := decodeFact(tail)
+			if err != nil {
+				return err
+			}
+
+			stats.LastModified = fact.Timestamp
+			entities = append(entities, modifiedEntity{aggregate: parts[0], entity: parts[1], stats: stats})
+		}
+
+		return nil
+	})
+
+	if err != nil || built {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, e := range entities {
+		value, err := encodeStats(&e.stats)
+		if err != nil {
+			return err
+		}
+		if err := wb.Set(b.aggregateKey(e.aggregate, e.entity), value); err != nil {
+			return err
+		}
+		if err := wb.Set(modifiedKey(e.aggregate, e.entity, e.stats.LastModified), nil); err != nil {
+			return err
+		}
+	}
+
+	if err := wb.Set([]byte(modifiedBuiltKey), []byte{1}); err != nil {
+		return err
+	}
+
+	return wb.Flush()
+}
+
+func (b *BoltEventStore) syncModified(tx *bolt.Tx) error {
+	indexes := tx.Bucket(indexBucket)
+	if indexes.Get([]byte(modifiedBuiltKey)) != nil {
+		return nil
+	}
+
+	// buckets cannot change while they are walked, so the stats are written afterwards
+	var entities []modifiedEntity
+	err := tx.Bucket(statsBucket).ForEach(func(aggregate, _ []byte) error {
+		return tx.Bucket(statsBucket).Bucket(aggregate).ForEach(func(entity, value []byte) error {
+			var stats AggregateStats
+			if err := decodeStats(value, &stats); err != nil {
+				return err
+			}
+			if stats.Total == 0 {
+				return nil
+			}
+
+			facts := b.entityBucket(tx, string(aggregate), string(entity))
+			if facts == nil {
+				return EntityNotFound{Aggregate: string(aggregate), Entity: string(entity)}
+			}
+
+			fact, err := decodeFactValue(facts.Get([]byte(stats.LastId.String())))
+			if err != nil {
+				return err
+			}
+
+			stats.LastModified = fact.Timestamp
+			entities = append(entities, modifiedEntity{aggregate: string(aggregate), entity: string(entity), stats: stats})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entities {
+		if err := b.updateEntityStats(tx, e.aggregate, e.entity, &e.stats); err != nil {
+			return err
+		}
+		if err := indexes.Put(modifiedKey(e.aggregate, e.entity, e.stats.LastModified), nil); err != nil {
+			return err
+		}
+	}
+
+	return indexes.Put([]byte(modifiedBuiltKey), []byte{1})
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	bolt "go.etcd.io/bbolt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanModified(t *testing.T) {
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	stores := map[string]struct {
+		open func(dir string, clock Clock) EventStore
+		// forget removes the last-modified index and times, the way a store written before they existed looks
+		forget func(store EventStore) error
+	}{
+		"badger": {
+			open: func(dir string, clock Clock) EventStore { return FileStore(dir, WithClock(clock)) },
+			forget: func(store EventStore) error {
+				b := store.(*BadgerEventStore)
+				db, err := b.kvStore()
+				if err != nil {
+					return err
+				}
+				if err := db.DropPrefix([]byte(modifiedKeyPrefix)); err != nil {
+					return err
+				}
+				return db.Update(func(txn *badger.Txn) error {
+					for _, entity := range []string{"1", "2", "3"} {
+						stats, err := b.readEntityStats(txn, "orders", entity)
+						if err != nil {
+							return err
+						}
+						stats.LastModified = time.Time{}
+						if err := b.updateEntityStats(txn, "orders", entity, stats); err != nil {
+							return err
+						}
+					}
+					return txn.Delete([]byte(modifiedBuiltKey))
+				})
+			},
+		},
+		"bolt": {
+			open: func(dir string, clock Clock) EventStore { return BoltFileStore(dir, WithClock(clock)) },
+			forget: func(store EventStore) error {
+				b := store.(*BoltEventStore)
+				db, err := b.boltDb()
+				if err != nil {
+					return err
+				}
+				return db.Update(func(tx *bolt.Tx) error {
+					for _, entity := range []string{"1", "2", "3"} {
+						stats, err := b.readEntityStats(tx, "orders", entity)
+						if err != nil {
+							return err
+						}
+						stats.LastModified = time.Time{}
+						if err := b.updateEntityStats(tx, "orders", entity, stats); err != nil {
+							return err
+						}
+					}
+					indexes := tx.Bucket(indexBucket)
+					if err := deletePrefix(indexes, []byte(modifiedKeyPrefix)); err != nil {
+						return err
+					}
+					return indexes.Delete([]byte(modifiedBuiltKey))
+				})
+			},
+		},
+	}
+
+	for name, driver := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			clock := NewFakeClock(start)
+			store := driver.open(dir, clock)
+			store.Register(Test{})
+
+			scan := func(since time.Time) string {
+				entities, err := store.(ModifiedScanner).ScanModified("orders", since)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found []string
+				for _, e := range entities {
+					found = append(found, fmt.Sprintf("%s@%d", e.Entity, e.LastModified.Sub(start)/time.Hour))
+				}
+				return strings.Join(found, " ")
+			}
+
+			// entity 1 at hour 0 and 3, entity 2 at hour 1, entity 3 at hour 2
+			for i, entity := range []string{"1", "2", "3", "1"} {
+				clock.Set(start.Add(time.Duration(i) * time.Hour))
+				if _, err := store.Append("orders", entity, Test{Value: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := store.Append("other", "1", Test{Value: 9}); err != nil {
+				t.Fatal(err)
+			}
+
+			expectText(t, "all", "2@1 3@2 1@3", scan(time.Time{}))
+			expectText(t, "since", "3@2 1@3", scan(start.Add(2*time.Hour)))
+			expectText(t, "after", "", scan(start.Add(4*time.Hour)))
+
+			if err := driver.forget(store); err != nil {
+				t.Fatal(err)
+			}
+			expectText(t, "forgotten", "", scan(time.Time{}))
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			store = driver.open(dir, clock)
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			expectText(t, "rebuilt", "2@1 3@2 1@3", scan(time.Time{}))
+
+			// the entity moves rather than being listed twice
+			clock.Set(start.Add(5 * time.Hour))
+			if _, err := store.Append("orders", "2", Test{Value: 5}); err != nil {
+				t.Fatal(err)
+			}
+			expectText(t, "moved", "3@2 1@3 2@5", scan(time.Time{}))
+		})
+	}
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/oklog/ulid/v2"
+	"io"
+	"time"
+)
+
+// maxImportLine is the longest NDJSON record Import accepts
+const maxImportLine = 16 * 1024 * 1024
+
+// Record is one line of an NDJSON export
+type Record struct {
+	Aggregate string `json:"aggregate"`
+	Entity    string `json:"entity"`
+	Fact      Fact   `json:"fact"`
+}
+
+// ExportFilter limits the facts written by Export
+type ExportFilter struct {
+	// Aggregates to export, all aggregates when empty
+	Aggregates []string
+	// From is the earliest fact timestamp exported, unbounded when zero
+	From time.Time
+	// To is the timestamp the exported facts are before, unbounded when zero
+	To time.Time
+}
+
+func (f ExportFilter) includes(fact Fact) bool {
+	if !f.From.IsZero() && fact.Timestamp.Before(f.From) {
+		return false
+	}
+
+	return f.To.IsZero() || fact.Timestamp.Before(f.To)
+}
+
+// ImportError reports the NDJSON line an import stopped at
+type ImportError struct {
+	Line  int
+	Cause error
+}
+
+func (e ImportError) Error() string {
+	return fmt.Sprintf("import failed at line %d: %s", e.Line, e.Cause)
+}
+
+func (e ImportError) Unwrap() error {
+	return e.Cause
+}
+
+// Export writes the facts matching the filter as newline delimited JSON records, entity by entity in
+// fact order, and returns the number of records written.
+func Export(store EventStore, w io.Writer, filter ExportFilter) (int, error) {
+	aggregates := filter.Aggregates
+	if len(aggregates) == 0 {
+		lister, ok := store.(AggregateLister)
+		if !ok {
+			return 0, fmt.Errorf("the event store cannot list its aggregates, name the aggregates to export")
+		}
+
+		var err error
+		aggregates, err = lister.Aggregates()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	count := 0
+
+	for _, aggregate := range aggregates {
+		entities, err := store.Scan(aggregate)
+		if err != nil {
+			return count, err
+		}
+
+		for _, entity := range entities.List {
+			origin := ""
+			for {
+				page, err := store.Read(aggregate, entity, origin, maxPageSize)
+				if err != nil {
+					return count, err
+				}
+
+				if len(page.List) == 0 {
+					break
+				}
+
+				for _, fact := range page.List {
+					if !filter.includes(fact) {
+						continue
+					}
+
+					if err := enc.Encode(Record{Aggregate: aggregate, Entity: entity, Fact: fact}); err != nil {
+						return count, err
+					}
+					count++
+				}
+
+				origin = page.List[len(page.List)-1].Id.String()
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// ContentDecoder turns the JSON content of an imported fact into the value appended to the store
+type ContentDecoder func(content json.RawMessage) (interface{}, error)
+
+// Import appends the NDJSON records read from r with their original ids and timestamps, and returns
+// the number of records read.  Facts must be in order within each entity, and a fact that is
+// already stored is skipped, so an interrupted import can be run again.  A nil decode unmarshals
+// the content into generic JSON values.
+func Import(store Importer, r io.Reader, decode ContentDecoder) (int, error) {
+	if decode == nil {
+		decode = func(content json.RawMessage) (interface{}, error) {
+			if len(content) == 0 {
+				return nil, nil
+			}
+
+			var value interface{}
+			err := json.Unmarshal(content, &value)
+			return value, err
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+
+	// The last id read for each entity, facts must be in order within the file as well as after the store's tail
+	last := make(map[string]ulid.ULID)
+
+	line, count := 0, 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record struct {
+			Aggregate string `json:"aggregate"`
+			Entity    string `json:"entity"`
+			Fact      struct {
+				Id            json.RawMessage
+				Timestamp     time.Time
+				OccurredAt    time.Time
+				Tags          []string
+				CorrelationId string
+				Content       json.RawMessage
+				Hash          []byte
+			} `json:"fact"`
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return count, ImportError{Line: line, Cause: err}
+		}
+
+		if len(record.Aggregate) == 0 || len(record.Entity) == 0 {
+			return count, ImportError{Line: line, Cause: fmt.Errorf("aggregate and entity are required")}
+		}
+
+		fact := Fact{
+			Timestamp:     record.Fact.Timestamp,
+			OccurredAt:    record.Fact.OccurredAt,
+			Tags:          record.Fact.Tags,
+			CorrelationId: record.Fact.CorrelationId,
+			Hash:          record.Fact.Hash,
+		}
+		if err := json.Unmarshal(record.Fact.Id, &fact.Id); err != nil {
+			return count, ImportError{Line: line, Cause: err}
+		}
+
+		key := record.Aggregate + separator + record.Entity
+		if previous, ok := last[key]; ok && fact.Id.Compare(previous) <= 0 {
+			return count, ImportError{Line: line, Cause: OutOfOrder{
+				Aggregate: record.Aggregate,
+				Entity:    record.Entity,
+				Id:        fact.Id,
+				LastId:    previous,
+			}}
+		}
+		last[key] = fact.Id
+
+		content, err := decode(record.Fact.Content)
+		if err != nil {
+			return count, ImportError{Line: line, Cause: err}
+		}
+		fact.Content = content
+
+		if _, err := store.AppendFact(record.Aggregate, record.Entity, fact); err != nil {
+			return count, ImportError{Line: line, Cause: err}
+		}
+		count++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return count, ImportError{Line: line + 1, Cause: err}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := MemoryStore().(*BadgerEventStore)
+	target := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		if err := source.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := target.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	source.Register(map[string]interface{}{})
+
+	for _, aggregate := range []string{"orders", "orders2", "users"} {
+		for _, entity := range []string{"1", "10"} {
+			for i := 0; i < 3; i++ {
+				content := map[string]interface{}{"value": float64(i)}
+				if _, err := source.Append(aggregate, entity, content); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	aggregates, err := source.Aggregates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(aggregates, []string{"orders", "orders2", "users"}) {
+		t.Errorf("unexpected aggregates %v", aggregates)
+	}
+
+	var dump bytes.Buffer
+	count, err := Export(source, &dump, ExportFilter{Aggregates: []string{"orders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 6 || strings.Count(dump.String(), "\n") != 6 {
+		t.Fatalf("expected 6 exported records, received %d:\n%s", count, dump.String())
+	}
+
+	// import twice to check a repeated import stores each fact once
+	for i := 0; i < 2; i++ {
+		if _, err := Import(target, bytes.NewReader(dump.Bytes()), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, entity := range []string{"1", "10"} {
+		expected, err := source.Read("orders", entity, "", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := target.Read("orders", entity, "", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if imported.Total != expected.Total {
+			t.Errorf("entity %s: expected total %d, received %d", entity, expected.Total, imported.Total)
+		}
+
+		for i, fact := range imported.List {
+			if fact.Id != expected.List[i].Id || !fact.Timestamp.Equal(expected.List[i].Timestamp) {
+				t.Errorf("entity %s fact %d: expected %s, received %s", entity, i, expected.List[i].Id, fact.Id)
+			}
+
+			if !reflect.DeepEqual(fact.Content, expected.List[i].Content) {
+				t.Errorf("entity %s fact %d: expected %v, received %v", entity, i, expected.List[i].Content, fact.Content)
+			}
+		}
+	}
+
+	if entities, _ := target.Scan("users"); entities.Total != 0 {
+		t.Errorf("expected the filtered aggregate not to be imported")
+	}
+}
+
+func TestExportImportKeepsMetadata(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore(WithClock(clock)) },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir(), WithClock(clock)) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			source, target := open(), open()
+			defer func() {
+				if err := source.Close(); err != nil {
+					t.Error(err)
+				}
+				if err := target.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			source.Register(map[string]interface{}{})
+			target.Register(map[string]interface{}{})
+
+			for i := 0; i < 3; i++ {
+				clock.Advance(time.Minute)
+				metadata := Metadata{
+					OccurredAt:    clock.Now().Add(-time.Hour),
+					Tags:          []string{"priority", fmt.Sprintf("step-%d", i)},
+					CorrelationId: "checkout-1",
+				}
+				content := map[string]interface{}{"value": float64(i)}
+				if _, err := source.(MetadataAppender).AppendWith("orders", "1", content, metadata); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var dump bytes.Buffer
+			if _, err := Export(source, &dump, ExportFilter{Aggregates: []string{"orders"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			count, err := Import(target.(Importer), bytes.NewReader(dump.Bytes()), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if count != 3 {
+				t.Errorf("expected 3 imported records, received %d", count)
+			}
+
+			expected, err := source.Read("orders", "1", "", -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			imported, err := target.Read("orders", "1", "", -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, fact := range imported.List {
+				want := expected.List[i]
+				if !fact.OccurredAt.Equal(want.OccurredAt) || !reflect.DeepEqual(fact.Tags, want.Tags) || fact.CorrelationId != want.CorrelationId {
+					t.Errorf("fact %d: expected %v %v %q, received %v %v %q", i, want.OccurredAt, want.Tags, want.CorrelationId,
+						fact.OccurredAt, fact.Tags, fact.CorrelationId)
+				}
+			}
+
+			verification, err := target.(Verifier).Verify("orders", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !verification.Valid || verification.Verified != 3 {
+				t.Errorf("expected the imported chain to verify, received %+v", verification)
+			}
+
+			tagged, err := target.(TagReader).Tagged("orders", "priority", "", -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tagged.List) != 3 {
+				t.Errorf("expected the imported facts to be tagged, received %d", len(tagged.List))
+			}
+
+			correlated, err := target.(Correlator).Correlated("checkout-1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(correlated) != 3 {
+				t.Errorf("expected the imported facts to be correlated, received %d", len(correlated))
+			}
+		})
+	}
+}
+
+func TestExportTimeRange(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		timestamp := start.Add(time.Duration(i) * time.Hour)
+		fact := Fact{Id: NewIdGenerator().NewId(timestamp), Timestamp: timestamp}
+		if _, err := store.AppendFact("range", "1", fact); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var dump bytes.Buffer
+	count, err := Export(store, &dump, ExportFilter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected the facts from hours 1 and 2, received %d:\n%s", count, dump.String())
+	}
+}
+
+func TestImportRejectsOutOfOrderFacts(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	dump := `{"aggregate":"a","entity":"1","fact":{"Id":"01F0000000AAAAAAAAAAAAAAAA","Timestamp":"2021-03-01T00:00:00Z","Content":{"n":1}}}
+{"aggregate":"a","entity":"2","fact":{"Id":"01E0000000AAAAAAAAAAAAAAAA","Timestamp":"2020-03-01T00:00:00Z","Content":null}}
+{"aggregate":"a","entity":"1","fact":{"Id":"01E0000000AAAAAAAAAAAAAAAA","Timestamp":"2020-03-01T00:00:00Z","Content":{"n":0}}}
+`
+
+	count, err := Import(store, strings.NewReader(dump), nil)
+
+	var importErr ImportError
+	if !errors.As(err, &importErr) || importErr.Line != 3 {
+		t.Fatalf("expected an import error at line 3, received %v", err)
+	}
+
+	if !errors.As(err, &OutOfOrder{}) {
+		t.Errorf("expected the cause to be OutOfOrder, received %v", importErr.Cause)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 records imported before the error, received %d", count)
+	}
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/oklog/ulid/v2"
+	bolt "go.etcd.io/bbolt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// UlidEntityIds are sortable ULIDs, the default
+	UlidEntityIds = "ulid"
+	// UuidEntityIds are random version 4 UUIDs
+	UuidEntityIds = "uuid"
+)
+
+// maxNewEntityAttempts is how many ids are tried before AppendNew gives up on finding an unused one
+const maxNewEntityAttempts = 8
+
+// EntityIdFormat is the format of the entity ids AppendNew generates: a ULID or UUID between a fixed prefix and
+// suffix
+type EntityIdFormat struct {
+	Prefix string
+	Kind   string
+	Suffix string
+}
+
+// NewEntityAppender is implemented by event stores that can generate the id of a new entity
+type NewEntityAppender interface {
+	// AppendNew appends content as the first fact of an entity with an id that is not used yet, and returns the id
+	AppendNew(aggregate string, content interface{}, metadata Metadata) (string, *Tail, error)
+}
+
+// NewEntityImporter is implemented by event stores that let new entities be created elsewhere, so a cluster leader
+// can pick the id of the entity and every member creates the same one
+type NewEntityImporter interface {
+	// NewEntityId generates an id in the aggregate's format, it is not checked against the existing entities
+	NewEntityId(aggregate string) (string, error)
+	// AppendNewFact is AppendFactBy for the first fact of a new entity, an entity that already has other facts is
+	// EntityExists
+	AppendNewFact(aggregate string, entity string, fact Fact, subject string) (*Tail, error)
+}
+
+// ParseEntityIdFormat parses "ulid", "uuid", or a pattern with one {ulid} or {uuid} placeholder such as "order-{ulid}"
+func ParseEntityIdFormat(format string) (EntityIdFormat, error) {
+	switch format {
+	case "", UlidEntityIds:
+		return EntityIdFormat{Kind: UlidEntityIds}, nil
+	case UuidEntityIds:
+		return EntityIdFormat{Kind: UuidEntityIds}, nil
+	}
+
+	var parsed EntityIdFormat
+	for _, kind := range []string{UlidEntityIds, UuidEntityIds} {
+		placeholder := "{" + kind + "}"
+		if i := strings.Index(format, placeholder); i >= 0 {
+			if len(parsed.Kind) > 0 {
+				return parsed, InvalidEntityIdFormat{Format: format, Reason: "only one of {ulid} or {uuid} can be used"}
+			}
+			parsed = EntityIdFormat{Prefix: format[:i], Kind: kind, Suffix: format[i+len(placeholder):]}
+		}
+	}
+
+	switch {
+	case len(parsed.Kind) == 0:
+		return parsed, InvalidEntityIdFormat{Format: format, Reason: "expected ulid, uuid or a {ulid} or {uuid} placeholder"}
+	case strings.Contains(parsed.Prefix+parsed.Suffix, "{"):
+		return parsed, InvalidEntityIdFormat{Format: format, Reason: "only one placeholder can be used"}
+	case strings.ContainsAny(parsed.Prefix+parsed.Suffix, separator+indexSeparator):
+		return parsed, InvalidEntityIdFormat{Format: format, Reason: fmt.Sprintf("entity ids cannot contain %q or %q", separator, indexSeparator)}
+	}
+
+	return parsed, nil
+}
+
+func (f EntityIdFormat) newId(generator IdGenerator, now time.Time) (string, error) {
+	if f.Kind != UuidEntityIds {
+		return f.Prefix + generator.NewId(now).String() + f.Suffix, nil
+	}
+
+	var id [16]byte
+	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+		return "", err
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%s%x-%x-%x-%x-%x%s", f.Prefix, id[0:4], id[4:6], id[6:8], id[8:10], id[10:], f.Suffix), nil
+}
+
+// NewEntityId generates an id for a new entity of the aggregate, see NewEntityImporter
+func (o *storeOptions) NewEntityId(aggregate string) (string, error) {
+	return o.entityIds[aggregate].newId(o.generator, o.clock.Now().UTC())
+}
+
+// newEntity generates ids until one is not used by an entity of the aggregate
+func (o *storeOptions) newEntity(aggregate string, exists func(entity string) (bool, error)) (string, error) {
+	var entity string
+	for i := 0; i < maxNewEntityAttempts; i++ {
+		var err error
+		entity, err = o.NewEntityId(aggregate)
+		if err != nil {
+			return "", err
+		}
+
+		used, err := exists(entity)
+		if err != nil || !used {
+			return entity, err
+		}
+	}
+
+	return "", EntityExists{Aggregate: aggregate, Entity: entity}
+}
+
+func (b *BadgerEventStore) AppendNew(aggregate string, content interface{}, metadata Metadata) (string, *Tail, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return "", nil, err
+	}
+
+	b.writers.RLock()
+	defer b.writers.RUnlock()
+
+	var entity string
+	tail := Tail{}
+	for {
+		err = db.Update(func(txn *badger.Txn) error {
+			// reading the stats of the new entity makes a concurrent append that created it conflict
+			entity, err = b.newEntity(aggregate, func(entity string) (bool, error) {
+				stats, err := b.readEntityStats(txn, aggregate, entity)
+				return err == nil && stats.Total > 0, err
+			})
+			if err != nil {
+				return err
+			}
+
+			return b.appendTxn(txn, aggregate, entity, metadata.Subject, func(last ulid.ULID) Fact {
+				return b.newFact(last, content, metadata)
+			}, &tail)
+		})
+
+		if err != badger.ErrConflict {
+			break
+		}
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return entity, &tail, nil
+}
+
+func (b *BadgerEventStore) AppendNewFact(aggregate string, entity string, fact Fact, subject string) (*Tail, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return nil, err
+	}
+
+	b.writers.RLock()
+	defer b.writers.RUnlock()
+
+	tail := Tail{}
+	for {
+		err = db.Update(func(txn *badger.Txn) error {
+			stats, err := b.readEntityStats(txn, aggregate, entity)
+			if err != nil {
+				return err
+			}
+
+			// replaying the fact that created the entity does nothing
+			if stats.Total > 0 && stats.FirstId != fact.Id {
+				return EntityExists{Aggregate: aggregate, Entity: entity}
+			}
+
+			return b.appendTxn(txn, aggregate, entity, subject, func(ulid.ULID) Fact {
+				return fact
+			}, &tail)
+		})
+
+		if err != badger.ErrConflict {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tail, nil
+}
+
+func (b *BoltEventStore) AppendNew(aggregate string, content interface{}, metadata Metadata) (string, *Tail, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var entity string
+	tail := Tail{}
+	err = db.Update(func(tx *bolt.Tx) error {
+		entity, err = b.newEntity(aggregate, func(entity string) (bool, error) {
+			stats, err := b.readEntityStats(tx, aggregate, entity)
+			return err == nil && stats.Total > 0, err
+		})
+		if err != nil {
+			return err
+		}
+
+		return b.appendTx(tx, aggregate, entity, metadata.Subject, func(last ulid.ULID) Fact {
+			return b.newFact(last, content, metadata)
+		}, &tail)
+	})
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return entity, &tail, nil
+}
+
+func (b *BoltEventStore) AppendNewFact(aggregate string, entity string, fact Fact, subject string) (*Tail, error) {
+	db, err := b.boltDb()
+	if err != nil {
+		return nil, err
+	}
+
+	tail := Tail{}
+	err = db.Update(func(tx *bolt.Tx) error {
+		stats, err := b.readEntityStats(tx, aggregate, entity)
+		if err != nil {
+			return err
+		}
+
+		// replaying the fact that created the entity does nothing
+		if stats.Total > 0 && stats.FirstId != fact.Id {
+			return EntityExists{Aggregate: aggregate, Entity: entity}
+		}
+
+		return b.appendTx(tx, aggregate, entity, subject, func(ulid.ULID) Fact {
+			return fact
+		}, &tail)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tail, nil
+}
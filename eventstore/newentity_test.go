@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseEntityIdFormat(t *testing.T) {
+	valid := map[string]EntityIdFormat{
+		"":               {Kind: UlidEntityIds},
+		"ulid":           {Kind: UlidEntityIds},
+		"uuid":           {Kind: UuidEntityIds},
+		"order-{ulid}":   {Prefix: "order-", Kind: UlidEntityIds},
+		"cust/{uuid}/v1": {Prefix: "cust/", Kind: UuidEntityIds, Suffix: "/v1"},
+		"{ulid}-eu":      {Kind: UlidEntityIds, Suffix: "-eu"},
+	}
+
+	for format, expected := range valid {
+		parsed, err := ParseEntityIdFormat(format)
+		if err != nil {
+			t.Errorf("%q: %v", format, err)
+		} else if parsed != expected {
+			t.Errorf("%q: expected %+v, received %+v", format, expected, parsed)
+		}
+	}
+
+	for _, format := range []string{"guid", "order-", "{ulid}-{uuid}", "{ulid}{ulid}", "a|{ulid}"} {
+		if _, err := ParseEntityIdFormat(format); !errors.As(err, &InvalidEntityIdFormat{}) {
+			t.Errorf("%q: expected InvalidEntityIdFormat, received %v", format, err)
+		}
+	}
+}
+
+func TestAppendNew(t *testing.T) {
+	orders, _ := ParseEntityIdFormat("order-{ulid}")
+	customers, _ := ParseEntityIdFormat("uuid")
+	opts := []Option{WithEntityIds("orders", orders), WithEntityIds("customers", customers)}
+
+	stores := map[string]func(dir string) EventStore{
+		"badger": func(dir string) EventStore { return FileStore(dir, opts...) },
+		"bolt":   func(dir string) EventStore { return BoltFileStore(dir, opts...) },
+	}
+
+	formats := map[string]*regexp.Regexp{
+		"orders":    regexp.MustCompile(`^order-[0-9A-HJKMNP-TV-Z]{26}$`),
+		"customers": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		"other":     regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`),
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t.TempDir())
+			store.Register(Test{})
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			appender := store.(NewEntityAppender)
+			for aggregate, format := range formats {
+				seen := map[string]bool{}
+				for i := 0; i < 3; i++ {
+					entity, tail, err := appender.AppendNew(aggregate, Test{Value: i}, Metadata{Subject: "alice"})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !format.MatchString(entity) || seen[entity] {
+						t.Errorf("%s: expected a new id matching %s, received %s", aggregate, format, entity)
+					}
+					seen[entity] = true
+
+					if tail.Total != 1 {
+						t.Errorf("%s: expected the first fact, received total %d", aggregate, tail.Total)
+					}
+
+					stored, err := store.Tail(aggregate, entity)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if stored.Fact.Id != tail.Fact.Id {
+						t.Errorf("%s: expected tail %s, received %s", aggregate, tail.Fact.Id, stored.Fact.Id)
+					}
+				}
+			}
+
+			// replaying the fact that created an entity does nothing, but it cannot be added to another entity
+			importer := store.(NewEntityImporter)
+			entity, err := importer.NewEntityId("orders")
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now().UTC()
+			fact := Fact{Id: NewIdGenerator().NewId(now), Timestamp: now, OccurredAt: now, Content: Test{Value: 1}}
+			for i := 0; i < 2; i++ {
+				imported, err := importer.AppendNewFact("orders", entity, fact, "bob")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if imported.Total != 1 {
+					t.Errorf("expected the fact to be stored once, received total %d", imported.Total)
+				}
+			}
+
+			if _, err := store.Append("orders", "existing", Test{Value: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := importer.AppendNewFact("orders", "existing", fact, "bob"); !errors.As(err, &EntityExists{}) {
+				t.Errorf("expected EntityExists, received %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+// storeOptions are the settings shared by every EventStore implementation in this package
+type storeOptions struct {
+	Compression          Compression
+	CompressionThreshold int
+	generator            IdGenerator
+	clock                Clock
+	indexes              map[string][]Index
+	derived              map[string][]derivedIndex
+	entityIds            map[string]EntityIdFormat
+}
+
+// Option tunes an event store when it is created.
+type Option func(o *storeOptions)
+
+// WithCompression compresses fact content with the codec once it is at least threshold bytes.
+func WithCompression(codec Compression, threshold int) Option {
+	return func(o *storeOptions) {
+		o.Compression = codec
+		o.CompressionThreshold = threshold
+	}
+}
+
+// WithClock replaces the wall clock that timestamps appended facts and their ids.
+func WithClock(clock Clock) Option {
+	return func(o *storeOptions) {
+		o.clock = clock
+	}
+}
+
+// WithIdGenerator replaces the generator that creates the ids of appended facts.
+func WithIdGenerator(generator IdGenerator) Option {
+	return func(o *storeOptions) {
+		o.generator = generator
+	}
+}
+
+// WithIndexes keeps secondary indexes on the facts appended to their aggregates.  An index whose path
+// changed since the store was last opened is rebuilt, and the entries of removed indexes are dropped.
+func WithIndexes(indexes ...Index) Option {
+	return func(o *storeOptions) {
+		if o.indexes == nil {
+			o.indexes = map[string][]Index{}
+		}
+
+		for i := range indexes {
+			index := indexes[i]
+			o.indexes[index.Aggregate] = append(o.indexes[index.Aggregate], index)
+			o.derive(&index)
+		}
+	}
+}
+
+// WithSearch keeps full text indexes of the facts appended to their aggregates.  Like WithIndexes, an
+// index whose paths changed since the store was last opened is rebuilt.
+func WithSearch(indexes ...SearchIndex) Option {
+	return func(o *storeOptions) {
+		for i := range indexes {
+			index := indexes[i]
+			o.derive(&index)
+		}
+	}
+}
+
+// WithEntityIds sets the format of the entity ids AppendNew generates for the aggregate, ULIDs by default.
+func WithEntityIds(aggregate string, format EntityIdFormat) Option {
+	return func(o *storeOptions) {
+		if o.entityIds == nil {
+			o.entityIds = map[string]EntityIdFormat{}
+		}
+
+		o.entityIds[aggregate] = format
+	}
+}
+
+func (o *storeOptions) derive(index derivedIndex) {
+	if o.derived == nil {
+		o.derived = map[string][]derivedIndex{}
+	}
+
+	o.derived[index.aggregate()] = append(o.derived[index.aggregate()], index)
+}
+
+func newStoreOptions(opts []Option) storeOptions {
+	options := storeOptions{
+		generator: NewIdGenerator(),
+		clock:     SystemClock,
+	}
+	options.derive(locations{})
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
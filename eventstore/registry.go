@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultDriver is used when no driver is configured
+const DefaultDriver = "badger"
+
+// Settings describe where a driver keeps its data
+type Settings struct {
+	// Path to the database files
+	Path string
+	// EncryptionKey turns on encryption at rest, if the driver supports it
+	EncryptionKey []byte
+	// KeyDuration is the encryption key rotation schedule
+	KeyDuration time.Duration
+}
+
+// Driver creates an EventStore from the settings
+type Driver func(settings Settings, opts ...Option) (EventStore, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// RegisterDriver makes a storage backend available by name.  Registering the same name twice panics.
+func RegisterDriver(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver == nil {
+		panic("eventstore: RegisterDriver driver is nil")
+	}
+
+	if _, dup := drivers[name]; dup {
+		panic("eventstore: RegisterDriver called twice for driver " + name)
+	}
+
+	drivers[name] = driver
+}
+
+// Drivers lists the names of the registered drivers
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Open creates an EventStore using the named driver.  An empty name uses the DefaultDriver.
+func Open(name string, settings Settings, opts ...Option) (EventStore, error) {
+	if len(name) == 0 {
+		name = DefaultDriver
+	}
+
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown event store driver: '%s'", name)
+	}
+
+	return driver(settings, opts...)
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/ristretto/z"
+	"io"
+	"strings"
+)
+
+// systemPrefix marks keys used by the event store itself rather than an aggregate
+const systemPrefix = "\x00"
+
+var replicationKey = []byte(systemPrefix + "replication")
+
+// Change is a key and value copied from the leader's store
+type Change struct {
+	Key     []byte
+	Value   []byte
+	Version uint64
+}
+
+func (b *BadgerEventStore) Version() (uint64, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return 0, err
+	}
+
+	return db.MaxVersion(), nil
+}
+
+func (b *BadgerEventStore) Changes(w io.Writer, since uint64) (uint64, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return 0, err
+	}
+
+	enc := gob.NewEncoder(w)
+	upTo := since
+
+	stream := db.NewStream()
+	stream.LogPrefix = "Fact-Totem.Replication"
+	stream.SinceTs = since
+	stream.ChooseKey = func(item *badger.Item) bool {
+		// The system keys, the replication position, index definitions and derived index entries, belong to
+		// the store that wrote them.  A follower derives its own from the facts it applies, with its own
+		// configuration, and the stream could not remove the entries the leader deletes anyway.
+		return !bytes.HasPrefix(item.Key(), []byte(systemPrefix))
+	}
+	stream.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+
+		var batch []Change
+		for _, kv := range list.Kv {
+			if kv.StreamDone {
+				continue
+			}
+
+			batch = append(batch, Change{Key: kv.Key, Value: kv.Value, Version: kv.Version})
+			if kv.Version > upTo {
+				upTo = kv.Version
+			}
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		return enc.Encode(batch)
+	}
+
+	if err := stream.Orchestrate(context.Background()); err != nil {
+		return upTo, err
+	}
+
+	return upTo, nil
+}
+
+func (b *BadgerEventStore) ApplyChanges(r io.Reader) (uint64, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return 0, err
+	}
+
+	b.writers.RLock()
+	defer b.writers.RUnlock()
+
+	applied, err := b.ReplicatedVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	// Changes are streamed in key order rather than version order, so the position is only
+	// moved once every change has been applied.  An interrupted sync is replayed from the start.
+	upTo := applied
+	dec := gob.NewDecoder(r)
+	for {
+		var batch []Change
+		err := dec.Decode(&batch)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return applied, err
+		}
+
+		wb := db.NewWriteBatch()
+		counts := map[string]uint64{}
+		for _, change := range batch {
+			if err := wb.Set(change.Key, change.Value); err != nil {
+				wb.Cancel()
+				return applied, err
+			}
+
+			if err := b.deriveChange(db, wb, change, counts); err != nil {
+				wb.Cancel()
+				return applied, err
+			}
+
+			if change.Version > upTo {
+				upTo = change.Version
+			}
+		}
+
+		if err := addCounts(db, wb, counts); err != nil {
+			wb.Cancel()
+			return applied, err
+		}
+
+		if err := wb.Flush(); err != nil {
+			return applied, err
+		}
+	}
+
+	if upTo == applied {
+		return applied, nil
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set(replicationKey, encodeVersion(upTo))
+	})
+
+	if err != nil {
+		return applied, err
+	}
+
+	return upTo, nil
+}
+
+// deriveChange writes the index entries of a replicated fact, and moves a replicated entity in the
+// last-modified index.  Replaying a change writes the same entries again, and only a fact the follower
+// did not have yet adds to counts.
+func (b *BadgerEventStore) deriveChange(db *badger.DB, wb *badger.WriteBatch, change Change, counts map[string]uint64) error {
+	parts := strings.Split(string(change.Key), separator)
+	switch len(parts) {
+	case 2:
+		return b.deriveStats(db, wb, parts[0], parts[1], change.Value)
+	case 3:
+	default:
+		return nil
+	}
+
+	fact, err := decodeFactValue(change.Value)
+	if err != nil {
+		return err
+	}
+
+	entries, err := b.indexEntries(parts[0], parts[1], *fact)
+	if err != nil {
+		return err
+	}
+
+	replayed := false
+	err = db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(change.Key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		replayed = err == nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.count {
+			if !replayed {
+				counts[string(entry.key)]++
+			}
+			continue
+		}
+
+		if err := wb.Set(entry.key, entry.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addCounts adds the facts counted in a batch of changes to the stored counters, the write batch cannot
+// read them
+func addCounts(db *badger.DB, wb *badger.WriteBatch, counts map[string]uint64) error {
+	return db.View(func(txn *badger.Txn) error {
+		for key, count := range counts {
+			current, err := readEntry(txn, []byte(key))
+			if err != nil {
+				return err
+			}
+
+			if err := wb.Set([]byte(key), addCount(current, count)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// deriveStats replaces the entity's entry in the last-modified index when its replicated stats moved it
+func (b *BadgerEventStore) deriveStats(db *badger.DB, wb *badger.WriteBatch, aggregate string, entity string, value []byte) error {
+	var stats AggregateStats
+	if err := decodeStats(value, &stats); err != nil {
+		return err
+	}
+
+	var current *AggregateStats
+	err := db.View(func(txn *badger.Txn) error {
+		var err error
+		current, err = b.readEntityStats(txn, aggregate, entity)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if current.LastModified.Equal(stats.LastModified) {
+		return nil
+	}
+
+	if !current.LastModified.IsZero() {
+		if err := wb.Delete(modifiedKey(aggregate, entity, current.LastModified)); err != nil {
+			return err
+		}
+	}
+	if stats.LastModified.IsZero() {
+		return nil
+	}
+
+	return wb.Set(modifiedKey(aggregate, entity, stats.LastModified), nil)
+}
+
+func (b *BadgerEventStore) ReplicatedVersion() (uint64, error) {
+	db, err := b.kvStore()
+	if err != nil {
+		return 0, err
+	}
+
+	var version uint64
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(replicationKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			version = binary.BigEndian.Uint64(val)
+			return nil
+		})
+	})
+
+	return version, err
+}
+
+func encodeVersion(version uint64) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, version)
+	return value
+}
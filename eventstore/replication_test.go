@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestBadgerEventStoreReplication(t *testing.T) {
+	leader := MemoryStore().(*BadgerEventStore)
+	follower := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		if err := leader.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := follower.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	leader.Register(Test{})
+
+	for i := 0; i < 5; i++ {
+		if _, err := leader.Append("replicated", "1", Test{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applied := replicate(t, leader, follower)
+
+	version, err := leader.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if applied != version {
+		t.Errorf("expected follower to reach version %d, received %d", version, applied)
+	}
+
+	for i := 5; i < 8; i++ {
+		if _, err := leader.Append("replicated", "2", Test{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := leader.Changes(&buf, applied); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := follower.ApplyChanges(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entity := range []string{"1", "2"} {
+		expected, err := leader.Tail("replicated", entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := follower.Tail("replicated", entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected.Fact.Id != actual.Fact.Id || expected.Total != actual.Total {
+			t.Errorf("entity %s: expected tail %s of %d, received %s of %d", entity, expected.Fact.Id, expected.Total, actual.Fact.Id, actual.Total)
+		}
+	}
+
+	replicated, err := follower.ReplicatedVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err = leader.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replicated != version {
+		t.Errorf("expected replicated version %d, received %d", version, replicated)
+	}
+}
+
+func TestBadgerEventStoreReplicationWithoutChanges(t *testing.T) {
+	leader := MemoryStore().(*BadgerEventStore)
+	follower := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		_ = leader.Close()
+		_ = follower.Close()
+	}()
+
+	leader.Register(Test{})
+	if _, err := leader.Append("replicated", "1", Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := replicate(t, leader, follower)
+	second := replicate(t, leader, follower)
+
+	if first != second {
+		t.Errorf("expected the version to stay at %d, received %d", first, second)
+	}
+}
+
+func replicate(t *testing.T, leader *BadgerEventStore, follower *BadgerEventStore) uint64 {
+	since, err := follower.ReplicatedVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := leader.Changes(&buf, since); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := follower.ApplyChanges(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return applied
+}
+
+func TestBadgerEventStoreReplicationDerivesIndexes(t *testing.T) {
+	index, err := NewIndex("replicated", "value", "$.Content.Value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the follower indexes the facts it applies with its own configuration, not the leader's
+	leader := MemoryStore().(*BadgerEventStore)
+	follower := MemoryStore(WithIndexes(index)).(*BadgerEventStore)
+	defer func() {
+		_ = leader.Close()
+		_ = follower.Close()
+	}()
+
+	leader.Register(Test{})
+	follower.Register(Test{})
+
+	tail, err := leader.AppendWith("replicated", "1", Test{Value: 7}, Metadata{Tags: []string{"seven"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replicate(t, leader, follower)
+
+	matches, err := follower.Lookup("replicated", "value", "7", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches.List) != 1 || matches.List[0].Id != tail.Fact.Id {
+		t.Errorf("expected the follower to index %s, received %+v", tail.Fact.Id, matches.List)
+	}
+
+	tagged, err := follower.Tagged("replicated", "seven", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagged.List) != 1 {
+		t.Errorf("expected the follower to index the tag, received %+v", tagged.List)
+	}
+
+	location, err := follower.Locate(tail.Fact.Id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Entity != "1" {
+		t.Errorf("expected the fact in entity 1, received %+v", location)
+	}
+}
+
+func TestBadgerEventStoreReplicationMovesModifiedEntities(t *testing.T) {
+	leader := MemoryStore().(*BadgerEventStore)
+	follower := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		_ = leader.Close()
+		_ = follower.Close()
+	}()
+
+	leader.Register(Test{})
+	follower.Register(Test{})
+
+	for i := 0; i < 2; i++ {
+		if _, err := leader.Append("replicated", "1", Test{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+		replicate(t, leader, follower)
+	}
+
+	// a follower that catches up in one sync, or replays it, lists the entity once as well
+	search, err := NewSearchIndex("replicated", "$.Content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	late := MemoryStore(WithSearch(search)).(*BadgerEventStore)
+	defer func() {
+		_ = late.Close()
+	}()
+	late.Register(Test{})
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if _, err := leader.Changes(&buf, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := late.ApplyChanges(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tail, err := leader.Tail("replicated", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]*BadgerEventStore{"follower": follower, "late": late} {
+		entities, err := store.ScanModified("replicated", time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entities) != 1 || entities[0].Entity != "1" || !entities[0].LastModified.Equal(tail.Fact.Timestamp) {
+			t.Errorf("%s: expected entity 1 once, modified at %s, received %+v", name, tail.Fact.Timestamp, entities)
+		}
+	}
+
+	if count := searchCount(t, late, "replicated"); count != 2 {
+		t.Errorf("expected the replayed facts to be counted once, received %d", count)
+	}
+}
@@ -0,0 +1,340 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"encoding/binary"
+	"github.com/oklog/ulid/v2"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	searchKeyPrefix = systemPrefix + "search" + indexSeparator
+	// maxTermLength keeps runaway tokens, like encoded blobs, out of the index keys
+	maxTermLength = 64
+	// bm25K1 and bm25B are the usual Okapi BM25 term frequency saturation and length normalization
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchIndex keeps a full text index of an aggregate's facts.  Each path selects a part of the fact, the same
+// way an Index path does, and every string inside that part is searchable.
+type SearchIndex struct {
+	Aggregate string
+	Paths     []string
+	selectors []Index
+}
+
+// SearchHit is a fact that matched a search, a higher score is a better match
+type SearchHit struct {
+	Aggregate string
+	Entity    string
+	Id        ulid.ULID
+	Score     float64
+}
+
+// Searcher is implemented by event stores that keep full text indexes, see WithSearch
+type Searcher interface {
+	// Searchable lists the aggregates with a full text index
+	Searchable() []string
+	// Search ranks the facts of the aggregates by how well they match the words of the query, best first
+	Search(aggregates []string, query string, maxCount int) ([]SearchHit, error)
+}
+
+// NewSearchIndex parses the paths of a full text index, "$.Content" searches all the text in the content
+func NewSearchIndex(aggregate string, paths ...string) (SearchIndex, error) {
+	index := SearchIndex{Aggregate: aggregate, Paths: paths}
+	if len(paths) == 0 {
+		return index, InvalidIndex{Aggregate: aggregate, Name: "search", Reason: "at least one path is required"}
+	}
+
+	for _, path := range paths {
+		selector, err := NewIndex(aggregate, "search", path)
+		if err != nil {
+			return index, err
+		}
+
+		index.selectors = append(index.selectors, selector)
+	}
+
+	return index, nil
+}
+
+func (s *SearchIndex) aggregate() string {
+	return s.Aggregate
+}
+
+func (s *SearchIndex) prefix() []byte {
+	return []byte(searchKeyPrefix + s.Aggregate + indexSeparator)
+}
+
+func (s *SearchIndex) definition() string {
+	return strings.Join(s.Paths, "\n")
+}
+
+// entries store the number of times each term is in the fact, along with the number of terms in the fact.
+// Every fact is also counted, to score how rare a term is.
+func (s *SearchIndex) entries(document interface{}, _ string, entity string, fact Fact) []indexEntry {
+	frequencies := map[string]uint64{}
+	var length uint64
+	for _, selector := range s.selectors {
+		eachString(selector.selected(document), func(text string) {
+			for _, term := range tokenize(text) {
+				frequencies[term]++
+				length++
+			}
+		})
+	}
+
+	entries := make([]indexEntry, 0, len(frequencies)+1)
+	entries = append(entries, indexEntry{key: searchCountKey(s.Aggregate), count: true})
+	for term, frequency := range frequencies {
+		value := make([]byte, 2*binary.MaxVarintLen64)
+		n := binary.PutUvarint(value, frequency)
+		n += binary.PutUvarint(value[n:], length)
+
+		entries = append(entries, indexEntry{
+			key:   []byte(searchTermPrefix(s.Aggregate, term) + fact.Id.String() + indexSeparator + entity),
+			value: value[:n],
+		})
+	}
+
+	return entries
+}
+
+func searchTermPrefix(aggregate string, term string) string {
+	return searchKeyPrefix + aggregate + indexSeparator + term + indexSeparator
+}
+
+// searchCountKey holds the number of facts in the aggregate's full text index.  Terms are never empty, so
+// no term prefix starts with it.
+func searchCountKey(aggregate string) []byte {
+	return []byte(searchTermPrefix(aggregate, ""))
+}
+
+// eachString calls fn with every string in the JSON value
+func eachString(value interface{}, fn func(text string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case map[string]interface{}:
+		for _, element := range v {
+			eachString(element, fn)
+		}
+	case []interface{}:
+		for _, element := range v {
+			eachString(element, fn)
+		}
+	}
+}
+
+// tokenize splits text into lower case words of letters and digits
+func tokenize(text string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, term := range terms {
+		if len(term) > maxTermLength {
+			// cut on a rune boundary
+			cut := maxTermLength
+			for cut > 0 && !isRuneStart(term[cut]) {
+				cut--
+			}
+			terms[i] = term[:cut]
+		}
+	}
+
+	return terms
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xc0 != 0x80
+}
+
+// searchable lists the aggregates with a full text index, in sorted order
+func (o *storeOptions) searchable() []string {
+	var aggregates []string
+	for aggregate, indexes := range o.derived {
+		for _, index := range indexes {
+			if _, ok := index.(*SearchIndex); ok {
+				aggregates = append(aggregates, aggregate)
+				break
+			}
+		}
+	}
+
+	sort.Strings(aggregates)
+	return aggregates
+}
+
+// search scores the facts with Okapi BM25.  The average length is taken over the matching facts, so the
+// index only counts the facts, not their lengths.
+func search(store prefixScanner, searchable []string, aggregates []string, query string, maxCount int) ([]SearchHit, error) {
+	configured := map[string]bool{}
+	for _, aggregate := range searchable {
+		configured[aggregate] = true
+	}
+
+	for _, aggregate := range aggregates {
+		if !configured[aggregate] {
+			return nil, NotSearchable{Aggregate: aggregate}
+		}
+	}
+
+	var terms []string
+	seen := map[string]bool{}
+	for _, term := range tokenize(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	if maxCount < 1 || maxCount > maxPageSize {
+		maxCount = maxPageSize
+	}
+
+	var hits []SearchHit
+	for _, aggregate := range aggregates {
+		found, err := searchAggregate(store, aggregate, terms)
+		if err != nil {
+			return nil, err
+		}
+
+		hits = append(hits, found...)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Id.Compare(hits[j].Id) < 0
+	})
+
+	if len(hits) > maxCount {
+		hits = hits[:maxCount]
+	}
+
+	return hits, nil
+}
+
+type searchCandidate struct {
+	match       IndexMatch
+	length      uint64
+	frequencies []uint64
+}
+
+func searchAggregate(store prefixScanner, aggregate string, terms []string) ([]SearchHit, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var facts float64
+	err := store.scanPrefix(searchCountKey(aggregate), func(_ []byte, value []byte) error {
+		facts = float64(countValue(value))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := map[IndexMatch]*searchCandidate{}
+	documents := make([]int, len(terms))
+	for i, term := range terms {
+		prefix := searchTermPrefix(aggregate, term)
+		err := store.scanPrefix([]byte(prefix), func(key []byte, value []byte) error {
+			match, ok := parseIndexMatch(prefix, key)
+			if !ok {
+				return nil
+			}
+
+			frequency, n := binary.Uvarint(value)
+			length, m := binary.Uvarint(value[n:])
+			if n <= 0 || m <= 0 {
+				return nil
+			}
+
+			candidate, ok := candidates[match]
+			if !ok {
+				candidate = &searchCandidate{match: match, length: length, frequencies: make([]uint64, len(terms))}
+				candidates[match] = candidate
+			}
+
+			candidate.frequencies[i] = frequency
+			documents[i]++
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var totalLength uint64
+	for _, candidate := range candidates {
+		totalLength += candidate.length
+	}
+	averageLength := float64(totalLength) / float64(len(candidates))
+
+	hits := make([]SearchHit, 0, len(candidates))
+	for _, candidate := range candidates {
+		score := 0.0
+		for i, frequency := range candidate.frequencies {
+			if frequency == 0 {
+				continue
+			}
+
+			df := float64(documents[i])
+			idf := math.Log(1 + (facts-df+0.5)/(df+0.5))
+			tf := float64(frequency)
+			norm := 1 - bm25B + bm25B*float64(candidate.length)/averageLength
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+
+		hits = append(hits, SearchHit{
+			Aggregate: aggregate,
+			Entity:    candidate.match.Entity,
+			Id:        candidate.match.Id,
+			Score:     score,
+		})
+	}
+
+	return hits, nil
+}
+
+func (b *BadgerEventStore) Searchable() []string {
+	return b.searchable()
+}
+
+func (b *BadgerEventStore) Search(aggregates []string, query string, maxCount int) ([]SearchHit, error) {
+	return search(b, b.searchable(), aggregates, query, maxCount)
+}
+
+func (b *BoltEventStore) Searchable() []string {
+	return b.searchable()
+}
+
+func (b *BoltEventStore) Search(aggregates []string, query string, maxCount int) ([]SearchHit, error) {
+	return search(b, b.searchable(), aggregates, query, maxCount)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	terms := tokenize("Timeout: connecting to DB-01 failed (Größe)")
+	expectText(t, "terms", "timeout connecting to db 01 failed größe", strings.Join(terms, " "))
+
+	long := tokenize(strings.Repeat("é", maxTermLength))
+	if len(long) != 1 || len(long[0]) > maxTermLength || !strings.HasPrefix(strings.Repeat("é", maxTermLength), long[0]) {
+		t.Errorf("expected the long term to be cut on a rune boundary, got %q", long)
+	}
+}
+
+type ticket struct {
+	Title string
+	Notes []string
+	Code  int
+}
+
+func TestSearch(t *testing.T) {
+	tickets, err := NewSearchIndex("tickets", "$.Content.Title", "$.Content.Notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	people, err := NewSearchIndex("people", "$.Content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchable := WithSearch(tickets, people)
+
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore(searchable) },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir(), searchable) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(ticket{})
+			store.Register(map[string]interface{}{})
+
+			appends := []struct {
+				aggregate string
+				entity    string
+				content   interface{}
+			}{
+				{"tickets", "1", ticket{Title: "Login fails", Notes: []string{"database timeout on login"}}},
+				{"tickets", "2", ticket{Title: "Slow report", Notes: []string{"the report query hits a timeout"}}},
+				{"tickets", "3", ticket{Title: "Printer jam", Code: 42}},
+				{"people", "ada", map[string]interface{}{"name": "Ada Lovelace", "role": "login support"}},
+			}
+			for _, a := range appends {
+				if _, err := store.Append(a.aggregate, a.entity, a.content); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			searcher := store.(Searcher)
+			expectText(t, "searchable", "people tickets", strings.Join(searcher.Searchable(), " "))
+
+			entities := func(aggregates []string, query string) []string {
+				hits, err := searcher.Search(aggregates, query, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found []string
+				for i, hit := range hits {
+					if i > 0 && hit.Score > hits[i-1].Score {
+						t.Errorf("hits are not ranked: %v", hits)
+					}
+					found = append(found, hit.Aggregate+"/"+hit.Entity)
+				}
+				return found
+			}
+
+			expectText(t, "timeout", "tickets/1 tickets/2", strings.Join(entities([]string{"tickets"}, "Timeout"), " "))
+			expectText(t, "login", "tickets/1", strings.Join(entities([]string{"tickets"}, "login"), " "))
+			expectText(t, "login everywhere", "tickets/1 people/ada", strings.Join(entities([]string{"tickets", "people"}, "login"), " "))
+			expectText(t, "both words rank first", "tickets/2 tickets/1", strings.Join(entities([]string{"tickets"}, "report timeout"), " "))
+			expectText(t, "numbers are not text", "", strings.Join(entities([]string{"tickets"}, "42"), " "))
+			expectText(t, "no words", "", strings.Join(entities([]string{"tickets"}, "  !! "), " "))
+
+			_, err := searcher.Search([]string{"orders"}, "login", 0)
+			if !errors.As(err, &NotSearchable{}) {
+				t.Errorf("expected NotSearchable but got %v", err)
+			}
+		})
+	}
+}
+
+func TestSearchCountsFacts(t *testing.T) {
+	title, err := NewSearchIndex("tickets", "$.Content.Title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := NewSearchIndex("tickets", "$.Content.Notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]func(dir string, opts ...Option) EventStore{
+		"badger": func(dir string, opts ...Option) EventStore { return FileStore(dir, opts...) },
+		"bolt":   func(dir string, opts ...Option) EventStore { return BoltFileStore(dir, opts...) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			store := open(dir, WithSearch(title))
+			store.Register(ticket{})
+			for _, entity := range []string{"1", "2", "1"} {
+				if _, err := store.Append("tickets", entity, ticket{Title: "Login fails"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// a fact without text is a document too
+			if _, err := store.Append("tickets", "3", ticket{Code: 42}); err != nil {
+				t.Fatal(err)
+			}
+
+			if count := searchCount(t, store, "tickets"); count != 4 {
+				t.Errorf("expected 4 facts to be counted, received %d", count)
+			}
+
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// changing the paths rebuilds the index and its count
+			store = open(dir, WithSearch(notes))
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			if count := searchCount(t, store, "tickets"); count != 4 {
+				t.Errorf("expected the rebuilt index to count 4 facts, received %d", count)
+			}
+		})
+	}
+}
+
+func searchCount(t *testing.T, store EventStore, aggregate string) uint64 {
+	t.Helper()
+
+	var count uint64
+	err := store.(prefixScanner).scanPrefix(searchCountKey(aggregate), func(_ []byte, value []byte) error {
+		count = countValue(value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func expectText(t *testing.T, field string, expected string, actual string) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("%s expected %q but got %q", field, expected, actual)
+	}
+}
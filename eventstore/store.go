@@ -19,13 +19,23 @@ package eventstore
 
 import (
 	"github.com/oklog/ulid/v2"
+	"io"
 	"time"
 )
 
 type Fact struct {
-	Id        ulid.ULID
+	Id ulid.ULID
+	// Timestamp is when the fact was recorded
 	Timestamp time.Time
-	Content   interface{}
+	// OccurredAt is when the fact happened, the same as Timestamp unless the fact was recorded late
+	OccurredAt time.Time
+	// Tags label the fact so it can be found across entities, see TagReader
+	Tags []string `json:",omitempty"`
+	// CorrelationId groups the facts of one workflow across aggregates, see Correlator
+	CorrelationId string `json:",omitempty"`
+	Content       interface{}
+	// Hash chains the fact to the previous fact in the entity, see Verifier
+	Hash []byte `json:",omitempty"`
 }
 
 type Tail struct {
@@ -44,6 +54,14 @@ type EntityList struct {
 	Total uint
 }
 
+// CompressionStats summarizes the space used by the facts in an aggregate.  Facts stored before
+// the sizes were tracked are counted in Facts but not in the byte totals.
+type CompressionStats struct {
+	Facts       uint
+	RawBytes    uint64
+	StoredBytes uint64
+}
+
 // EventStore provides an interface to store events for a topic, and retrieve them later.
 type EventStore interface {
 	// Register a type for (de)serialization, needed to store and reconstitute objects
@@ -54,8 +72,104 @@ type EventStore interface {
 	Tail(aggregate string, entity string) (*Tail, error)
 	// Read the events for an aggregate from the identified event id
 	Read(aggregate string, entity string, originEventId string, maxCount int) (*RecordList, error)
+	// Get one event of an aggregate by its id, or FactNotFound
+	Get(aggregate string, entity string, factId string) (*Fact, error)
 	// Scan will list all keys in the aggregate (excluding individual events)
 	Scan(aggregate string) (*EntityList, error)
 	// Close the event store
 	Close() error
 }
+
+// CompressionReporter is implemented by event stores that can compress fact content
+type CompressionReporter interface {
+	// CompressionStats reports the raw and stored size of all facts in the aggregate
+	CompressionStats(aggregate string) (*CompressionStats, error)
+}
+
+// AggregateLister is implemented by event stores that can list the aggregates they hold
+type AggregateLister interface {
+	// Aggregates returns the names of every aggregate with at least one entity, in sorted order
+	Aggregates() ([]string, error)
+}
+
+// Verification is the result of walking an entity's hash chain
+type Verification struct {
+	// Verified is the number of facts whose hash matched
+	Verified uint
+	// Unchained is the number of facts stored before the event store hashed facts
+	Unchained uint
+	// Valid is false when a fact was altered or removed
+	Valid bool
+	// BrokenId is the first fact that does not match the chain, unset when a fact was removed from the tail
+	BrokenId ulid.ULID
+	// Reason the chain is broken
+	Reason string
+}
+
+// Verifier is implemented by event stores that chain the facts of each entity with hashes, so that any
+// fact altered or removed after it was appended is detected
+type Verifier interface {
+	// Verify walks the hash chain of the entity and reports the first broken link
+	Verify(aggregate string, entity string) (*Verification, error)
+}
+
+// BitemporalAppender is implemented by event stores that can record facts that happened before they were appended
+type BitemporalAppender interface {
+	// AppendOccurred appends content that happened at occurredAt, or now when it is zero.  The fact's
+	// Timestamp is still the time it was recorded.
+	AppendOccurred(aggregate string, entity string, occurredAt time.Time, content interface{}) (*Tail, error)
+}
+
+// Metadata is the optional part of a new fact
+type Metadata struct {
+	// OccurredAt is when the fact happened, zero when it happened as it is recorded
+	OccurredAt time.Time
+	// Tags label the fact
+	Tags []string
+	// CorrelationId groups the fact with others from the same workflow
+	CorrelationId string
+	// Subject is recorded as the creator when the fact is the first in its entity, see Describer
+	Subject string
+}
+
+// MetadataAppender is implemented by event stores that can append facts with metadata
+type MetadataAppender interface {
+	// AppendWith appends content as the new tail of the entity, with the metadata
+	AppendWith(aggregate string, entity string, content interface{}, metadata Metadata) (*Tail, error)
+}
+
+// Importer is implemented by event stores that can store facts created elsewhere,
+// keeping their original id and timestamp
+type Importer interface {
+	// AppendFact stores the fact as the new tail of the entity. Storing a fact that
+	// already exists does nothing, a fact older than the tail fails with OutOfOrder.
+	AppendFact(aggregate string, entity string, fact Fact) (*Tail, error)
+}
+
+// FactMaker is implemented by event stores that can create a fact the way their own appends do, so a fact
+// created elsewhere uses the store's clock and id generator
+type FactMaker interface {
+	// NewFact timestamps the content and gives it an id that follows last, the id of the entity's tail
+	NewFact(last ulid.ULID, content interface{}, metadata Metadata) Fact
+}
+
+// Backuper is implemented by event stores that can be backed up while they serve requests
+type Backuper interface {
+	// Backup writes every change after the since version, 0 for a full backup, and returns the
+	// version to pass as since for the next incremental backup
+	Backup(w io.Writer, since uint64) (uint64, error)
+	// Restore loads a backup written by Backup on top of the current facts
+	Restore(r io.Reader) error
+}
+
+// Replicator is implemented by event stores that can copy their changes to a read only follower
+type Replicator interface {
+	// Version is the position of the most recent change in the store
+	Version() (uint64, error)
+	// Changes writes every change made after the since version, returning the last version written
+	Changes(w io.Writer, since uint64) (uint64, error)
+	// ApplyChanges stores the changes read from a leader, returning the last version applied
+	ApplyChanges(r io.Reader) (uint64, error)
+	// ReplicatedVersion is the last leader version applied to this store
+	ReplicatedVersion() (uint64, error)
+}
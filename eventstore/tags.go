@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	tagKeyPrefix = systemPrefix + "tag" + indexSeparator
+	// MaxTagLength is the longest tag in bytes
+	MaxTagLength = 128
+	// MaxTags is the most tags a fact can carry
+	MaxTags = 32
+)
+
+// EntityFact is a fact along with the entity it belongs to
+type EntityFact struct {
+	Entity string
+	Fact   Fact
+}
+
+type EntityFactList struct {
+	List     []EntityFact
+	PageSize int
+}
+
+// TagReader is implemented by event stores that index the tags of their facts
+type TagReader interface {
+	// Tagged lists the facts of the aggregate with the tag in the order they were recorded, starting
+	// after the origin fact id
+	Tagged(aggregate string, tag string, origin string, maxCount int) (*EntityFactList, error)
+}
+
+// factFetcher is implemented by the stores in this package to read the facts an index points to
+type factFetcher interface {
+	prefixScanner
+	// fetchFacts reads the matched facts of the aggregate, in the same order
+	fetchFacts(aggregate string, matches []IndexMatch) ([]EntityFact, error)
+}
+
+// ValidateTag checks that a tag can be stored
+func ValidateTag(tag string) error {
+	switch {
+	case len(tag) == 0:
+		return InvalidTag{Tag: tag, Reason: "tags cannot be empty"}
+	case len(tag) > MaxTagLength:
+		return InvalidTag{Tag: tag, Reason: "tags are limited to 128 bytes"}
+	case !utf8.ValidString(tag):
+		return InvalidTag{Tag: tag, Reason: "tags must be UTF-8 text"}
+	case strings.Contains(tag, indexSeparator):
+		return InvalidTag{Tag: tag, Reason: "tags cannot contain a NUL character"}
+	}
+
+	return nil
+}
+
+// uniqueTags drops repeated tags, keeping the order they were given in
+func uniqueTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	unique := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+
+	return unique
+}
+
+// tagEntries are the tag index entries of a fact.  Imported facts are checked here too, as they did not go
+// through newFact.
+func tagEntries(aggregate string, entity string, fact Fact) ([]indexEntry, error) {
+	if len(fact.Tags) > MaxTags {
+		return nil, InvalidTag{Tag: fact.Tags[MaxTags], Reason: "a fact can have at most 32 tags"}
+	}
+
+	var entries []indexEntry
+	for _, tag := range uniqueTags(fact.Tags) {
+		if err := ValidateTag(tag); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, indexEntry{key: []byte(tagPrefix(aggregate, tag) + fact.Id.String() + indexSeparator + entity)})
+	}
+
+	return entries, nil
+}
+
+func tagPrefix(aggregate string, tag string) string {
+	return tagKeyPrefix + aggregate + indexSeparator + tag + indexSeparator
+}
+
+// tagged pages through the tag index and reads the facts it points to
+func tagged(store factFetcher, aggregate string, tag string, origin string, maxCount int) (*EntityFactList, error) {
+	matches, err := lookupPrefix(store, tagPrefix(aggregate, tag), origin, maxCount)
+	if err != nil {
+		return nil, err
+	}
+
+	list := EntityFactList{PageSize: matches.PageSize}
+
+	list.List, err = store.fetchFacts(aggregate, matches.List)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func (b *BadgerEventStore) Tagged(aggregate string, tag string, origin string, maxCount int) (*EntityFactList, error) {
+	return tagged(b, aggregate, tag, origin, maxCount)
+}
+
+func (b *BoltEventStore) Tagged(aggregate string, tag string, origin string, maxCount int) (*EntityFactList, error) {
+	return tagged(b, aggregate, tag, origin, maxCount)
+}
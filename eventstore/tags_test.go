@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTagged(t *testing.T) {
+	stores := map[string]func() EventStore{
+		"badger": func() EventStore { return MemoryStore() },
+		"bolt":   func() EventStore { return BoltFileStore(t.TempDir()) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			store.Register(Test{})
+			appender := store.(MetadataAppender)
+
+			appends := []struct {
+				entity string
+				tags   []string
+			}{
+				{"1", []string{"billing", "migration-2026"}},
+				{"2", nil},
+				{"2", []string{"billing", "billing"}},
+				{"3", []string{"migration-2026"}},
+				{"1", []string{"billing"}},
+			}
+			for i, a := range appends {
+				if _, err := appender.AppendWith("test", a.entity, Test{Value: i}, Metadata{Tags: a.tags}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reader := store.(TagReader)
+			values := func(tag string, origin string, size int) ([]string, *EntityFactList) {
+				list, err := reader.Tagged("test", tag, origin, size)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found []string
+				for _, f := range list.List {
+					found = append(found, f.Entity+":"+string(rune('0'+f.Fact.Content.(Test).Value)))
+				}
+				return found, list
+			}
+
+			found, _ := values("billing", "", 0)
+			expectText(t, "billing", "1:0 2:2 1:4", strings.Join(found, " "))
+
+			found, _ = values("migration-2026", "", 0)
+			expectText(t, "migration", "1:0 3:3", strings.Join(found, " "))
+
+			found, _ = values("nothing", "", 0)
+			expectText(t, "nothing", "", strings.Join(found, " "))
+
+			found, page := values("billing", "", 2)
+			expectText(t, "first page", "1:0 2:2", strings.Join(found, " "))
+
+			found, _ = values("billing", page.List[1].Fact.Id.String(), 2)
+			expectText(t, "second page", "1:4", strings.Join(found, " "))
+
+			if tags := strings.Join(page.List[1].Fact.Tags, " "); tags != "billing" {
+				t.Errorf("expected the repeated tag to be stored once, got %q", tags)
+			}
+
+			verified, err := store.(Verifier).Verify("test", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verified.Valid {
+				t.Errorf("expected the tagged facts to verify: %s", verified.Reason)
+			}
+
+			_, err = appender.AppendWith("test", "1", Test{Value: 9}, Metadata{Tags: []string{""}})
+			if !errors.As(err, &InvalidTag{}) {
+				t.Errorf("expected InvalidTag but got %v", err)
+			}
+		})
+	}
+}
+
+func TestTagsAreHashed(t *testing.T) {
+	fact := Fact{Content: "x"}
+	untagged, err := chainHash(nil, fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fact.Tags = []string{"billing"}
+	tagged, err := chainHash(nil, fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(untagged) == string(tagged) {
+		t.Error("expected the tags to change the hash")
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	for _, tag := range []string{"", strings.Repeat("x", MaxTagLength+1), "a\x00b", "\xff"} {
+		if err := ValidateTag(tag); err == nil {
+			t.Errorf("expected %q to be invalid", tag)
+		}
+	}
+
+	if err := ValidateTag("migration-2026"); err != nil {
+		t.Error(err)
+	}
+}
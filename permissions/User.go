@@ -23,6 +23,7 @@ const (
 	Read     = "read"
 	Append   = "append"
 	Scan     = "scan"
+	Admin    = "admin"
 	Wildcard = "*"
 )
 
@@ -31,6 +32,8 @@ type User struct {
 	Read    []string `yaml:"read"`
 	Append  []string `yaml:"append"`
 	Scan    []string `yaml:"scan"`
+	// Admin users can back up and restore the whole event store
+	Admin bool `yaml:"admin"`
 }
 
 func (u User) CheckPermission(permission string, aggregate string) error {
@@ -41,6 +44,10 @@ func (u User) CheckPermission(permission string, aggregate string) error {
 		return checkAggregates(aggregate, u.Append)
 	case Scan:
 		return checkAggregates(aggregate, u.Scan)
+	case Admin:
+		if u.Admin {
+			return nil
+		}
 	}
 
 	return NotAuthorized{}
@@ -87,6 +87,21 @@ func TestUserCheckPermissionCanScan(t *testing.T) {
 	verifyDenied(t, u, Scan, "fubar")
 }
 
+func TestUserCheckPermissionAdmin(t *testing.T) {
+	admin := User{Subject: "ops", Admin: true}
+	reader := User{
+		Subject: "reader",
+		Read:    []string{"*"},
+		Append:  []string{"*"},
+		Scan:    []string{"*"},
+	}
+
+	verifyPermitted(t, admin, Admin, "")
+	verifyDenied(t, admin, Read, "foo")
+	verifyDenied(t, reader, Admin, "")
+	verifyDenied(t, reader, Admin, "*")
+}
+
 func verifyPermitted(t *testing.T, u User, perm string, aggregate string) {
 	if err := u.CheckPermission(perm, aggregate); err != nil {
 		t.Errorf("expected %s:%s permission but was %s", perm, aggregate, err)
@@ -20,6 +20,7 @@ package jwt
 import (
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -28,7 +29,7 @@ func TestJwtConfigValidTokenWithAudience(t *testing.T) {
 	config := JwtConfig{
 		KeyAlgorithm: jwa.HS512,
 		Audience:     "mytest",
-		KeyPath:      "../jwt.key",
+		KeyPath:      filepath.Join(t.TempDir(), "jwt.key"),
 	}
 	err := config.loadKey()
 	if err != nil {
@@ -72,7 +73,7 @@ func TestJwtConfigValidTokenWithAudience(t *testing.T) {
 func TestJwtConfigValidTokenWithValidTimeSpan(t *testing.T) {
 	config := JwtConfig{
 		KeyAlgorithm:   jwa.HS512,
-		KeyPath:        "../jwt.key",
+		KeyPath:        filepath.Join(t.TempDir(), "jwt.key"),
 		MaxValidWindow: 10 * time.Minute,
 		AcceptableSkew: 50 * time.Millisecond,
 	}
@@ -18,16 +18,23 @@
 package webapi
 
 import (
+	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/D-Haven/fact-totem/eventstore"
 	"github.com/D-Haven/fact-totem/permissions"
-	"io/ioutil"
+	"github.com/oklog/ulid/v2"
 	"net/http"
 	"regexp"
+	"sort"
 	"time"
 )
 
+// maxBatchSize is the most entities a TailMany, ReadMany or Describe can read
+const maxBatchSize = 1000
+
 type Call struct {
 	Action  Action
 	Matcher *regexp.Regexp
@@ -35,24 +42,36 @@ type Call struct {
 
 type FactApi struct {
 	EventStore eventstore.EventStore
+	// RawContent stores the JSON content exactly as it was posted rather than decoding it into
+	// generic maps.  Numbers, key order and nulls survive the round trip through Read and Tail, the
+	// responses only leave out the whitespace between tokens.
+	RawContent bool
+	// Leader is set when this server is a read only follower.  Appends are redirected to it.
+	Leader string
+	// CheckpointKey verifies the signed checkpoints, it is sent with every inclusion proof
+	CheckpointKey ed25519.PublicKey
+	// DiscardRatio is the share of stale data before compaction rewrites a value log file
+	DiscardRatio float64
 }
 
-func NewApi(path string, keyfile string, keyDuration time.Duration) (*FactApi, error) {
+// NewApi opens the event store, encrypted when key is set
+func NewApi(driver string, path string, key []byte, keyDuration time.Duration, opts ...eventstore.Option) (*FactApi, error) {
 	api := FactApi{}
+	settings := eventstore.Settings{
+		Path:          path,
+		EncryptionKey: key,
+		KeyDuration:   keyDuration,
+	}
 
-	if len(keyfile) > 0 {
-		key, err := ioutil.ReadFile(keyfile)
-		if err != nil {
-			return nil, err
-		}
-
-		api.EventStore = eventstore.EncryptedFileStore(path, key, keyDuration)
-	} else {
-		api.EventStore = eventstore.FileStore(path)
+	store, err := eventstore.Open(driver, settings, opts...)
+	if err != nil {
+		return nil, err
 	}
 
+	api.EventStore = store
 	api.EventStore.Register(map[string]interface{}{})
 	api.EventStore.Register([]interface{}{})
+	api.EventStore.Register(json.RawMessage{})
 
 	return &api, nil
 }
@@ -93,39 +112,170 @@ func (api *FactApi) Handle(w http.ResponseWriter, r *http.Request, user *permiss
 	}
 
 	switch req.Action {
-	case Append:
-		tail, err := api.Append(user, req.Aggregate, req.Entity, req.Content)
+	case Append, AppendNew:
+		if len(api.Leader) > 0 {
+			createError(ReadOnly{Leader: api.Leader}).write(w)
+			return
+		}
+
+		content, err := api.decodeContent(req.Content)
+		if err != nil {
+			createError(BadRequest{Element: "content", Cause: err}).write(w)
+			return
+		}
+
+		metadata := eventstore.Metadata{OccurredAt: req.OccurredAt, Tags: req.Tags, CorrelationId: req.CorrelationId, Subject: user.Subject}
+		var tail *TailResponse
+		if req.Action == AppendNew {
+			tail, err = api.AppendNew(user, req.Aggregate, req.Entity, content, metadata)
+		} else {
+			tail, err = api.Append(user, req.Aggregate, req.Entity, content, metadata)
+		}
 		if err != nil {
 			createError(err).write(w)
 			return
 		}
 		w.Header().Set("Location", "/")
-		send(w, http.StatusCreated, tail)
+		api.sendFacts(w, http.StatusCreated, tail)
 	case Read:
-		read, err := api.Read(user, req.Aggregate, req.Entity, req.Origin, req.PageSize)
+		var read *ReadResponse
+		if req.temporal() {
+			var query eventstore.TemporalQuery
+			query, err = req.temporalQuery()
+			if err == nil {
+				read, err = api.ReadTemporal(user, req.Aggregate, req.Entity, query)
+			}
+		} else if req.filtered() {
+			read, err = api.ReadFiltered(user, req.Aggregate, req.Entity, req.Origin, req.PageSize, req.filter())
+		} else {
+			read, err = api.Read(user, req.Aggregate, req.Entity, req.Origin, req.PageSize)
+		}
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		api.sendFacts(w, http.StatusOK, read)
+	case Get:
+		fact, err := api.Get(user, req.Aggregate, req.Entity, req.Fact)
 		if err != nil {
 			createError(err).write(w)
 			return
 		}
-		send(w, http.StatusOK, read)
+		api.sendFacts(w, http.StatusOK, fact)
 	case Tail:
 		tail, err := api.Tail(user, req.Aggregate, req.Entity)
 		if err != nil {
 			createError(err).write(w)
 			return
 		}
-		send(w, http.StatusOK, tail)
+		api.sendFacts(w, http.StatusOK, tail)
+	case TailMany:
+		tails, err := api.TailMany(user, req.Aggregate, req.Entities)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		api.sendFacts(w, http.StatusOK, tails)
+	case ReadMany:
+		lists, err := api.ReadMany(user, req.Aggregate, req.Entities, req.PageSize)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		api.sendFacts(w, http.StatusOK, lists)
 	case Scan:
-		scan, err := api.Scan(user, req.Aggregate)
+		var scan *ScanResponse
+		if req.modifiedScan() {
+			scan, err = api.ScanModified(user, req.Aggregate, req.ModifiedSince, req.OrderBy)
+		} else {
+			scan, err = api.Scan(user, req.Aggregate)
+		}
+		if err == nil && req.Describe {
+			err = api.describeScan(user, scan)
+		}
 		if err != nil {
 			createError(err).write(w)
 			return
 		}
 		send(w, http.StatusOK, scan)
+	case Describe:
+		keys := req.Entities
+		if len(req.Entity) > 0 {
+			keys = append([]string{req.Entity}, keys...)
+		}
+
+		infos, err := api.Describe(user, req.Aggregate, keys)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		send(w, http.StatusOK, infos)
+	case Label:
+		if len(api.Leader) > 0 {
+			createError(ReadOnly{Leader: api.Leader}).write(w)
+			return
+		}
+
+		info, err := api.Label(user, req.Aggregate, req.Entity, req.Labels)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		send(w, http.StatusOK, info)
+	case Compression:
+		stats, err := api.Compression(user, req.Aggregate)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		send(w, http.StatusOK, stats)
+	case Verify:
+		verified, err := api.Verify(user, req.Aggregate, req.Entity)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		send(w, http.StatusOK, verified)
+	case Proof:
+		proof, err := api.Proof(user, req.Aggregate, req.Fact)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		send(w, http.StatusOK, proof)
+	case Index:
+		matches, err := api.Index(user, req.Aggregate, req.Index, req.Value, req.Origin, req.PageSize)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		send(w, http.StatusOK, matches)
+	case Search:
+		hits, err := api.Search(user, req.Aggregate, req.Query, req.PageSize)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		send(w, http.StatusOK, hits)
+	case Tagged:
+		facts, err := api.Tagged(user, req.Aggregate, req.Tag, req.Origin, req.PageSize)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		api.sendFacts(w, http.StatusOK, facts)
+	case Correlated:
+		facts, err := api.Correlated(user, req.CorrelationId)
+		if err != nil {
+			createError(err).write(w)
+			return
+		}
+		api.sendFacts(w, http.StatusOK, facts)
 	}
 }
 
-func (api *FactApi) Append(user *permissions.User, agg string, key string, content interface{}) (*TailResponse, error) {
+// Append records content as the new tail of the entity, along with the metadata
+func (api *FactApi) Append(user *permissions.User, agg string, key string, content interface{}, metadata eventstore.Metadata) (*TailResponse, error) {
 	err := user.CheckPermission(permissions.Append, agg)
 	if err != nil {
 		return nil, err
@@ -140,7 +290,15 @@ func (api *FactApi) Append(user *permissions.User, agg string, key string, conte
 		return nil, BadRequest{Element: "content"}
 	}
 
-	tail, err := api.EventStore.Append(agg, key, content)
+	// the subject is recorded when the store can, only the metadata in the request has to be supported
+	var tail *eventstore.Tail
+	if appender, ok := api.EventStore.(eventstore.MetadataAppender); ok {
+		tail, err = appender.AppendWith(agg, key, content, metadata)
+	} else if metadata.OccurredAt.IsZero() && len(metadata.Tags) == 0 && len(metadata.CorrelationId) == 0 {
+		tail, err = api.EventStore.Append(agg, key, content)
+	} else {
+		return nil, Unsupported{Feature: "occurred-at, tags and correlation-id"}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -154,6 +312,39 @@ func (api *FactApi) Append(user *permissions.User, agg string, key string, conte
 	return &resp, nil
 }
 
+// AppendNew records content as the first fact of a new entity, with an id the event store generates
+func (api *FactApi) AppendNew(user *permissions.User, agg string, key string, content interface{}, metadata eventstore.Metadata) (*TailResponse, error) {
+	err := user.CheckPermission(permissions.Append, agg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) > 0 {
+		return nil, BadRequest{Element: "entity", Cause: errors.New("the entity id of a new entity is generated")}
+	}
+	if content == nil {
+		return nil, BadRequest{Element: "content"}
+	}
+
+	appender, ok := api.EventStore.(eventstore.NewEntityAppender)
+	if !ok {
+		return nil, Unsupported{Feature: "generated entity ids"}
+	}
+
+	entity, tail, err := appender.AppendNew(agg, content, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := TailResponse{
+		Aggregate: agg,
+		Entity:    entity,
+		Fact:      tail.Fact,
+		Total:     tail.Total,
+	}
+	return &resp, nil
+}
+
 func (api *FactApi) Read(user *permissions.User, aggregate string, key string, origin string, size int) (*ReadResponse, error) {
 	err := user.CheckPermission(permissions.Read, aggregate)
 	if err != nil {
@@ -182,6 +373,114 @@ func (api *FactApi) Read(user *permissions.User, aggregate string, key string, o
 	return &resp, nil
 }
 
+// ReadFiltered reads the facts of the entity that match the filter.  Pages only hold matching facts, so the
+// last fact of a page is the origin of the next.
+func (api *FactApi) ReadFiltered(user *permissions.User, aggregate string, key string, origin string, size int, filter eventstore.ReadFilter) (*ReadResponse, error) {
+	err := user.CheckPermission(permissions.Read, aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) == 0 {
+		return nil, BadRequest{Element: "key"}
+	}
+
+	reader, ok := api.EventStore.(eventstore.FilteredReader)
+	if !ok {
+		return nil, Unsupported{Feature: "types and where"}
+	}
+
+	records, err := reader.ReadFiltered(aggregate, key, origin, size, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := ReadResponse{
+		Aggregate: aggregate,
+		Entity:    key,
+		Facts:     records.List,
+		Total:     records.Total,
+		PageSize:  records.PageSize,
+	}
+
+	return &resp, nil
+}
+
+// ReadTemporal reads the facts of the entity that match the query on either time axis
+func (api *FactApi) ReadTemporal(user *permissions.User, aggregate string, key string, query eventstore.TemporalQuery) (*ReadResponse, error) {
+	err := user.CheckPermission(permissions.Read, aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) == 0 {
+		return nil, BadRequest{Element: "key"}
+	}
+
+	records, err := eventstore.ReadTemporal(api.EventStore, aggregate, key, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := ReadResponse{
+		Aggregate: aggregate,
+		Entity:    key,
+		Facts:     records.List,
+		Total:     records.Total,
+		PageSize:  records.PageSize,
+	}
+
+	return &resp, nil
+}
+
+// Get returns one fact.  Without an aggregate and entity the fact is located by its id alone, and is only
+// returned when the user may read the aggregate it is in.
+func (api *FactApi) Get(user *permissions.User, aggregate string, key string, factId string) (*FactResponse, error) {
+	if len(factId) == 0 {
+		return nil, BadRequest{Element: "fact"}
+	}
+
+	if len(aggregate) == 0 && len(key) == 0 {
+		locator, ok := api.EventStore.(eventstore.FactLocator)
+		if !ok {
+			return nil, Unsupported{Feature: "locating facts by id"}
+		}
+
+		location, err := locator.Locate(factId)
+		if err != nil {
+			return nil, err
+		}
+
+		// The caller cannot tell a fact they may not read from one that does not exist
+		if user.CheckPermission(permissions.Read, location.Aggregate) != nil {
+			return nil, NotFound{}
+		}
+
+		aggregate, key = location.Aggregate, location.Entity
+	} else {
+		if err := user.CheckPermission(permissions.Read, aggregate); err != nil {
+			return nil, err
+		}
+
+		if len(key) == 0 {
+			return nil, BadRequest{Element: "key"}
+		}
+	}
+
+	fact, err := api.EventStore.Get(aggregate, key, factId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := FactResponse{
+		Aggregate: aggregate,
+		Entity:    key,
+		Fact:      *fact,
+	}
+
+	return &resp, nil
+}
+
 func (api *FactApi) Tail(user *permissions.User, aggregate string, key string) (*TailResponse, error) {
 	err := user.CheckPermission(permissions.Read, aggregate)
 	if err != nil {
@@ -208,6 +507,98 @@ func (api *FactApi) Tail(user *permissions.User, aggregate string, key string) (
 	return &resp, nil
 }
 
+// TailMany reads the tail of each entity in one pass.  An entity that cannot be read has an error in its
+// place rather than failing the whole batch.
+func (api *FactApi) TailMany(user *permissions.User, aggregate string, keys []string) (*TailManyResponse, error) {
+	reader, err := api.batchReader(user, aggregate, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	tails, err := reader.TailMany(aggregate, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := TailManyResponse{
+		Aggregate: aggregate,
+		Tails:     make([]EntityTail, 0, len(tails)),
+	}
+
+	for _, tail := range tails {
+		entity := EntityTail{Entity: tail.Entity}
+		if tail.Err != nil {
+			failure := createError(tail.Err)
+			entity.Error = &failure
+		} else {
+			entity.Fact = &tail.Tail.Fact
+			entity.Total = tail.Tail.Total
+		}
+		resp.Tails = append(resp.Tails, entity)
+	}
+
+	return &resp, nil
+}
+
+// ReadMany reads the first page of facts of each entity in one pass, see TailMany
+func (api *FactApi) ReadMany(user *permissions.User, aggregate string, keys []string, size int) (*ReadManyResponse, error) {
+	reader, err := api.batchReader(user, aggregate, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := reader.ReadMany(aggregate, keys, size)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := ReadManyResponse{
+		Aggregate: aggregate,
+		Entities:  make([]EntityFacts, 0, len(lists)),
+	}
+
+	for _, list := range lists {
+		entity := EntityFacts{Entity: list.Entity}
+		if list.Err != nil {
+			failure := createError(list.Err)
+			entity.Error = &failure
+		} else {
+			entity.Facts = list.Records.List
+			entity.Total = list.Records.Total
+			entity.PageSize = list.Records.PageSize
+		}
+		resp.Entities = append(resp.Entities, entity)
+	}
+
+	return &resp, nil
+}
+
+// batchReader checks a TailMany or ReadMany request
+func (api *FactApi) batchReader(user *permissions.User, aggregate string, keys []string) (eventstore.BatchReader, error) {
+	if err := user.CheckPermission(permissions.Read, aggregate); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, BadRequest{Element: "entities"}
+	}
+	if len(keys) > maxBatchSize {
+		return nil, BadRequest{Element: "entities", Cause: fmt.Errorf("at most %d entities can be read at once", maxBatchSize)}
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, BadRequest{Element: "entities", Cause: errors.New("entity ids cannot be empty")}
+		}
+	}
+
+	reader, ok := api.EventStore.(eventstore.BatchReader)
+	if !ok {
+		return nil, Unsupported{Feature: "reading many entities"}
+	}
+
+	return reader, nil
+}
+
 func (api *FactApi) Scan(user *permissions.User, aggregate string) (*ScanResponse, error) {
 	err := user.CheckPermission(permissions.Scan, aggregate)
 	if err != nil {
@@ -228,7 +619,461 @@ func (api *FactApi) Scan(user *permissions.User, aggregate string) (*ScanRespons
 	return &resp, nil
 }
 
+// describeScan adds the metadata of the scanned entities.  The metadata describes the facts, so Read
+// permission is needed as well as Scan.
+func (api *FactApi) describeScan(user *permissions.User, scan *ScanResponse) error {
+	if err := user.CheckPermission(permissions.Read, scan.Aggregate); err != nil {
+		return err
+	}
+
+	describer, ok := api.EventStore.(eventstore.Describer)
+	if !ok {
+		return Unsupported{Feature: "describing entities"}
+	}
+
+	descriptions, err := describer.Describe(scan.Aggregate, scan.Entities...)
+	if err != nil {
+		return err
+	}
+
+	scan.Info = make([]EntityInfo, 0, len(descriptions))
+	for _, description := range descriptions {
+		scan.Info = append(scan.Info, describedEntity(description))
+	}
+
+	return nil
+}
+
+// Describe reads the metadata of each entity.  An entity that cannot be described has an error in its place
+// rather than failing the whole batch.
+func (api *FactApi) Describe(user *permissions.User, aggregate string, keys []string) (*DescribeResponse, error) {
+	if err := user.CheckPermission(permissions.Read, aggregate); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, BadRequest{Element: "entities"}
+	}
+	if len(keys) > maxBatchSize {
+		return nil, BadRequest{Element: "entities", Cause: fmt.Errorf("at most %d entities can be described at once", maxBatchSize)}
+	}
+
+	describer, ok := api.EventStore.(eventstore.Describer)
+	if !ok {
+		return nil, Unsupported{Feature: "describing entities"}
+	}
+
+	descriptions, err := describer.Describe(aggregate, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DescribeResponse{
+		Aggregate: aggregate,
+		Entities:  make([]EntityInfo, 0, len(descriptions)),
+	}
+
+	for _, description := range descriptions {
+		resp.Entities = append(resp.Entities, describedEntity(description))
+	}
+
+	return &resp, nil
+}
+
+// Label replaces the labels of the entity, labelling changes the entity so it needs Append permission
+func (api *FactApi) Label(user *permissions.User, aggregate string, key string, labels map[string]string) (*DescribeResponse, error) {
+	if err := user.CheckPermission(permissions.Append, aggregate); err != nil {
+		return nil, err
+	}
+
+	if len(key) == 0 {
+		return nil, BadRequest{Element: "key"}
+	}
+
+	labeler, ok := api.EventStore.(eventstore.Labeler)
+	if !ok {
+		return nil, Unsupported{Feature: "labelling entities"}
+	}
+
+	info, err := labeler.SetLabels(aggregate, key, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DescribeResponse{
+		Aggregate: aggregate,
+		Entities:  []EntityInfo{entityInfo(*info)},
+	}
+
+	return &resp, nil
+}
+
+// describedEntity is the entity's metadata, or the error describing it
+func describedEntity(description eventstore.EntityDescription) EntityInfo {
+	if description.Err != nil {
+		failure := createError(description.Err)
+		return EntityInfo{Entity: description.Entity, Error: &failure}
+	}
+
+	return entityInfo(*description.Info)
+}
+
+func entityInfo(info eventstore.EntityInfo) EntityInfo {
+	return EntityInfo{
+		Entity:       info.Entity,
+		Total:        info.Total,
+		FirstId:      info.FirstId.String(),
+		CreatedAt:    info.CreatedAt,
+		CreatedBy:    info.CreatedBy,
+		LastId:       info.LastId.String(),
+		LastModified: info.LastModified,
+		Labels:       info.Labels,
+	}
+}
+
+// ScanModified lists the entities of the aggregate modified at or after since, sorted by "entity" name or
+// by "modified" time
+func (api *FactApi) ScanModified(user *permissions.User, aggregate string, since time.Time, orderBy string) (*ScanResponse, error) {
+	err := user.CheckPermission(permissions.Scan, aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	if orderBy != "" && orderBy != "entity" && orderBy != "modified" {
+		return nil, BadRequest{Element: "order-by", Cause: fmt.Errorf("expected entity or modified, got '%s'", orderBy)}
+	}
+
+	scanner, ok := api.EventStore.(eventstore.ModifiedScanner)
+	if !ok {
+		return nil, Unsupported{Feature: "modified-since"}
+	}
+
+	entities, err := scanner.ScanModified(aggregate, since)
+	if err != nil {
+		return nil, err
+	}
+
+	if orderBy != "modified" {
+		sort.Slice(entities, func(i, j int) bool {
+			return entities[i].Entity < entities[j].Entity
+		})
+	}
+
+	resp := ScanResponse{
+		Aggregate: aggregate,
+		Entities:  make([]string, 0, len(entities)),
+		Total:     uint(len(entities)),
+		Modified:  make([]ModifiedEntity, 0, len(entities)),
+	}
+
+	for _, entity := range entities {
+		resp.Entities = append(resp.Entities, entity.Entity)
+		resp.Modified = append(resp.Modified, ModifiedEntity{Entity: entity.Entity, LastModified: entity.LastModified})
+	}
+
+	return &resp, nil
+}
+
+func (api *FactApi) Compression(user *permissions.User, aggregate string) (*CompressionResponse, error) {
+	err := user.CheckPermission(permissions.Scan, aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	reporter, ok := api.EventStore.(eventstore.CompressionReporter)
+	if !ok {
+		return nil, Unsupported{Feature: Compression.String()}
+	}
+
+	stats, err := reporter.CompressionStats(aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := CompressionResponse{
+		Aggregate:   aggregate,
+		Facts:       stats.Facts,
+		RawBytes:    stats.RawBytes,
+		StoredBytes: stats.StoredBytes,
+	}
+
+	return &resp, nil
+}
+
+func (api *FactApi) Verify(user *permissions.User, aggregate string, key string) (*VerifyResponse, error) {
+	err := user.CheckPermission(permissions.Read, aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) == 0 {
+		return nil, BadRequest{Element: "key"}
+	}
+
+	verifier, ok := api.EventStore.(eventstore.Verifier)
+	if !ok {
+		return nil, Unsupported{Feature: Verify.String()}
+	}
+
+	result, err := verifier.Verify(aggregate, key)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := VerifyResponse{
+		Aggregate: aggregate,
+		Entity:    key,
+		Valid:     result.Valid,
+		Verified:  result.Verified,
+		Unchained: result.Unchained,
+		Reason:    result.Reason,
+	}
+
+	if !result.Valid && result.BrokenId != (ulid.ULID{}) {
+		resp.BrokenId = result.BrokenId.String()
+	}
+
+	return &resp, nil
+}
+
+func (api *FactApi) Proof(user *permissions.User, aggregate string, factId string) (*ProofResponse, error) {
+	err := user.CheckPermission(permissions.Read, aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointer, ok := api.EventStore.(eventstore.Checkpointer)
+	if !ok {
+		return nil, Unsupported{Feature: Proof.String()}
+	}
+
+	proof, err := checkpointer.Proof(factId)
+	if err != nil {
+		return nil, err
+	}
+
+	// The permission only covers the requested aggregate
+	if proof.Aggregate != aggregate {
+		return nil, NotFound{}
+	}
+
+	resp := ProofResponse{
+		Aggregate: proof.Aggregate,
+		Entity:    proof.Entity,
+		Fact:      proof.Id.String(),
+		Hash:      proof.Hash,
+		Index:     proof.Index,
+		Path:      proof.Path,
+		Checkpoint: CheckpointResponse{
+			Sequence:     proof.Checkpoint.Sequence,
+			Timestamp:    proof.Checkpoint.Timestamp,
+			Size:         proof.Checkpoint.Size,
+			Root:         proof.Checkpoint.Root,
+			PreviousRoot: proof.Checkpoint.PreviousRoot,
+			Signature:    proof.Checkpoint.Signature,
+		},
+		PublicKey: api.CheckpointKey,
+	}
+
+	return &resp, nil
+}
+
+// Index finds the facts with the value in one of the aggregate's secondary indexes.  The matches name
+// entities as well as facts, so both Read and Scan permission are needed.
+func (api *FactApi) Index(user *permissions.User, aggregate string, index string, value string, origin string, size int) (*IndexResponse, error) {
+	if err := user.CheckPermission(permissions.Read, aggregate); err != nil {
+		return nil, err
+	}
+	if err := user.CheckPermission(permissions.Scan, aggregate); err != nil {
+		return nil, err
+	}
+
+	if len(index) == 0 {
+		return nil, BadRequest{Element: "index"}
+	}
+
+	indexer, ok := api.EventStore.(eventstore.Indexer)
+	if !ok {
+		return nil, Unsupported{Feature: Index.String()}
+	}
+
+	matches, err := indexer.Lookup(aggregate, index, value, origin, size)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := IndexResponse{
+		Aggregate: aggregate,
+		Index:     index,
+		Value:     value,
+		Matches:   make([]IndexMatch, 0, len(matches.List)),
+		PageSize:  matches.PageSize,
+	}
+
+	for _, match := range matches.List {
+		resp.Matches = append(resp.Matches, IndexMatch{Entity: match.Entity, Fact: match.Id.String()})
+	}
+
+	return &resp, nil
+}
+
+// Tagged pages through the aggregate's facts with the tag in the order they were recorded.  The facts come
+// from every entity, so both Read and Scan permission are needed.
+func (api *FactApi) Tagged(user *permissions.User, aggregate string, tag string, origin string, size int) (*TaggedResponse, error) {
+	if err := user.CheckPermission(permissions.Read, aggregate); err != nil {
+		return nil, err
+	}
+	if err := user.CheckPermission(permissions.Scan, aggregate); err != nil {
+		return nil, err
+	}
+
+	if len(tag) == 0 {
+		return nil, BadRequest{Element: "tag"}
+	}
+
+	reader, ok := api.EventStore.(eventstore.TagReader)
+	if !ok {
+		return nil, Unsupported{Feature: Tagged.String()}
+	}
+
+	facts, err := reader.Tagged(aggregate, tag, origin, size)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := TaggedResponse{
+		Aggregate: aggregate,
+		Tag:       tag,
+		Facts:     make([]TaggedFact, 0, len(facts.List)),
+		PageSize:  facts.PageSize,
+	}
+
+	for _, fact := range facts.List {
+		resp.Facts = append(resp.Facts, TaggedFact{Entity: fact.Entity, Fact: fact.Fact})
+	}
+
+	return &resp, nil
+}
+
+// Correlated returns every fact with the correlation id in the aggregates the user may read and scan, ordered
+// by timestamp.  The facts name their entities, so like Tagged both Read and Scan permission are needed.  Facts
+// in other aggregates are left out rather than denied, as the caller cannot know where a workflow went.
+func (api *FactApi) Correlated(user *permissions.User, correlationId string) (*CorrelatedResponse, error) {
+	if len(correlationId) == 0 {
+		return nil, BadRequest{Element: "correlation-id"}
+	}
+
+	correlator, ok := api.EventStore.(eventstore.Correlator)
+	if !ok {
+		return nil, Unsupported{Feature: Correlated.String()}
+	}
+
+	facts, err := correlator.Correlated(correlationId, func(aggregate string) bool {
+		return user.CheckPermission(permissions.Read, aggregate) == nil && user.CheckPermission(permissions.Scan, aggregate) == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := CorrelatedResponse{
+		CorrelationId: correlationId,
+		Facts:         make([]CorrelatedFact, 0, len(facts)),
+	}
+
+	for _, fact := range facts {
+		resp.Facts = append(resp.Facts, CorrelatedFact{Aggregate: fact.Aggregate, Entity: fact.Entity, Fact: fact.Fact})
+	}
+
+	return &resp, nil
+}
+
+// Search ranks the facts that match the query in the searchable aggregates the user may read and scan, or in
+// the one aggregate when it is set.  The hits name their entities, so like Tagged both Read and Scan permission
+// are needed.
+func (api *FactApi) Search(user *permissions.User, aggregate string, query string, size int) (*SearchResponse, error) {
+	if len(query) == 0 {
+		return nil, BadRequest{Element: "query"}
+	}
+
+	searcher, ok := api.EventStore.(eventstore.Searcher)
+	if !ok {
+		return nil, Unsupported{Feature: Search.String()}
+	}
+
+	var aggregates []string
+	if len(aggregate) > 0 {
+		if err := user.CheckPermission(permissions.Read, aggregate); err != nil {
+			return nil, err
+		}
+		if err := user.CheckPermission(permissions.Scan, aggregate); err != nil {
+			return nil, err
+		}
+
+		aggregates = append(aggregates, aggregate)
+	} else {
+		for _, searchable := range searcher.Searchable() {
+			if user.CheckPermission(permissions.Read, searchable) == nil && user.CheckPermission(permissions.Scan, searchable) == nil {
+				aggregates = append(aggregates, searchable)
+			}
+		}
+	}
+
+	resp := SearchResponse{Query: query, Hits: []SearchHit{}}
+	if len(aggregates) == 0 {
+		return &resp, nil
+	}
+
+	hits, err := searcher.Search(aggregates, query, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hit := range hits {
+		resp.Hits = append(resp.Hits, SearchHit{
+			Aggregate: hit.Aggregate,
+			Entity:    hit.Entity,
+			Fact:      hit.Id.String(),
+			Score:     hit.Score,
+		})
+	}
+
+	return &resp, nil
+}
+
+// decodeContent converts the posted content into the value we store.  A missing or null
+// content is returned as nil so Append can reject it.
+func (api *FactApi) decodeContent(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	if api.RawContent {
+		if !json.Valid(raw) {
+			return nil, errors.New("the content is not valid JSON")
+		}
+
+		return raw, nil
+	}
+
+	var content interface{}
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
 func send(w http.ResponseWriter, httpStatus int, object interface{}) {
+	sendJSON(w, httpStatus, object, true)
+}
+
+// sendFacts sends a response with facts in it.  Raw content is sent without escaping its HTML characters,
+// so only the whitespace the JSON encoder drops differs from what was posted.
+func (api *FactApi) sendFacts(w http.ResponseWriter, httpStatus int, object interface{}) {
+	sendJSON(w, httpStatus, object, !api.RawContent)
+}
+
+func sendJSON(w http.ResponseWriter, httpStatus int, object interface{}, escapeHTML bool) {
 	if httpStatus == http.StatusNoContent {
 		w.WriteHeader(httpStatus)
 		return
@@ -236,7 +1081,10 @@ func send(w http.ResponseWriter, httpStatus int, object interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpStatus)
 
-	err := json.NewEncoder(w).Encode(object)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(escapeHTML)
+
+	err := enc.Encode(object)
 	if err != nil {
 		createError(err).write(w)
 		return
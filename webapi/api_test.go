@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/D-Haven/fact-totem/permissions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testLeader = "http://leader:8080"
+
+var (
+	writer = &permissions.User{
+		Subject: "writer",
+		Read:    []string{"*"},
+		Append:  []string{"*"},
+		Scan:    []string{"*"},
+	}
+	admin = &permissions.User{
+		Subject: "admin",
+		Read:    []string{"*"},
+		Append:  []string{"*"},
+		Scan:    []string{"*"},
+		Admin:   true,
+	}
+	// reader can read every aggregate but only list the entities of "orders"
+	reader = &permissions.User{
+		Subject: "reader",
+		Read:    []string{"*"},
+		Scan:    []string{"orders"},
+	}
+)
+
+func TestLeaderAcceptsAppends(t *testing.T) {
+	api := testApi(t, "")
+
+	rec := serve(api.Handle, http.MethodPost, "/api/v1/facts", request(t, Append, `{"name":"first"}`), writer)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Append returned %d, expected %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	if _, err := api.EventStore.Tail("test", "entity"); err != nil {
+		t.Errorf("The appended fact was not stored: %v", err)
+	}
+}
+
+func TestFollowerRedirectsChangesToTheLeader(t *testing.T) {
+	api := testApi(t, "")
+
+	backup := serve(api.HandleBackup, http.MethodGet, BackupPath, nil, admin)
+	if backup.Code != http.StatusOK {
+		t.Fatalf("Backup returned %d: %s", backup.Code, backup.Body)
+	}
+
+	api.Leader = testLeader
+
+	changes := []struct {
+		name    string
+		handler AuthenticatedHandler
+		path    string
+		body    []byte
+	}{
+		{"Append", api.Handle, "/api/v1/facts", request(t, Append, `{"name":"first"}`)},
+		{"AppendNew", api.Handle, "/api/v1/facts", request(t, AppendNew, `{"name":"first"}`)},
+		{"Label", api.Handle, "/api/v1/facts", request(t, Label, "")},
+		{"Restore", api.HandleRestore, RestorePath, backup.Body.Bytes()},
+		{"Import", api.HandleImport, ImportPath, []byte(`{"aggregate":"test","entity":"entity"}` + "\n")},
+	}
+
+	for _, change := range changes {
+		t.Run(change.name, func(t *testing.T) {
+			rec := serve(change.handler, http.MethodPost, change.path, change.body, admin)
+			if rec.Code != http.StatusTemporaryRedirect {
+				t.Fatalf("Returned %d, expected %d: %s", rec.Code, http.StatusTemporaryRedirect, rec.Body)
+			}
+
+			if location := rec.Header().Get("Location"); location != testLeader {
+				t.Errorf("Redirected to %q, expected %q", location, testLeader)
+			}
+		})
+	}
+
+	_, err := api.EventStore.Tail("test", "entity")
+	if !errors.As(err, &eventstore.EntityNotFound{}) {
+		t.Errorf("The follower changed its store, Tail returned %v", err)
+	}
+}
+
+func TestFollowerServesReads(t *testing.T) {
+	api := testApi(t, "")
+	if _, err := api.EventStore.Append("test", "entity", map[string]interface{}{"name": "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	api.Leader = testLeader
+
+	rec := serve(api.Handle, http.MethodPost, "/api/v1/facts", request(t, Tail, ""), writer)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Tail returned %d, expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+func TestCorrelatedNeedsScan(t *testing.T) {
+	api := testApi(t, "")
+	appender := api.EventStore.(eventstore.MetadataAppender)
+	for _, aggregate := range []string{"orders", "payments"} {
+		if _, err := appender.AppendWith(aggregate, "1", map[string]interface{}{}, eventstore.Metadata{CorrelationId: "checkout-1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := api.Correlated(reader, "checkout-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Facts) != 1 || resp.Facts[0].Aggregate != "orders" {
+		t.Errorf("expected only the fact in orders, received %+v", resp.Facts)
+	}
+}
+
+func TestSearchNeedsScan(t *testing.T) {
+	var opts []eventstore.Option
+	for _, aggregate := range []string{"orders", "payments"} {
+		index, err := eventstore.NewSearchIndex(aggregate, "$.Content")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, eventstore.WithSearch(index))
+	}
+
+	api := testApi(t, "", opts...)
+	for _, aggregate := range []string{"orders", "payments"} {
+		if _, err := api.EventStore.Append(aggregate, "1", map[string]interface{}{"note": "timeout"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := api.Search(reader, "", "timeout", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Hits) != 1 || resp.Hits[0].Aggregate != "orders" {
+		t.Errorf("expected only the hit in orders, received %+v", resp.Hits)
+	}
+
+	if _, err := api.Search(reader, "payments", "timeout", 10); !errors.As(err, &permissions.NotAuthorized{}) {
+		t.Errorf("expected searching payments to be denied, received %v", err)
+	}
+}
+
+// testApi opens an api over a new store with the options, following leader when it is set
+func testApi(t *testing.T, leader string, opts ...eventstore.Option) *FactApi {
+	api, err := NewApi(eventstore.DefaultDriver, t.TempDir(), nil, 0, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = api.Close() })
+
+	api.Leader = leader
+	return api
+}
+
+// request encodes a request for the "test" aggregate's "entity"
+func request(t *testing.T, action Action, content string) []byte {
+	req := Request{Action: action, Aggregate: "test", Entity: "entity"}
+	if len(content) > 0 {
+		req.Content = json.RawMessage(content)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+// serve records the response of the handler to a request from user
+func serve(handler AuthenticatedHandler, method string, path string, body []byte, user *permissions.User) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, path, bytes.NewReader(body)), user)
+	return rec
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webapi
+
+import (
+	"fmt"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/D-Haven/fact-totem/permissions"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// BackupPath streams a backup of the whole event store
+const BackupPath = "/admin/backup"
+
+// RestorePath loads a backup posted to it
+const RestorePath = "/admin/restore"
+
+// CompactPath compacts the event store and collects its garbage
+const CompactPath = "/admin/compact"
+
+// HandleCompact compacts the event store on demand, rewriting the value log files with at least the
+// "discard-ratio" query parameter of stale data, the configured ratio by default
+func (api *FactApi) HandleCompact(w http.ResponseWriter, r *http.Request, user *permissions.User) {
+	if !checkMethod(w, r, user, http.MethodPost) {
+		return
+	}
+
+	if err := user.CheckPermission(permissions.Admin, ""); err != nil {
+		createError(err).write(w)
+		return
+	}
+
+	maintainer, ok := api.EventStore.(eventstore.Maintainer)
+	if !ok {
+		createError(Unsupported{Feature: "compaction"}).write(w)
+		return
+	}
+
+	ratio := api.DiscardRatio
+	if value := r.URL.Query().Get("discard-ratio"); len(value) > 0 {
+		var err error
+		ratio, err = strconv.ParseFloat(value, 64)
+		if err == nil && (ratio <= 0 || ratio >= 1) {
+			err = fmt.Errorf("must be between 0 and 1")
+		}
+
+		if err != nil {
+			createError(BadRequest{Element: "discard-ratio", Cause: err}).write(w)
+			return
+		}
+	}
+
+	if ratio <= 0 {
+		ratio = eventstore.DefaultDiscardRatio
+	}
+
+	result, err := maintainer.Compact(ratio)
+	if err != nil {
+		createError(err).write(w)
+		return
+	}
+
+	send(w, http.StatusOK, CompactResponse{
+		Rewrites:       result.Rewrites,
+		BytesBefore:    result.BytesBefore,
+		BytesAfter:     result.BytesAfter,
+		ReclaimedBytes: result.Reclaimed(),
+	})
+}
+
+// HandleBackup streams a full backup, or an incremental backup of the changes after the "since" version.
+// The version to pass as "since" next time is sent in the VersionHeader trailer.
+func (api *FactApi) HandleBackup(w http.ResponseWriter, r *http.Request, user *permissions.User) {
+	backuper, ok := api.adminBackuper(w, r, user, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	var since uint64
+	if value := r.URL.Query().Get("since"); len(value) > 0 {
+		var err error
+		since, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			createError(BadRequest{Element: "since", Cause: err}).write(w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", VersionHeader)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, a failed backup is missing the version trailer
+	version, err := backuper.Backup(w, since)
+	if err != nil {
+		log.Printf("Backup error: %s", err)
+		return
+	}
+
+	w.Header().Set(VersionHeader, strconv.FormatUint(version, 10))
+}
+
+// HandleRestore loads the posted backup into the event store.  A follower copies the leader's store, so
+// the backup has to be restored on the leader.
+func (api *FactApi) HandleRestore(w http.ResponseWriter, r *http.Request, user *permissions.User) {
+	backuper, ok := api.adminBackuper(w, r, user, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	if len(api.Leader) > 0 {
+		createError(ReadOnly{Leader: api.Leader}).write(w)
+		return
+	}
+
+	if err := backuper.Restore(r.Body); err != nil {
+		createError(BadRequest{Element: "backup", Cause: err}).write(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminBackuper checks the user is an admin and the store supports backups, writing the error response when not
+func (api *FactApi) adminBackuper(w http.ResponseWriter, r *http.Request, user *permissions.User, method string) (eventstore.Backuper, bool) {
+	if !checkMethod(w, r, user, method) {
+		return nil, false
+	}
+
+	if err := user.CheckPermission(permissions.Admin, ""); err != nil {
+		createError(err).write(w)
+		return nil, false
+	}
+
+	backuper, ok := api.EventStore.(eventstore.Backuper)
+	if !ok {
+		createError(Unsupported{Feature: "backup"}).write(w)
+		return nil, false
+	}
+
+	return backuper, true
+}
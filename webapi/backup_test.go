@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webapi
+
+import (
+	"github.com/D-Haven/fact-totem/permissions"
+	"net/http"
+	"testing"
+)
+
+func TestAdminEndpointsRejectOtherUsers(t *testing.T) {
+	api := testApi(t, "")
+
+	endpoints := []struct {
+		name    string
+		handler AuthenticatedHandler
+		method  string
+		path    string
+	}{
+		{"Backup", api.HandleBackup, http.MethodGet, BackupPath},
+		{"Restore", api.HandleRestore, http.MethodPost, RestorePath},
+		{"Compact", api.HandleCompact, http.MethodPost, CompactPath},
+		{"Import", api.HandleImport, http.MethodPost, ImportPath},
+	}
+
+	users := []struct {
+		name string
+		user *permissions.User
+	}{
+		{"Anonymous", nil},
+		{"NotAdmin", writer},
+	}
+
+	for _, endpoint := range endpoints {
+		for _, user := range users {
+			t.Run(endpoint.name+"/"+user.name, func(t *testing.T) {
+				rec := serve(endpoint.handler, endpoint.method, endpoint.path, nil, user.user)
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("Returned %d, expected %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestAdminChecksPrecedeLeaderRedirect(t *testing.T) {
+	api := testApi(t, testLeader)
+
+	for name, handler := range map[string]AuthenticatedHandler{"Restore": api.HandleRestore, "Import": api.HandleImport} {
+		rec := serve(handler, http.MethodPost, "/", nil, writer)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s returned %d to a follower's non admin user, expected %d", name, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestAdminBacksUpAndRestores(t *testing.T) {
+	api := testApi(t, "")
+	if _, err := api.EventStore.Append("test", "entity", map[string]interface{}{"name": "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := serve(api.HandleBackup, http.MethodGet, BackupPath, nil, admin)
+	if backup.Code != http.StatusOK {
+		t.Fatalf("Backup returned %d: %s", backup.Code, backup.Body)
+	}
+
+	if len(backup.Result().Trailer.Get(VersionHeader)) == 0 {
+		t.Errorf("Backup did not send the %s trailer", VersionHeader)
+	}
+
+	restored := testApi(t, "")
+	rec := serve(restored.HandleRestore, http.MethodPost, RestorePath, backup.Body.Bytes(), admin)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Restore returned %d, expected %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+
+	if _, err := restored.EventStore.Tail("test", "entity"); err != nil {
+		t.Errorf("The restored store is missing the fact: %v", err)
+	}
+}
+
+func TestAdminCompacts(t *testing.T) {
+	api := testApi(t, "")
+
+	rec := serve(api.HandleCompact, http.MethodPost, CompactPath+"?discard-ratio=0.5", nil, admin)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Compact returned %d, expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	rec = serve(api.HandleCompact, http.MethodPost, CompactPath+"?discard-ratio=2", nil, admin)
+	if rec.Code == http.StatusOK {
+		t.Errorf("Compact accepted a discard ratio of 2")
+	}
+}
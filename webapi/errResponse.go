@@ -18,14 +18,16 @@ package webapi
 
 import (
 	"encoding/json"
+	"github.com/D-Haven/fact-totem/eventstore"
 	"github.com/D-Haven/fact-totem/permissions"
 	"log"
 	"net/http"
 )
 
 type ErrorResponse struct {
-	Status  int
-	Message string
+	Status   int
+	Message  string
+	Location string `json:"-"`
 }
 
 func createError(err error) ErrorResponse {
@@ -33,17 +35,28 @@ func createError(err error) ErrorResponse {
 		Message: err.Error(),
 	}
 
+	if redirect, ok := err.(Redirect); ok {
+		r.Status = http.StatusTemporaryRedirect
+		r.Location = redirect.Location()
+		return r
+	}
+
 	switch err.(type) {
-	case NotFound:
+	case NotFound, eventstore.EntityNotFound, eventstore.NotCheckpointed, eventstore.IndexNotFound, eventstore.NotSearchable,
+		eventstore.FactNotFound:
 		r.Status = http.StatusNotFound
 	case Deleted:
 		r.Status = http.StatusGone
-	case RecordExists:
+	case eventstore.InvalidTag, eventstore.InvalidCorrelationId, eventstore.InvalidFilter, eventstore.InvalidLabel:
+		r.Status = http.StatusBadRequest
+	case RecordExists, eventstore.EntityExists, eventstore.FactExists:
 		r.Status = http.StatusConflict
 	case permissions.NotAuthorized:
 		r.Status = http.StatusUnauthorized
 	case Unprocessed:
 		r.Status = http.StatusNotFound
+	case Unsupported:
+		r.Status = http.StatusNotImplemented
 	default:
 		r.Status = http.StatusConflict
 	}
@@ -53,6 +66,9 @@ func createError(err error) ErrorResponse {
 
 func (e ErrorResponse) write(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
+	if len(e.Location) > 0 {
+		w.Header().Set("Location", e.Location)
+	}
 	w.WriteHeader(e.Status)
 	content, err := json.Marshal(&e)
 	if err != nil {
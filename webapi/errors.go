@@ -35,6 +35,20 @@ type Deleted struct {
 	Id string
 }
 
+type Unsupported struct {
+	Feature string
+}
+
+type ReadOnly struct {
+	Leader string
+}
+
+// Redirect is implemented by errors that send the client to another server
+type Redirect interface {
+	error
+	Location() string
+}
+
 type BadRequest struct {
 	Element string
 	Cause   error
@@ -56,6 +70,18 @@ func (p Deleted) Error() string {
 	return fmt.Sprintf("project deleted: %s", p.Id)
 }
 
+func (u Unsupported) Error() string {
+	return fmt.Sprintf("not supported by the event store: %s", u.Feature)
+}
+
+func (r ReadOnly) Error() string {
+	return fmt.Sprintf("this server is a read only follower, send changes to the leader: %s", r.Leader)
+}
+
+func (r ReadOnly) Location() string {
+	return r.Leader
+}
+
 func (br BadRequest) Error() string {
 	b := strings.Builder{}
 	b.WriteString("invalid request format")
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webapi
+
+import (
+	"fmt"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/D-Haven/fact-totem/permissions"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ExportPath streams facts as newline delimited JSON
+const ExportPath = "/export"
+
+// ImportPath appends the posted newline delimited JSON facts with their original ids
+const ImportPath = "/import"
+
+// NdjsonContentType is the media type of exports and imports
+const NdjsonContentType = "application/x-ndjson"
+
+// HandleExport streams the facts of the "aggregate" query parameters, or every aggregate when there
+// are none, limited to the RFC 3339 "from" and "to" timestamps.
+func (api *FactApi) HandleExport(w http.ResponseWriter, r *http.Request, user *permissions.User) {
+	if !checkMethod(w, r, user, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := eventstore.ExportFilter{Aggregates: query["aggregate"]}
+
+	aggregates := filter.Aggregates
+	if len(aggregates) == 0 {
+		aggregates = []string{permissions.Wildcard}
+	}
+
+	for _, aggregate := range aggregates {
+		if err := user.CheckPermission(permissions.Read, aggregate); err != nil {
+			createError(err).write(w)
+			return
+		}
+	}
+
+	var err error
+	if filter.From, err = parseTime(query.Get("from")); err != nil {
+		createError(BadRequest{Element: "from", Cause: err}).write(w)
+		return
+	}
+
+	if filter.To, err = parseTime(query.Get("to")); err != nil {
+		createError(BadRequest{Element: "to", Cause: err}).write(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", NdjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, the client sees a truncated stream
+	if _, err := api.ExportFacts(w, filter); err != nil {
+		log.Printf("Export error: %s", err)
+	}
+}
+
+// HandleImport appends the posted facts.  Importing bypasses the server's id generation, so only
+// admins may import, and like appends the facts must be imported on the leader.
+func (api *FactApi) HandleImport(w http.ResponseWriter, r *http.Request, user *permissions.User) {
+	if !checkMethod(w, r, user, http.MethodPost) {
+		return
+	}
+
+	if err := user.CheckPermission(permissions.Admin, ""); err != nil {
+		createError(err).write(w)
+		return
+	}
+
+	if len(api.Leader) > 0 {
+		createError(ReadOnly{Leader: api.Leader}).write(w)
+		return
+	}
+
+	count, err := api.ImportFacts(r.Body)
+	if err != nil {
+		createError(err).write(w)
+		return
+	}
+
+	send(w, http.StatusOK, ImportResponse{Imported: count})
+}
+
+// ExportFacts writes the facts matching the filter as newline delimited JSON
+func (api *FactApi) ExportFacts(w io.Writer, filter eventstore.ExportFilter) (int, error) {
+	return eventstore.Export(api.EventStore, w, filter)
+}
+
+// ImportFacts appends newline delimited JSON facts, decoding the content the way Append does
+func (api *FactApi) ImportFacts(r io.Reader) (int, error) {
+	importer, ok := api.EventStore.(eventstore.Importer)
+	if !ok {
+		return 0, Unsupported{Feature: "import"}
+	}
+
+	return eventstore.Import(importer, r, api.decodeContent)
+}
+
+// checkMethod writes the error response when there is no user or the request uses another method
+func checkMethod(w http.ResponseWriter, r *http.Request, user *permissions.User, method string) bool {
+	if user == nil {
+		createError(permissions.NotAuthorized{}).write(w)
+		return false
+	}
+
+	if r.Method != method {
+		resp := ErrorResponse{
+			Status:  http.StatusMethodNotAllowed,
+			Message: fmt.Sprintf("unsupported HTTP method: %s", r.Method),
+		}
+
+		resp.write(w)
+		return false
+	}
+
+	return true
+}
+
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webapi
+
+import (
+	"context"
+	"fmt"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"github.com/D-Haven/fact-totem/permissions"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionHeader is the trailer with the last version sent in a replication stream or a backup.  The
+// replication stream leaves out the store's system keys, so it is the last fact change rather than the
+// store's latest version.
+const VersionHeader = "X-Fact-Totem-Version"
+
+// ReplicationPath is where the leader serves its change stream
+const ReplicationPath = "/replicate"
+
+// HandleReplication streams the changes after the "since" version to a follower.  Followers copy the
+// whole store, so only users that can read every aggregate may replicate.
+func (api *FactApi) HandleReplication(w http.ResponseWriter, r *http.Request, user *permissions.User) {
+	if user == nil {
+		createError(permissions.NotAuthorized{}).write(w)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		resp := ErrorResponse{
+			Status:  http.StatusMethodNotAllowed,
+			Message: fmt.Sprintf("unsupported HTTP method: %s", r.Method),
+		}
+
+		resp.write(w)
+		return
+	}
+
+	err := user.CheckPermission(permissions.Read, permissions.Wildcard)
+	if err != nil {
+		createError(err).write(w)
+		return
+	}
+
+	replicator, ok := api.EventStore.(eventstore.Replicator)
+	if !ok {
+		createError(Unsupported{Feature: "replication"}).write(w)
+		return
+	}
+
+	var since uint64
+	if value := r.URL.Query().Get("since"); len(value) > 0 {
+		since, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			createError(BadRequest{Element: "since", Cause: err}).write(w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", VersionHeader)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, the follower sees a truncated stream without the version trailer and tries again
+	version, err := replicator.Changes(w, since)
+	if err != nil {
+		log.Printf("Replication error: %s", err)
+		return
+	}
+
+	w.Header().Set(VersionHeader, strconv.FormatUint(version, 10))
+}
+
+// Follower copies the changes from a leader into the local event store
+type Follower struct {
+	// Leader is the base URL of the leader
+	Leader string
+	// Token is the bearer token presented to the leader
+	Token string
+	// Interval between polls of the leader
+	Interval time.Duration
+	Store    eventstore.Replicator
+	Client   *http.Client
+
+	mu             sync.Mutex
+	leaderVersion  uint64
+	appliedVersion uint64
+	lastSync       time.Time
+	lastErr        error
+}
+
+// Lag reports how far behind the leader a follower is
+type Lag struct {
+	// Versions the leader streamed that were not applied at the last sync
+	Versions uint64
+	// Since the last successful sync, zero if there has not been one
+	Since time.Duration
+	// Err is the last sync error, if any
+	Err error
+}
+
+// Run polls the leader until the context is cancelled
+func (f *Follower) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Sync(); err != nil {
+			log.Printf("Replication error: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync applies the changes made on the leader since the last sync
+func (f *Follower) Sync() error {
+	err := f.sync()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastErr = err
+
+	return err
+}
+
+func (f *Follower) sync() error {
+	since, err := f.Store.ReplicatedVersion()
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(f.Leader, "/") + ReplicationPath + "?since=" + strconv.FormatUint(since, 10)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(f.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+f.Token)
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing replication stream: %s", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leader responded with %s", resp.Status)
+	}
+
+	applied, err := f.Store.ApplyChanges(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// The trailer is only read once the stream has been read to the end
+	leaderVersion, err := strconv.ParseUint(resp.Trailer.Get(VersionHeader), 10, 64)
+	if err != nil {
+		return BadRequest{Element: VersionHeader, Cause: err}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leaderVersion = leaderVersion
+	f.appliedVersion = applied
+	f.lastSync = time.Now()
+
+	return nil
+}
+
+// Lag reports how far behind the leader this follower is
+func (f *Follower) Lag() Lag {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lag := Lag{Err: f.lastErr}
+
+	if f.leaderVersion > f.appliedVersion {
+		lag.Versions = f.leaderVersion - f.appliedVersion
+	}
+
+	if !f.lastSync.IsZero() {
+		lag.Since = time.Since(f.lastSync)
+	}
+
+	return lag
+}
+
+// ReadinessCheck fails while the follower has not synced with the leader within maxLag
+func (f *Follower) ReadinessCheck(maxLag time.Duration) func() error {
+	return func() error {
+		lag := f.Lag()
+
+		if lag.Since == 0 {
+			return fmt.Errorf("not yet synced with leader %s: %v", f.Leader, lag.Err)
+		}
+
+		if lag.Since > maxLag {
+			return fmt.Errorf("replication lag %s (%d versions) behind leader %s: %v", lag.Since, lag.Versions, f.Leader, lag.Err)
+		}
+
+		return nil
+	}
+}
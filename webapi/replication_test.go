@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webapi
+
+import (
+	"crypto/ed25519"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFollowerHasNoLagOnceSynced(t *testing.T) {
+	leader := testApi(t, "")
+	for i := 0; i < 3; i++ {
+		if _, err := leader.EventStore.Append("test", "entity", map[string]interface{}{"value": float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a checkpoint only writes system keys, which are not replicated
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := leader.EventStore.(eventstore.Checkpointer).Checkpoint(key); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leader.HandleReplication(w, r, admin)
+	}))
+	defer server.Close()
+
+	store := eventstore.MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	store.Register(map[string]interface{}{})
+
+	follower := &Follower{Leader: server.URL, Store: store.(eventstore.Replicator)}
+	if err := follower.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lag := follower.Lag(); lag.Versions != 0 || lag.Err != nil {
+		t.Errorf("expected a synced follower to have no lag, received %+v", lag)
+	}
+
+	if tail, err := store.Tail("test", "entity"); err != nil || tail.Total != 3 {
+		t.Errorf("expected the follower to have 3 facts, received %v, %v", tail, err)
+	}
+}
@@ -17,15 +17,115 @@
 
 package webapi
 
-import "github.com/D-Haven/fact-totem/eventstore"
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/D-Haven/fact-totem/eventstore"
+	"time"
+)
 
 type Request struct {
-	Action    Action      `json:"action"`
-	Aggregate string      `json:"aggregate"`
-	Entity    string      `json:"entity,omitempty"`
-	Content   interface{} `json:"content,omitempty"`
-	Origin    string      `json:"origin,omitempty"`
-	PageSize  int         `json:"page-size,omitempty"`
+	Action    Action          `json:"action"`
+	Aggregate string          `json:"aggregate"`
+	Entity    string          `json:"entity,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	Origin    string          `json:"origin,omitempty"`
+	PageSize  int             `json:"page-size,omitempty"`
+	Fact      string          `json:"fact,omitempty"`
+	// OccurredAt backdates an appended fact, it defaults to the time the fact is recorded
+	OccurredAt time.Time `json:"occurred-at"`
+	// Tags label an appended fact
+	Tags []string `json:"tags,omitempty"`
+	// Tag selects the facts a Tagged query returns
+	Tag string `json:"tag,omitempty"`
+	// CorrelationId groups an appended fact with others from the same workflow, and selects the facts a
+	// Correlated query returns
+	CorrelationId string `json:"correlation-id,omitempty"`
+	// OccurredFrom, OccurredTo, RecordedFrom and RecordedTo select the facts a Read returns, see eventstore.TemporalQuery
+	OccurredFrom time.Time `json:"occurred-from"`
+	OccurredTo   time.Time `json:"occurred-to"`
+	RecordedFrom time.Time `json:"recorded-from"`
+	RecordedTo   time.Time `json:"recorded-to"`
+	// OrderBy sorts a Read by "recorded" (the default) or "occurred" time, and a Scan by "entity" (the
+	// default) or "modified" time
+	OrderBy string `json:"order-by,omitempty"`
+	// ModifiedSince limits a Scan to the entities with facts recorded at or after it
+	ModifiedSince time.Time `json:"modified-since"`
+	// Index and Value find facts through a secondary index, Origin and PageSize page through them
+	Index string `json:"index,omitempty"`
+	Value string `json:"value,omitempty"`
+	// Query is the text to Search for
+	Query string `json:"query,omitempty"`
+	// Entities are the entities of the aggregate a TailMany, ReadMany or Describe reads
+	Entities []string `json:"entities,omitempty"`
+	// Describe includes the metadata of each entity in a Scan
+	Describe bool `json:"describe,omitempty"`
+	// Labels replace the labels of the entity in a Label request
+	Labels map[string]string `json:"labels,omitempty"`
+	// Types and Where filter the facts a Read returns, see eventstore.ReadFilter
+	Types []string    `json:"types,omitempty"`
+	Where []Condition `json:"where,omitempty"`
+}
+
+// Condition compares the value at a JSON path in a fact's content, e.g. {"path": "$.total", "op": ">=", "value": 10}
+type Condition struct {
+	Path  string      `json:"path"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// modifiedScan is true when a Scan selects or sorts entities by the time they were last modified
+func (r *Request) modifiedScan() bool {
+	return !r.ModifiedSince.IsZero() || len(r.OrderBy) > 0
+}
+
+// filtered is true when a Read only returns some of the facts
+func (r *Request) filtered() bool {
+	return len(r.Types) > 0 || len(r.Where) > 0
+}
+
+// filter converts the type and content filters of a Read
+func (r *Request) filter() eventstore.ReadFilter {
+	filter := eventstore.ReadFilter{Types: r.Types}
+	for _, condition := range r.Where {
+		filter.Predicates = append(filter.Predicates, eventstore.Predicate{
+			Path:     condition.Path,
+			Operator: eventstore.Operator(condition.Op),
+			Value:    condition.Value,
+		})
+	}
+
+	return filter
+}
+
+// temporal is true when a Read selects or sorts facts by time
+func (r *Request) temporal() bool {
+	return !r.OccurredFrom.IsZero() || !r.OccurredTo.IsZero() ||
+		!r.RecordedFrom.IsZero() || !r.RecordedTo.IsZero() || len(r.OrderBy) > 0
+}
+
+// temporalQuery converts the time fields of a Read
+func (r *Request) temporalQuery() (eventstore.TemporalQuery, error) {
+	query := eventstore.TemporalQuery{
+		OccurredFrom: r.OccurredFrom,
+		OccurredTo:   r.OccurredTo,
+		RecordedFrom: r.RecordedFrom,
+		RecordedTo:   r.RecordedTo,
+		Origin:       r.Origin,
+		PageSize:     r.PageSize,
+		Filter:       r.filter(),
+	}
+
+	switch r.OrderBy {
+	case "", "recorded":
+		query.OrderBy = eventstore.Recorded
+	case "occurred":
+		query.OrderBy = eventstore.Occurred
+	default:
+		return query, BadRequest{Element: "order-by", Cause: fmt.Errorf("expected recorded or occurred, got '%s'", r.OrderBy)}
+	}
+
+	return query, nil
 }
 
 type TailResponse struct {
@@ -35,6 +135,12 @@ type TailResponse struct {
 	Total     uint            `json:"total"`
 }
 
+type FactResponse struct {
+	Aggregate string          `json:"aggregate"`
+	Entity    string          `json:"entity"`
+	Fact      eventstore.Fact `json:"fact"`
+}
+
 type ReadResponse struct {
 	Aggregate string            `json:"aggregate"`
 	Entity    string            `json:"entity"`
@@ -43,8 +149,158 @@ type ReadResponse struct {
 	PageSize  int               `json:"page-size"`
 }
 
+// EntityTail is one entity of a TailMany, Error is set instead of the fact when it could not be read
+type EntityTail struct {
+	Entity string           `json:"entity"`
+	Fact   *eventstore.Fact `json:"fact,omitempty"`
+	Total  uint             `json:"total"`
+	Error  *ErrorResponse   `json:"error,omitempty"`
+}
+
+type TailManyResponse struct {
+	Aggregate string       `json:"aggregate"`
+	Tails     []EntityTail `json:"tails"`
+}
+
+// EntityFacts is one entity of a ReadMany, Error is set instead of the facts when they could not be read
+type EntityFacts struct {
+	Entity   string            `json:"entity"`
+	Facts    []eventstore.Fact `json:"facts"`
+	Total    uint              `json:"total"`
+	PageSize int               `json:"page-size"`
+	Error    *ErrorResponse    `json:"error,omitempty"`
+}
+
+type ReadManyResponse struct {
+	Aggregate string        `json:"aggregate"`
+	Entities  []EntityFacts `json:"entities"`
+}
+
+type ModifiedEntity struct {
+	Entity       string    `json:"entity"`
+	LastModified time.Time `json:"last-modified"`
+}
+
 type ScanResponse struct {
 	Aggregate string   `json:"aggregate"`
 	Entities  []string `json:"entities"`
 	Total     uint     `json:"total"`
+	// Modified is set when the scan used the last-modified times, in the same order as the entities
+	Modified []ModifiedEntity `json:"modified,omitempty"`
+	// Info is set when the scan describes the entities, in the same order as the entities
+	Info []EntityInfo `json:"info,omitempty"`
+}
+
+// EntityInfo is the metadata kept about an entity, CreatedBy is empty when the creator is not known
+type EntityInfo struct {
+	Entity       string            `json:"entity"`
+	Total        uint              `json:"total"`
+	FirstId      string            `json:"first-id"`
+	CreatedAt    time.Time         `json:"created-at"`
+	CreatedBy    string            `json:"created-by,omitempty"`
+	LastId       string            `json:"last-id"`
+	LastModified time.Time         `json:"last-modified"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Error        *ErrorResponse    `json:"error,omitempty"`
+}
+
+type DescribeResponse struct {
+	Aggregate string       `json:"aggregate"`
+	Entities  []EntityInfo `json:"entities"`
+}
+
+type CompressionResponse struct {
+	Aggregate   string `json:"aggregate"`
+	Facts       uint   `json:"facts"`
+	RawBytes    uint64 `json:"raw-bytes"`
+	StoredBytes uint64 `json:"stored-bytes"`
+}
+
+type VerifyResponse struct {
+	Aggregate string `json:"aggregate"`
+	Entity    string `json:"entity"`
+	Valid     bool   `json:"valid"`
+	Verified  uint   `json:"verified"`
+	Unchained uint   `json:"unchained"`
+	BrokenId  string `json:"broken-id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type CheckpointResponse struct {
+	Sequence     uint64    `json:"sequence"`
+	Timestamp    time.Time `json:"timestamp"`
+	Size         uint64    `json:"size"`
+	Root         []byte    `json:"root"`
+	PreviousRoot []byte    `json:"previous-root,omitempty"`
+	Signature    []byte    `json:"signature"`
+}
+
+type ProofResponse struct {
+	Aggregate  string             `json:"aggregate"`
+	Entity     string             `json:"entity"`
+	Fact       string             `json:"fact"`
+	Hash       []byte             `json:"hash"`
+	Index      uint64             `json:"index"`
+	Path       [][]byte           `json:"path"`
+	Checkpoint CheckpointResponse `json:"checkpoint"`
+	PublicKey  []byte             `json:"public-key,omitempty"`
+}
+
+type CompactResponse struct {
+	Rewrites       int   `json:"rewrites"`
+	BytesBefore    int64 `json:"bytes-before"`
+	BytesAfter     int64 `json:"bytes-after"`
+	ReclaimedBytes int64 `json:"reclaimed-bytes"`
+}
+
+type IndexMatch struct {
+	Entity string `json:"entity"`
+	Fact   string `json:"fact"`
+}
+
+type IndexResponse struct {
+	Aggregate string       `json:"aggregate"`
+	Index     string       `json:"index"`
+	Value     string       `json:"value"`
+	Matches   []IndexMatch `json:"matches"`
+	PageSize  int          `json:"page-size"`
+}
+
+type TaggedFact struct {
+	Entity string          `json:"entity"`
+	Fact   eventstore.Fact `json:"fact"`
+}
+
+type TaggedResponse struct {
+	Aggregate string       `json:"aggregate"`
+	Tag       string       `json:"tag"`
+	Facts     []TaggedFact `json:"facts"`
+	PageSize  int          `json:"page-size"`
+}
+
+type CorrelatedFact struct {
+	Aggregate string          `json:"aggregate"`
+	Entity    string          `json:"entity"`
+	Fact      eventstore.Fact `json:"fact"`
+}
+
+type CorrelatedResponse struct {
+	CorrelationId string           `json:"correlation-id"`
+	Facts         []CorrelatedFact `json:"facts"`
+}
+
+type SearchHit struct {
+	Aggregate string  `json:"aggregate"`
+	Entity    string  `json:"entity"`
+	Fact      string  `json:"fact"`
+	Score     float64 `json:"score"`
+}
+
+type SearchResponse struct {
+	Query string      `json:"query"`
+	Hits  []SearchHit `json:"hits"`
+}
+
+type ImportResponse struct {
+	Imported int `json:"imported"`
 }
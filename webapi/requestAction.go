@@ -29,6 +29,19 @@ const (
 	Read
 	Tail
 	Scan
+	Compression
+	Verify
+	Proof
+	Index
+	Search
+	Tagged
+	Correlated
+	Get
+	TailMany
+	ReadMany
+	Describe
+	Label
+	AppendNew
 )
 
 func (a Action) String() string {
@@ -36,17 +49,43 @@ func (a Action) String() string {
 }
 
 var toString = map[Action]string{
-	Append: "Append",
-	Read:   "Read",
-	Tail:   "Tail",
-	Scan:   "Scan",
+	Append:      "Append",
+	Read:        "Read",
+	Tail:        "Tail",
+	Scan:        "Scan",
+	Compression: "Compression",
+	Verify:      "Verify",
+	Proof:       "Proof",
+	Index:       "Index",
+	Search:      "Search",
+	Tagged:      "Tagged",
+	Correlated:  "Correlated",
+	Get:         "Get",
+	TailMany:    "TailMany",
+	ReadMany:    "ReadMany",
+	Describe:    "Describe",
+	Label:       "Label",
+	AppendNew:   "AppendNew",
 }
 
 var toId = map[string]Action{
-	"Append": Append,
-	"Read":   Read,
-	"Tail":   Tail,
-	"Scan":   Scan,
+	"Append":      Append,
+	"Read":        Read,
+	"Tail":        Tail,
+	"Scan":        Scan,
+	"Compression": Compression,
+	"Verify":      Verify,
+	"Proof":       Proof,
+	"Index":       Index,
+	"Search":      Search,
+	"Tagged":      Tagged,
+	"Correlated":  Correlated,
+	"Get":         Get,
+	"TailMany":    TailMany,
+	"ReadMany":    ReadMany,
+	"Describe":    Describe,
+	"Label":       Label,
+	"AppendNew":   AppendNew,
 }
 
 // MarshalJSON marshals the enum as a quoted json string